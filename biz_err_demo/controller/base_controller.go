@@ -60,6 +60,6 @@ func (c *BaseController) XmlRaw(httpCode int, content []byte) mvc.Response {
 }
 
 func (c *BaseController) JsonBizError(err error) mvc.Response {
-	httpStatus, code, msg := biz_err.ErrResponse(err)
+	httpStatus, code, msg := biz_err.ErrResponse(err, c.Ctx.GetHeader("Accept-Language"))
 	return commonResp(msg, httpStatus, response.Code(code), nil)
 }
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"github.com/kataras/iris/v12/mvc"
 	"myTest/demo_home/biz_err_demo/error/biz_err"
-	"myTest/demo_home/biz_err_demo/error/zerr"
 	"myTest/demo_home/biz_err_demo/response"
 	"net/http"
 )
@@ -19,6 +18,6 @@ func (t *TestBizController) BeforeActivation(b mvc.BeforeActivation) {
 
 func (t *TestBizController) TestBizErr() mvc.Result {
 	err1 := errors.New("")
-	err := zerr.BizWrap(err1, biz_err.UsernameOrPasswordInValid, "")
-	return response.JsonBizError(err)
+	err := biz_err.WrapUsernameOrPasswordInValid(err1)
+	return response.JsonBizError(err, t.Ctx.GetHeader("Accept-Language"))
 }
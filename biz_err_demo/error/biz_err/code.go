@@ -1,41 +1,36 @@
 package biz_err
 
 import (
+	"myTest/demo_home/biz_err_demo/error/biz_err/internal/msg_template"
 	"myTest/demo_home/biz_err_demo/error/zerr"
 	"net/http"
-	"strings"
 )
 
-const (
-	Undefined                 = "Undefined"
-	OsCreateFileError         = "OsCreateFileError"
-	ImageNotSupported         = "ImageNotSupported"
-	UsernameOrPasswordInValid = "UsernameOrPasswordInValid"
-)
+// 新增错误码时修改errors.yaml后执行go generate，错误码常量和构造函数生成在code_gen.go中
+//go:generate go run ./gen -config errors.yaml -out code_gen.go
 
-var errorResponseMap = map[string]string{
-	OsCreateFileError:         "创建文件失败",
-	ImageNotSupported:         "图片格式不支持",
-	UsernameOrPasswordInValid: "用户名或密码错误",
-}
+const Undefined = "Undefined"
 
-var errorHttpStatusMap = map[string]int{
-	OsCreateFileError:         http.StatusInternalServerError,
-	ImageNotSupported:         http.StatusInternalServerError,
-	UsernameOrPasswordInValid: http.StatusInternalServerError,
+// lookup 按错误码查询http状态码和对应语言的消息，并替换消息中的变量，错误码没有定义时返回false
+func lookup(code, acceptLanguage string, errWrap *zerr.ErrWrap) (httpStatus int, msg string, ok bool) {
+	r := Current()
+	def, ok := r.Lookup(code)
+	if !ok {
+		return 0, "", false
+	}
+	return def.HttpStatus, msg_template.Render(r.Message(def, acceptLanguage), def.Params(errWrap.Vars(), errWrap.Params())), true
 }
 
-func ParseBizErr(err error) (httpStatus int, code, msg string) {
+// ParseBizErr 解析业务错误，acceptLanguage为请求头Accept-Language，用于选择消息的语言
+func ParseBizErr(err error, acceptLanguage string) (httpStatus int, code, msg string) {
 	if err == nil {
 		code = Undefined
 	}
-	vars := make([]string, 0)
 	errWrap := new(zerr.ErrWrap)
 	var cause error
 	if as := zerr.As(err, &errWrap); as {
 		code = errWrap.Code()
 		cause = errWrap.Cause()
-		vars = errWrap.Vars()
 	} else {
 		code = Undefined
 	}
@@ -44,23 +39,17 @@ func ParseBizErr(err error) (httpStatus int, code, msg string) {
 		if err != nil {
 			undefinedMsg = err.Error()
 		}
+		status, defaultMsg, _ := lookup(code, acceptLanguage, errWrap)
 		if undefinedMsg == "" || undefinedMsg == ": " {
-			undefinedMsg = errorResponseMap[code]
+			undefinedMsg = defaultMsg
 		}
-		return errorHttpStatusMap[code], code, undefinedMsg
+		return status, code, undefinedMsg
 	}
-	if status, ok := errorHttpStatusMap[code]; ok {
+	if status, bizMsg, ok := lookup(code, acceptLanguage, errWrap); ok {
 		httpStatus = status
-	} else {
-		httpStatus = http.StatusOK
-	}
-	if bizMsg, ok := errorResponseMap[code]; ok {
-		for _, v := range vars {
-			bizMsg = strings.Replace(bizMsg, "%s", v, 1)
-		}
 		msg = bizMsg
 		if cause != nil {
-			_, _, causeMsg := ParseBizErr(cause)
+			_, _, causeMsg := ParseBizErr(cause, acceptLanguage)
 			if causeMsg != "" {
 				msg += ", " + causeMsg
 			} else {
@@ -68,37 +57,29 @@ func ParseBizErr(err error) (httpStatus int, code, msg string) {
 			}
 		}
 	} else {
+		httpStatus = http.StatusOK
 		msg = errWrap.Error()
 	}
 	return httpStatus, code, msg
 }
 
-func ErrResponse(err error) (httpStatus int, code, msg string) {
+func ErrResponse(err error, acceptLanguage string) (httpStatus int, code, msg string) {
 	if err == nil {
 		code = Undefined
 	}
-	vars := make([]string, 0)
 	errWrap := new(zerr.ErrWrap)
 	var cause error
 	if as := zerr.As(err, &errWrap); as {
 		code = errWrap.Code()
 		cause = errWrap.Cause()
-		vars = errWrap.Vars()
 	} else {
 		code = Undefined
 	}
-	if status, ok := errorHttpStatusMap[code]; ok {
+	if status, bizMsg, ok := lookup(code, acceptLanguage, errWrap); ok {
 		httpStatus = status
-	} else {
-		httpStatus = http.StatusOK
-	}
-	if bizMsg, ok := errorResponseMap[code]; ok {
-		for _, v := range vars {
-			bizMsg = strings.Replace(bizMsg, "%s", v, 1)
-		}
 		msg = bizMsg
 		if cause != nil {
-			_, _, causeMsg := ErrResponse(cause)
+			_, _, causeMsg := ErrResponse(cause, acceptLanguage)
 			if causeMsg != "" {
 				msg += causeMsg
 			} else {
@@ -106,6 +87,7 @@ func ErrResponse(err error) (httpStatus int, code, msg string) {
 			}
 		}
 	} else {
+		httpStatus = http.StatusOK
 		msg = errWrap.Error()
 	}
 	return httpStatus, code, msg
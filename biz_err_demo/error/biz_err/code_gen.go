@@ -0,0 +1,58 @@
+// Code generated by biz_err/gen from errors.yaml; DO NOT EDIT.
+
+package biz_err
+
+import "myTest/demo_home/biz_err_demo/error/zerr"
+
+const (
+	// OsCreateFileError 创建文件失败
+	OsCreateFileError = "OsCreateFileError"
+	// ImageNotSupported 图片{filename}的格式不支持
+	ImageNotSupported = "ImageNotSupported"
+	// UsernameOrPasswordInValid 用户名或密码错误
+	UsernameOrPasswordInValid = "UsernameOrPasswordInValid"
+)
+
+// codes 代码中使用的错误码，注册表中必须都有定义
+var codes = []string{
+	OsCreateFileError,
+	ImageNotSupported,
+	UsernameOrPasswordInValid,
+}
+
+// codePlaceholders 生成构造函数时各个错误码的变量，注册表中的定义必须一致
+var codePlaceholders = map[string][]string{
+	OsCreateFileError:         {},
+	ImageNotSupported:         {"filename"},
+	UsernameOrPasswordInValid: {},
+}
+
+// NewOsCreateFileError 创建文件失败
+func NewOsCreateFileError() error {
+	return zerr.DefaultBizWrapParamsSkip(1, OsCreateFileError, map[string]string{})
+}
+
+// WrapOsCreateFileError 把err包装为OsCreateFileError，err为nil时返回nil
+func WrapOsCreateFileError(err error) error {
+	return zerr.BizWrapParamsSkip(1, err, OsCreateFileError, "", map[string]string{})
+}
+
+// NewImageNotSupported 图片{filename}的格式不支持
+func NewImageNotSupported(filename string) error {
+	return zerr.DefaultBizWrapParamsSkip(1, ImageNotSupported, map[string]string{"filename": filename})
+}
+
+// WrapImageNotSupported 把err包装为ImageNotSupported，err为nil时返回nil
+func WrapImageNotSupported(err error, filename string) error {
+	return zerr.BizWrapParamsSkip(1, err, ImageNotSupported, "", map[string]string{"filename": filename})
+}
+
+// NewUsernameOrPasswordInValid 用户名或密码错误
+func NewUsernameOrPasswordInValid() error {
+	return zerr.DefaultBizWrapParamsSkip(1, UsernameOrPasswordInValid, map[string]string{})
+}
+
+// WrapUsernameOrPasswordInValid 把err包装为UsernameOrPasswordInValid，err为nil时返回nil
+func WrapUsernameOrPasswordInValid(err error) error {
+	return zerr.BizWrapParamsSkip(1, err, UsernameOrPasswordInValid, "", map[string]string{})
+}
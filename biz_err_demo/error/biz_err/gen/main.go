@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"gopkg.in/yaml.v3"
+	"myTest/demo_home/biz_err_demo/error/biz_err/internal/msg_template"
+	"os"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+/*
+根据错误码注册表生成代码，在biz_err目录下执行 go generate：
+1. 每个错误码生成一个常量，以及New+错误码、Wrap+错误码两个构造函数，变量作为字符串参数按placeholders的顺序传入
+2. 生成codes和codePlaceholders，加载注册表时校验配置文件和生成的代码是否一致
+3. 错误码重复、错误码不是合法的导出标识符、消息模板格式错误、消息中使用了没有声明的变量、声明的变量在某个语言的消息中没有使用时生成失败，
+   消息模板的校验和biz_err加载注册表时使用同一个msg_template包
+不依赖biz_err包，biz_err生成的代码有问题时也可以重新生成
+*/
+
+var (
+	config = flag.String("config", "errors.yaml", "error registry config file")
+	out    = flag.String("out", "code_gen.go", "generated go file")
+	pkg    = flag.String("package", "biz_err", "package name of the generated file")
+)
+
+type definition struct {
+	Code         string            `yaml:"code"`
+	HttpStatus   int               `yaml:"httpStatus"`
+	Messages     map[string]string `yaml:"messages"`
+	Placeholders []string          `yaml:"placeholders"`
+}
+
+type registry struct {
+	DefaultLocale string        `yaml:"defaultLocale"`
+	Errors        []*definition `yaml:"errors"`
+}
+
+type param struct {
+	Name string
+	Arg  string
+}
+
+type errorCode struct {
+	Code    string
+	Comment string
+	Params  []param
+}
+
+func main() {
+	flag.Parse()
+	data, err := os.ReadFile(*config)
+	if err != nil {
+		fail(err)
+	}
+	r := new(registry)
+	if err = yaml.Unmarshal(data, r); err != nil {
+		fail(err)
+	}
+	codes, problems := check(r)
+	if len(problems) > 0 {
+		fail(fmt.Errorf("%s:\n  %s", *config, strings.Join(problems, "\n  ")))
+	}
+	buf := new(bytes.Buffer)
+	err = codeTemplate.Execute(buf, map[string]interface{}{
+		"Package": *pkg,
+		"Config":  *config,
+		"Codes":   codes,
+	})
+	if err != nil {
+		fail(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		fail(fmt.Errorf("format generated code: %w\n%s", err, buf.String()))
+	}
+	if err = os.WriteFile(*out, src, 0644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func check(r *registry) ([]*errorCode, []string) {
+	problems := make([]string, 0)
+	codes := make([]*errorCode, 0, len(r.Errors))
+	seen := make(map[string]bool)
+	for i, def := range r.Errors {
+		if !token.IsIdentifier(def.Code) || !token.IsExported(def.Code) {
+			problems = append(problems, fmt.Sprintf("errors[%d]: code %q is not an exported go identifier", i, def.Code))
+			continue
+		}
+		if seen[def.Code] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate code", def.Code))
+			continue
+		}
+		seen[def.Code] = true
+		problems = append(problems, msg_template.Check(def.Code, def.Messages, def.Placeholders)...)
+		code := &errorCode{Code: def.Code, Comment: def.Messages[r.DefaultLocale]}
+		args := make(map[string]bool)
+		for _, name := range def.Placeholders {
+			arg := argName(name)
+			for args[arg] {
+				arg += "_"
+			}
+			args[arg] = true
+			code.Params = append(code.Params, param{Name: name, Arg: arg})
+		}
+		codes = append(codes, code)
+	}
+	return codes, problems
+}
+
+// argName 变量名转成小驼峰的参数名，和关键字、err重名时加后缀
+func argName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '_' })
+	var sb strings.Builder
+	for i, p := range parts {
+		if i == 0 {
+			sb.WriteString(strings.ToLower(p[:1]) + p[1:])
+			continue
+		}
+		sb.WriteString(strings.ToUpper(p[:1]) + p[1:])
+	}
+	arg := sb.String()
+	if arg == "" || unicode.IsDigit(rune(arg[0])) {
+		arg = "v" + arg
+	}
+	if token.IsKeyword(arg) || arg == "err" {
+		arg += "Value"
+	}
+	return arg
+}
+
+var codeTemplate = template.Must(template.New("code").Parse(`// Code generated by biz_err/gen from {{.Config}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import "myTest/demo_home/biz_err_demo/error/zerr"
+
+const (
+{{- range .Codes}}
+	// {{.Code}} {{.Comment}}
+	{{.Code}} = "{{.Code}}"
+{{- end}}
+)
+
+// codes 代码中使用的错误码，注册表中必须都有定义
+var codes = []string{
+{{- range .Codes}}
+	{{.Code}},
+{{- end}}
+}
+
+// codePlaceholders 生成构造函数时各个错误码的变量，注册表中的定义必须一致
+var codePlaceholders = map[string][]string{
+{{- range .Codes}}
+	{{.Code}}: { {{- range .Params}}"{{.Name}}", {{end -}} },
+{{- end}}
+}
+{{range .Codes}}
+{{- $code := .}}
+// New{{.Code}} {{.Comment}}
+func New{{.Code}}({{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p.Arg}}{{end}}{{if .Params}} string{{end}}) error {
+	return zerr.DefaultBizWrapParamsSkip(1, {{.Code}}, map[string]string{ {{- range .Params}}"{{.Name}}": {{.Arg}}, {{end -}} })
+}
+
+// Wrap{{.Code}} 把err包装为{{.Code}}，err为nil时返回nil
+func Wrap{{.Code}}(err error{{range .Params}}, {{.Arg}}{{end}}{{if .Params}} string{{end}}) error {
+	return zerr.BizWrapParamsSkip(1, err, {{.Code}}, "", map[string]string{ {{- range .Params}}"{{.Name}}": {{.Arg}}, {{end -}} })
+}
+{{end}}`))
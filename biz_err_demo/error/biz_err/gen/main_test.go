@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	r := &registry{
+		DefaultLocale: "zh",
+		Errors: []*definition{
+			{Code: "FileNotFound", Messages: map[string]string{"zh": "文件{name}不存在", "en": "file not found"}, Placeholders: []string{"name"}},
+			{Code: "FileNotFound", Messages: map[string]string{"zh": "文件不存在"}},
+			{Code: "badCode", Messages: map[string]string{"zh": "错误"}},
+			{Code: "TypeError", Messages: map[string]string{"zh": "{{type}}为{type}，{err}"}, Placeholders: []string{"type", "err"}},
+			//和加载注册表时一样拒绝格式错误的模板
+			{Code: "BadTemplate", Messages: map[string]string{"zh": "a } b", "en": "{bad name}"}},
+		},
+	}
+	codes, problems := check(r)
+	want := []string{
+		"FileNotFound: placeholder name is not used in message for en",
+		"FileNotFound: duplicate code",
+		`errors[2]: code "badCode" is not an exported go identifier`,
+		`BadTemplate: message for en: invalid message template: invalid placeholder {bad name} in "{bad name}"`,
+		`BadTemplate: message for zh: invalid message template: unexpected } at 2 in "a } b"`,
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s", strings.Join(problems, "\n"))
+	}
+	if len(codes) != 3 || codes[1].Params[0].Arg != "typeValue" || codes[1].Params[1].Arg != "errValue" {
+		t.Fatalf("got %+v", codes[1].Params)
+	}
+}
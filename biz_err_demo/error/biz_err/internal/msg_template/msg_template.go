@@ -0,0 +1,133 @@
+package msg_template
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+错误消息模板的解析和校验，biz_err加载注册表和gen生成代码使用同一套规则：
+1. 变量用{name}表示，name只能包含字母、数字和下划线；{{和}}分别输出{和}
+2. 变量值只替换一次，值中包含{name}或者%s时原样输出，不会被再次替换
+3. 缺少变量时保留{name}原样输出，方便发现漏传的变量
+*/
+
+var ErrInvalidTemplate = errors.New("invalid message template")
+
+// Placeholders 按出现顺序返回模板中的变量名，模板格式错误时返回错误
+func Placeholders(tpl string) ([]string, error) {
+	names := make([]string, 0)
+	err := scan(tpl, func(text string) {}, func(name string) {
+		names = append(names, name)
+	})
+	return names, err
+}
+
+// Render 用params替换模板中的变量，模板格式错误时原样返回
+func Render(tpl string, params map[string]string) string {
+	sb := new(strings.Builder)
+	err := scan(tpl, func(text string) {
+		sb.WriteString(text)
+	}, func(name string) {
+		if v, ok := params[name]; ok {
+			sb.WriteString(v)
+			return
+		}
+		sb.WriteString("{" + name + "}")
+	})
+	if err != nil {
+		return tpl
+	}
+	return sb.String()
+}
+
+// Check 校验一个错误码的消息和变量：变量重复声明、模板格式错误、使用了没有声明的变量、声明的变量在某个语言的消息中没有使用
+func Check(code string, messages map[string]string, declared []string) []string {
+	problems := make([]string, 0)
+	names := make(map[string]bool)
+	unique := make([]string, 0, len(declared))
+	for _, name := range declared {
+		if names[name] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate placeholder %s", code, name))
+			continue
+		}
+		names[name] = true
+		unique = append(unique, name)
+	}
+	locales := make([]string, 0, len(messages))
+	for locale := range messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		used, err := Placeholders(messages[locale])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: message for %s: %v", code, locale, err))
+			continue
+		}
+		usedNames := make(map[string]bool)
+		for _, name := range used {
+			usedNames[name] = true
+			if !names[name] {
+				problems = append(problems, fmt.Sprintf("%s: message for %s uses undeclared placeholder {%s}", code, locale, name))
+			}
+		}
+		for _, name := range unique {
+			if !usedNames[name] {
+				problems = append(problems, fmt.Sprintf("%s: placeholder %s is not used in message for %s", code, name, locale))
+			}
+		}
+	}
+	return problems
+}
+
+func scan(tpl string, text func(string), param func(string)) error {
+	for i := 0; i < len(tpl); {
+		switch tpl[i] {
+		case '{':
+			if strings.HasPrefix(tpl[i:], "{{") {
+				text("{")
+				i += 2
+				continue
+			}
+			end := strings.IndexByte(tpl[i:], '}')
+			if end < 0 {
+				return fmt.Errorf("%w: unclosed { at %d in %q", ErrInvalidTemplate, i, tpl)
+			}
+			name := tpl[i+1 : i+end]
+			if !validName(name) {
+				return fmt.Errorf("%w: invalid placeholder {%s} in %q", ErrInvalidTemplate, name, tpl)
+			}
+			param(name)
+			i += end + 1
+		case '}':
+			if !strings.HasPrefix(tpl[i:], "}}") {
+				return fmt.Errorf("%w: unexpected } at %d in %q", ErrInvalidTemplate, i, tpl)
+			}
+			text("}")
+			i += 2
+		default:
+			end := strings.IndexAny(tpl[i:], "{}")
+			if end < 0 {
+				end = len(tpl) - i
+			}
+			text(tpl[i : i+end])
+			i += end
+		}
+	}
+	return nil
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package msg_template
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		tpl    string
+		params map[string]string
+		want   string
+	}{
+		{"用户{username}不存在", map[string]string{"username": "ziyi"}, "用户ziyi不存在"},
+		//变量值只替换一次
+		{"{a}-{b}", map[string]string{"a": "{b}", "b": "%s"}, "{b}-%s"},
+		{"{{literal}} {a}", map[string]string{"a": "x"}, "{literal} x"},
+		//缺少变量时保留原样
+		{"file {filename} not found", nil, "file {filename} not found"},
+		//模板格式错误时原样返回
+		{"broken {name", map[string]string{"name": "x"}, "broken {name"},
+	}
+	for _, c := range cases {
+		if got := Render(c.tpl, c.params); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.tpl, got, c.want)
+		}
+	}
+	if _, err := Placeholders("a } b"); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	messages := map[string]string{
+		"zh": "文件{name}不存在",
+		"en": "file not found",
+		"fr": "a } b",
+		"de": "{bad name}",
+		"ja": "{name}{other}",
+	}
+	want := []string{
+		"File: duplicate placeholder name",
+		"File: message for de: invalid message template: invalid placeholder {bad name} in \"{bad name}\"",
+		"File: placeholder name is not used in message for en",
+		"File: message for fr: invalid message template: unexpected } at 2 in \"a } b\"",
+		"File: message for ja uses undeclared placeholder {other}",
+	}
+	if got := Check("File", messages, []string{"name", "name"}); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s", strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,216 @@
+package biz_err
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"myTest/demo_home/biz_err_demo/error/biz_err/internal/msg_template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+错误码注册表：
+1. 错误码定义在配置文件中（yaml或者json）：code、http状态码、各个语言的消息、消息中变量的名称，消息中的变量用{name}表示
+2. 默认加载和代码一起编译的errors.yaml，也可以通过Load加载其他配置文件替换；加载时校验，有问题时返回错误，不替换当前的注册表
+3. 按请求的Accept-Language选择消息，没有对应语言的消息时使用defaultLocale的消息
+*/
+
+//go:embed errors.yaml
+var defaultConfig []byte
+
+var ErrInvalidRegistry = errors.New("invalid error registry")
+
+// ErrInvalidTemplate 消息模板格式错误，模板的规则见internal/msg_template，加载注册表和gen生成代码时使用同一套解析和校验
+var ErrInvalidTemplate = msg_template.ErrInvalidTemplate
+
+// Definition 一个错误码的定义
+type Definition struct {
+	Code       string `yaml:"code" json:"code"`
+	HttpStatus int    `yaml:"httpStatus" json:"httpStatus"`
+	// 语言 -> 消息，消息中的变量用{name}表示
+	Messages map[string]string `yaml:"messages" json:"messages"`
+	// 变量名，BizWrap按顺序传入的变量按这里的顺序对应到名称
+	Placeholders []string `yaml:"placeholders" json:"placeholders"`
+}
+
+type Registry struct {
+	DefaultLocale string        `yaml:"defaultLocale" json:"defaultLocale"`
+	Errors        []*Definition `yaml:"errors" json:"errors"`
+	codes         map[string]*Definition
+}
+
+// ParseRegistry 解析并校验注册表，format为yaml或者json
+func ParseRegistry(data []byte, format string) (*Registry, error) {
+	r := new(Registry)
+	var err error
+	switch format {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, r)
+	case "json":
+		err = json.Unmarshal(data, r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidRegistry, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRegistry, err)
+	}
+	if err = r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Registry) validate() error {
+	problems := make([]string, 0)
+	if r.DefaultLocale == "" {
+		problems = append(problems, "defaultLocale is empty")
+	}
+	r.codes = make(map[string]*Definition)
+	for i, def := range r.Errors {
+		if def.Code == "" {
+			problems = append(problems, fmt.Sprintf("errors[%d]: code is empty", i))
+			continue
+		}
+		if _, ok := r.codes[def.Code]; ok {
+			problems = append(problems, fmt.Sprintf("%s: duplicate code", def.Code))
+			continue
+		}
+		r.codes[def.Code] = def
+		if def.HttpStatus < 100 || def.HttpStatus > 599 {
+			problems = append(problems, fmt.Sprintf("%s: invalid httpStatus %d", def.Code, def.HttpStatus))
+		}
+		if _, ok := def.Messages[r.DefaultLocale]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: missing message for default locale %s", def.Code, r.DefaultLocale))
+		}
+		//和gen生成代码时的校验一致
+		problems = append(problems, msg_template.Check(def.Code, def.Messages, def.Placeholders)...)
+	}
+	for _, code := range codes {
+		def, ok := r.codes[code]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: code is not defined", code))
+			continue
+		}
+		if strings.Join(def.Placeholders, ",") != strings.Join(codePlaceholders[code], ",") {
+			problems = append(problems, fmt.Sprintf("%s: placeholders %v do not match generated code %v", code, def.Placeholders, codePlaceholders[code]))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidRegistry, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Lookup 查询错误码的定义
+func (r *Registry) Lookup(code string) (*Definition, bool) {
+	def, ok := r.codes[code]
+	return def, ok
+}
+
+// Params 合并按名称传入的变量和按顺序传入的变量，按顺序传入的变量按Placeholders的顺序对应到名称
+func (def *Definition) Params(vars []string, params map[string]string) map[string]string {
+	merged := make(map[string]string, len(vars)+len(params))
+	for i, v := range vars {
+		if i < len(def.Placeholders) {
+			merged[def.Placeholders[i]] = v
+		}
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Message 按Accept-Language选择消息，依次匹配完整的语言（zh-CN）和主语言（zh），都没有时使用默认语言
+func (r *Registry) Message(def *Definition, acceptLanguage string) string {
+	for _, locale := range parseAcceptLanguage(acceptLanguage) {
+		if msg, ok := def.Messages[locale]; ok {
+			return msg
+		}
+		if i := strings.Index(locale, "-"); i > 0 {
+			if msg, ok := def.Messages[locale[:i]]; ok {
+				return msg
+			}
+		}
+	}
+	return def.Messages[r.DefaultLocale]
+}
+
+// parseAcceptLanguage 按权重从高到低返回语言，例如 zh-CN,zh;q=0.9,en;q=0.8
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	langs := make([]weighted, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := strings.TrimSpace(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+	locales := make([]string, 0, len(langs))
+	for _, l := range langs {
+		locales = append(locales, l.locale)
+	}
+	return locales
+}
+
+var (
+	mu       sync.RWMutex
+	registry *Registry
+)
+
+func init() {
+	r, err := ParseRegistry(defaultConfig, "yaml")
+	if err != nil {
+		panic(err)
+	}
+	registry = r
+}
+
+// Load 加载配置文件替换当前的注册表，按扩展名识别格式
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r, err := ParseRegistry(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return fmt.Errorf("load %s: %w", path, err)
+	}
+	mu.Lock()
+	registry = r
+	mu.Unlock()
+	return nil
+}
+
+// Current 当前使用的注册表
+func Current() *Registry {
+	mu.RLock()
+	defer mu.RUnlock()
+	return registry
+}
@@ -0,0 +1,64 @@
+package biz_err
+
+import (
+	"errors"
+	"myTest/demo_home/biz_err_demo/error/zerr"
+	"strings"
+	"testing"
+)
+
+func TestParseBizErrLocale(t *testing.T) {
+	err := zerr.BizWrap(errors.New(""), UsernameOrPasswordInValid, "")
+	cases := map[string]string{
+		"":                        "用户名或密码错误",
+		"en":                      "invalid username or password",
+		"en-US,en;q=0.9":          "invalid username or password",
+		"fr,zh-CN;q=0.9,en;q=0.8": "用户名或密码错误",
+		"zh;q=0.5,en":             "invalid username or password",
+	}
+	for acceptLanguage, want := range cases {
+		status, code, msg := ParseBizErr(err, acceptLanguage)
+		if status != 500 || code != UsernameOrPasswordInValid || !strings.HasPrefix(msg, want) {
+			t.Errorf("%q: got %d %s %s", acceptLanguage, status, code, msg)
+		}
+	}
+}
+
+func TestParseBizErrParams(t *testing.T) {
+	err := zerr.BizWrap(errors.New(""), ImageNotSupported, "", "a%s.gif")
+	if _, _, msg := ParseBizErr(err, "en"); msg != "image a%s.gif is not supported, " {
+		t.Fatalf("got %q", msg)
+	}
+	err = zerr.DefaultBizWrapParams(ImageNotSupported, map[string]string{"filename": "b.gif"})
+	if _, _, msg := ParseBizErr(err, "zh"); msg != "图片b.gif的格式不支持, " {
+		t.Fatalf("got %q", msg)
+	}
+}
+
+func TestParseRegistry(t *testing.T) {
+	config := `{
+		"defaultLocale": "zh",
+		"errors": [
+			{"code": "OsCreateFileError", "httpStatus": 500, "messages": {"zh": "创建文件{filename}失败"}, "placeholders": ["filename"]},
+			{"code": "OsCreateFileError", "httpStatus": 500, "messages": {"zh": "创建文件失败"}},
+			{"code": "ImageNotSupported", "httpStatus": 0, "messages": {"en": "image {filename} is not supported", "zh": "图片{格式不支持"}},
+			{"code": "Unused", "httpStatus": 400, "messages": {"zh": "错误"}, "placeholders": ["name"]}
+		]
+	}`
+	_, err := ParseRegistry([]byte(config), "json")
+	if !errors.Is(err, ErrInvalidRegistry) {
+		t.Fatalf("got %v", err)
+	}
+	for _, problem := range []string{
+		"OsCreateFileError: duplicate code",
+		"ImageNotSupported: invalid httpStatus 0",
+		"ImageNotSupported: message for en uses undeclared placeholder {filename}",
+		"ImageNotSupported: message for zh: invalid message template",
+		"Unused: placeholder name is not used in message for zh",
+		"UsernameOrPasswordInValid: code is not defined",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q not found in %v", problem, err)
+		}
+	}
+}
@@ -60,6 +60,9 @@ type withStack struct {
 
 func (w *withStack) Cause() error { return w.error }
 
+// Unwrap 支持标准库的errors.Is和errors.As
+func (w *withStack) Unwrap() error { return w.error }
+
 func (w *withStack) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v':
@@ -141,6 +144,10 @@ func (w *withMessage) Cause() error {
 	return w.cause
 }
 
+func (w *withMessage) Unwrap() error {
+	return w.cause
+}
+
 func (w *withMessage) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v':
@@ -194,12 +201,18 @@ type ErrWrap struct {
 	cause error
 	code  string
 	vars  []string
+	// 命名变量，对应消息中的{name}
+	params map[string]string
 }
 
 func (w *ErrWrap) Vars() []string {
 	return w.vars
 }
 
+func (w *ErrWrap) Params() map[string]string {
+	return w.params
+}
+
 func (w *ErrWrap) Code() string {
 	return w.code
 }
@@ -216,6 +229,16 @@ func (w *ErrWrap) Cause() error {
 	return w.cause
 }
 
+func (w *ErrWrap) Unwrap() error {
+	return w.cause
+}
+
+// Is 错误码相同的ErrWrap认为是同一个错误，可以通过errors.Is(err, zerr.CodeError(code))判断错误码
+func (w *ErrWrap) Is(target error) bool {
+	t, ok := target.(*ErrWrap)
+	return ok && t.code == w.code
+}
+
 // Format rewrite format
 func (w *ErrWrap) Format(s fmt.State, verb rune) {
 	switch verb {
@@ -266,3 +289,51 @@ func DefaultBizWrap(code string, vars ...string) error {
 		callers(),
 	}
 }
+
+// BizWrapParams 和BizWrap相同，变量按名称传入，例如 map[string]string{"username": "ziyi"}
+func BizWrapParams(err error, code string, message string, params map[string]string) error {
+	return bizWrapParams(1, err, code, message, params)
+}
+
+// BizWrapParamsSkip skip为记录调用位置时额外跳过的调用层数，封装BizWrapParams的函数传1，记录调用封装函数的位置
+func BizWrapParamsSkip(skip int, err error, code string, message string, params map[string]string) error {
+	return bizWrapParams(skip+1, err, code, message, params)
+}
+
+func bizWrapParams(skip int, err error, code string, message string, params map[string]string) error {
+	if err == nil {
+		return nil
+	}
+	codeErr := &ErrWrap{
+		cause:  err,
+		code:   code,
+		params: params,
+	}
+	err = &withMessage{
+		cause: codeErr,
+		msg:   message,
+	}
+	return &withStack{
+		err,
+		callersSkip(skip),
+	}
+}
+
+func DefaultBizWrapParams(code string, params map[string]string) error {
+	return bizWrapParams(1, errors.New(""), code, "", params)
+}
+
+// DefaultBizWrapParamsSkip skip的含义和BizWrapParamsSkip相同
+func DefaultBizWrapParamsSkip(skip int, code string, params map[string]string) error {
+	return bizWrapParams(skip+1, errors.New(""), code, "", params)
+}
+
+// CodeError 只有错误码的错误，用于和errors.Is一起判断错误码
+func CodeError(code string) error {
+	return &ErrWrap{code: code}
+}
+
+// IsCode err的错误链中是否有错误码为code的错误
+func IsCode(err error, code string) bool {
+	return Is(err, CodeError(code))
+}
@@ -0,0 +1,69 @@
+package zerr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStdErrorsInterop(t *testing.T) {
+	source := errors.New("source")
+	err := WithMessage(WithStack(BizWrap(source, "A", "")), "outer")
+	if !errors.Is(err, source) {
+		t.Fatal("errors.Is should find the source error")
+	}
+	errWrap := new(ErrWrap)
+	if !errors.As(err, &errWrap) || errWrap.Code() != "A" {
+		t.Fatalf("errors.As got %v", errWrap)
+	}
+	if !errors.Is(err, CodeError("A")) || !IsCode(err, "A") || IsCode(err, "B") {
+		t.Fatal("code matching failed")
+	}
+	wrapped := fmt.Errorf("handler: %w", err)
+	if !IsCode(wrapped, "A") || !Is(wrapped, source) {
+		t.Fatal("zerr.Is should walk fmt.Errorf wrappers")
+	}
+}
+
+func TestJoin(t *testing.T) {
+	if Join(nil, nil) != nil {
+		t.Fatal("Join of nil errors should be nil")
+	}
+	a, b := New("a"), BizWrap(New("b"), "B", "")
+	err := Join(a, nil, b)
+	if err.Error() != "a; : b" {
+		t.Fatalf("got %q", err.Error())
+	}
+	for _, target := range []error{a, b, CodeError("B")} {
+		if !errors.Is(err, target) || !Is(err, target) {
+			t.Fatalf("%v not found in joined error", target)
+		}
+	}
+	errWrap := new(ErrWrap)
+	if !As(err, &errWrap) || errWrap.Code() != "B" {
+		t.Fatalf("zerr.As got %v", errWrap)
+	}
+}
+
+func TestStack(t *testing.T) {
+	err := Join(New("a"), WithStack(errors.New("b")))
+	frames := Stack(err)
+	// Join、New、WithStack各记录一帧
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames: %v", len(frames), frames)
+	}
+	for _, f := range frames {
+		if !strings.HasSuffix(f.Function, "TestStack") || !strings.HasSuffix(f.File, "errors_test.go") || f.Line == 0 {
+			t.Fatalf("unexpected frame %+v", f)
+		}
+	}
+	data, err := json.Marshal(frames[0])
+	if err != nil || !strings.Contains(string(data), `"function":`) || !strings.Contains(string(data), `"line":`) {
+		t.Fatalf("got %s %v", data, err)
+	}
+	if Stack(errors.New("plain")) == nil {
+		t.Fatal("Stack should return an empty slice")
+	}
+}
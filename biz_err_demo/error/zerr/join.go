@@ -0,0 +1,68 @@
+package zerr
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Join 合并多个错误，忽略nil，全部为nil时返回nil；实现Unwrap() []error，errors.Is/As和zerr.Is/As会检查每个错误
+func Join(errs ...error) error {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	m := &multiError{
+		errs:  make([]error, 0, n),
+		stack: callers(),
+	}
+	for _, err := range errs {
+		if err != nil {
+			m.errs = append(m.errs, err)
+		}
+	}
+	return m
+}
+
+type multiError struct {
+	errs []error
+	*stack
+}
+
+func (m *multiError) Error() string {
+	msgs := make([]string, 0, len(m.errs))
+	for _, err := range m.errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m *multiError) Unwrap() []error {
+	return m.errs
+}
+
+func (m *multiError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			for i, err := range m.errs {
+				if i > 0 {
+					io.WriteString(s, "\n")
+				}
+				fmt.Fprintf(s, "%+v", err)
+			}
+			m.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, m.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", m.Error())
+	}
+}
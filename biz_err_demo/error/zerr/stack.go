@@ -1,6 +1,7 @@
 package zerr
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"path"
@@ -78,6 +79,58 @@ func (st StackTrace) Format(s fmt.State, verb rune) {
 	}
 }
 
+// FrameInfo 结构化的栈帧，可以直接序列化为json输出到日志
+type FrameInfo struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (f Frame) Info() FrameInfo {
+	fn := runtime.FuncForPC(f.pc())
+	if fn == nil {
+		return FrameInfo{Function: "unknown", File: "unknown"}
+	}
+	file, line := fn.FileLine(f.pc())
+	return FrameInfo{Function: fn.Name(), File: file, Line: line}
+}
+
+func (st StackTrace) Frames() []FrameInfo {
+	frames := make([]FrameInfo, 0, len(st))
+	for _, f := range st {
+		frames = append(frames, f.Info())
+	}
+	return frames
+}
+
+func (st StackTrace) MarshalJSON() ([]byte, error) {
+	return json.Marshal(st.Frames())
+}
+
+// Stack 按从外到内的顺序收集错误链中所有错误记录的栈帧，合并的错误按顺序展开，没有栈信息时返回空切片
+func Stack(err error) []FrameInfo {
+	frames := make([]FrameInfo, 0)
+	walk(err, func(e error) {
+		if st, ok := e.(interface{ StackTrace() StackTrace }); ok {
+			frames = append(frames, st.StackTrace().Frames()...)
+		}
+	})
+	return frames
+}
+
+func walk(err error, fn func(error)) {
+	for err != nil {
+		fn(err)
+		if m, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range m.Unwrap() {
+				walk(e, fn)
+			}
+			return
+		}
+		err = Unwrap(err)
+	}
+}
+
 type stack []uintptr
 
 func (s *stack) Format(st fmt.State, verb rune) {
@@ -102,9 +155,14 @@ func (s *stack) StackTrace() StackTrace {
 }
 
 func callers() *stack {
+	return callersSkip(1)
+}
+
+// callersSkip skip为0时记录调用callersSkip的函数的调用方，skip为额外跳过的调用层数
+func callersSkip(skip int) *stack {
 	const depth = 32
 	var pcs [depth]uintptr
-	n := runtime.Callers(3, pcs[:])
+	n := runtime.Callers(3+skip, pcs[:])
 	if n > 1 {
 		n = 1
 	}
@@ -28,6 +28,14 @@ func Is(err, target error) bool {
 		if x, ok := err.(interface{ Is(error) bool }); ok && x.Is(target) {
 			return true
 		}
+		if m, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range m.Unwrap() {
+				if Is(e, target) {
+					return true
+				}
+			}
+			return false
+		}
 		if err = Unwrap(err); err == nil {
 			return false
 		}
@@ -55,6 +63,14 @@ func As(err error, target interface{}) bool {
 		if x, ok := err.(interface{ As(interface{}) bool }); ok && x.As(target) {
 			return true
 		}
+		if m, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range m.Unwrap() {
+				if e != nil && As(e, target) {
+					return true
+				}
+			}
+			return false
+		}
 		err = Unwrap(err)
 	}
 	return false
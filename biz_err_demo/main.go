@@ -1,12 +1,23 @@
 package main
 
 import (
+	"flag"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/mvc"
+	"github.com/sirupsen/logrus"
 	"myTest/demo_home/biz_err_demo/controller"
+	"myTest/demo_home/biz_err_demo/error/biz_err"
 )
 
+var errorsConfig = flag.String("errors", "", "error code config file (yaml or json), use the embedded errors.yaml if empty")
+
 func main() {
+	flag.Parse()
+	if *errorsConfig != "" {
+		if err := biz_err.Load(*errorsConfig); err != nil {
+			logrus.Fatalf("%v", err)
+		}
+	}
 	app := iris.New()
 	mvc.New(app).Handle(new(controller.TestBizController))
 	app.Listen(":8088", nil)
@@ -16,8 +16,9 @@ type JsonResponse struct {
 	Content interface{} `json:"content,omitempty"`
 }
 
-func JsonBizError(err error) mvc.Response {
-	httpStatus, code, msg := biz_err.ErrResponse(err)
+// JsonBizError acceptLanguage为请求头Accept-Language，用于选择错误消息的语言
+func JsonBizError(err error, acceptLanguage string) mvc.Response {
+	httpStatus, code, msg := biz_err.ErrResponse(err, acceptLanguage)
 	return commonResp(msg, httpStatus, Code(code), nil)
 }
 
@@ -15,6 +15,7 @@ func main() {
 	TestWithNoSourceErr()
 	TestWithSourceErr()
 	TestParseBizErr()
+	TestStdErrors()
 }
 
 func TestWithNoSourceErr() {
@@ -24,13 +25,23 @@ func TestWithNoSourceErr() {
 
 func TestWithSourceErr() {
 	err := errors.New("invalid image")
-	err = zerr.BizWrap(err, biz_err.ImageNotSupported, "")
+	err = biz_err.WrapImageNotSupported(err, "a.gif")
 	logrus.Errorf("TestWithSourceErr %+v", err)
 }
 
 func TestParseBizErr() {
 	err := errors.New("")
-	err = zerr.BizWrap(err, biz_err.ImageNotSupported, "")
-	httpStatus, bizCode, msg := biz_err.ParseBizErr(err)
+	err = zerr.BizWrapParams(err, biz_err.ImageNotSupported, "", map[string]string{"filename": "a.gif"})
+	httpStatus, bizCode, msg := biz_err.ParseBizErr(err, "")
 	logrus.Errorf("httpStatus:%d bizCode:%s msg:%s", httpStatus, bizCode, msg)
+	httpStatus, bizCode, msg = biz_err.ParseBizErr(err, "en-US,en;q=0.9,zh;q=0.8")
+	logrus.Errorf("httpStatus:%d bizCode:%s msg:%s", httpStatus, bizCode, msg)
+}
+
+// TestStdErrors 标准库errors.Is/As可以穿过zerr的包装，结构化的栈信息作为日志字段输出
+func TestStdErrors() {
+	sourceErr := errors.New("invalid image")
+	err := zerr.Join(biz_err.WrapImageNotSupported(sourceErr, "a.gif"), biz_err.NewUsernameOrPasswordInValid())
+	logrus.WithField("stack", zerr.Stack(err)).Errorf("TestStdErrors is source:%v is code:%v err:%v",
+		errors.Is(err, sourceErr), errors.Is(err, zerr.CodeError(biz_err.UsernameOrPasswordInValid)), err)
 }
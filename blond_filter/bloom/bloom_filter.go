@@ -0,0 +1,132 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"myTest/demo_home/redis_demo/redis_store"
+)
+
+/*
+布隆过滤器，所有数据共用一个redis bitmap：
+1. 根据预计的数据量n和误判率p计算bitmap的位数m = -n*ln(p)/(ln2)^2，hash函数的个数k = m/n*ln2
+2. 双重hash：用fnv的两个hash值h1、h2模拟k个独立的hash函数，第i个hash值为 h1 + i*h2
+3. 写入和查询都在一个lua脚本里完成，k个bit要么都写入，查询时任意一个bit为0说明数据一定不存在
+*/
+
+// redis的bitmap最多2^32位
+const maxBits = 1 << 32
+
+var ErrInvalidParam = errors.New("bloom filter capacity must be greater than 0 and fp rate must be in (0, 1)")
+
+type BloomFilter struct {
+	key string
+	// bitmap的位数
+	bits uint64
+	// hash函数的个数
+	hashes   int
+	redisCli redis_store.Client
+}
+
+// NewBloomFilter capacity: 预计写入的数据量, fpRate: 期望的误判率
+func NewBloomFilter(cli redis_store.Client, key string, capacity int64, fpRate float64) (*BloomFilter, error) {
+	bits, hashes, err := Estimate(capacity, fpRate)
+	if err != nil {
+		return nil, err
+	}
+	return &BloomFilter{
+		key:      key,
+		bits:     bits,
+		hashes:   hashes,
+		redisCli: cli,
+	}, nil
+}
+
+// Estimate 根据数据量和误判率计算bitmap的位数和hash函数的个数
+func Estimate(capacity int64, fpRate float64) (uint64, int, error) {
+	if capacity <= 0 || fpRate <= 0 || fpRate >= 1 {
+		return 0, 0, ErrInvalidParam
+	}
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if m > maxBits {
+		m = maxBits
+	}
+	k := int(math.Round(m / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return uint64(m), k, nil
+}
+
+func (f *BloomFilter) Key() string {
+	return f.key
+}
+
+func (f *BloomFilter) Bits() uint64 {
+	return f.bits
+}
+
+func (f *BloomFilter) Hashes() int {
+	return f.hashes
+}
+
+func (f *BloomFilter) offsets(item string) []interface{} {
+	return offsets(item, f.bits, f.hashes)
+}
+
+// offsets 计算数据在bits位的bitmap中对应的k个位置
+func offsets(item string, bits uint64, hashes int) []interface{} {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	h1 := h.Sum64()
+	h = fnv.New64()
+	h.Write([]byte(item))
+	//h2为奇数，避免和位数有公因数时k个位置重复
+	h2 := h.Sum64() | 1
+	result := make([]interface{}, 0, hashes)
+	for i := 0; i < hashes; i++ {
+		result = append(result, int64((h1+uint64(i)*h2)%bits))
+	}
+	return result
+}
+
+// 把ARGV中的所有位置设置为1
+var addCmd = "for i = 1, #ARGV do " +
+	"   redis.call('setbit', KEYS[1], ARGV[i], 1) " +
+	"end " +
+	"return #ARGV"
+
+// ARGV中任意一个位置为0就说明数据不存在
+var existsCmd = "for i = 1, #ARGV do " +
+	"   if redis.call('getbit', KEYS[1], ARGV[i]) == 0 then " +
+	"       return 0 " +
+	"   end " +
+	"end " +
+	"return 1"
+
+func (f *BloomFilter) Add(ctx context.Context, item string) error {
+	return f.AddBatch(ctx, []string{item})
+}
+
+// AddBatch 批量写入，所有数据的位置在一个lua脚本里写入，减少和redis的交互
+func (f *BloomFilter) AddBatch(ctx context.Context, items []string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(items)*f.hashes)
+	for _, item := range items {
+		args = append(args, f.offsets(item)...)
+	}
+	_, err := f.redisCli.Eval(ctx, addCmd, []string{f.key}, args...)
+	return err
+}
+
+// Exists 返回false时数据一定不存在，返回true时数据可能存在
+func (f *BloomFilter) Exists(ctx context.Context, item string) (bool, error) {
+	result, err := f.redisCli.Eval(ctx, existsCmd, []string{f.key}, f.offsets(item)...)
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
@@ -0,0 +1,149 @@
+package bloom
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"strconv"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	bits, hashes, err := Estimate(1000000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//1%的误判率每个数据大约需要9.6位、7个hash函数
+	if bits != 9585059 || hashes != 7 {
+		t.Fatalf("got bits %d hashes %d", bits, hashes)
+	}
+	if _, _, err = Estimate(0, 0.01); err != ErrInvalidParam {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// 写入的数据一定存在，没写入的数据误判率接近设置的误判率
+func TestBloomFilter(t *testing.T) {
+	ctx := context.TODO()
+	n := 2000
+	f, err := NewBloomFilter(redis_store.NewMemory(), "bloom", int64(n), 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, strconv.Itoa(i))
+	}
+	if err = f.AddBatch(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if ok, err := f.Exists(ctx, item); err != nil || !ok {
+			t.Fatalf("%s should exist, err %v", item, err)
+		}
+	}
+	fp := 0
+	for i := n; i < n*6; i++ {
+		if ok, _ := f.Exists(ctx, strconv.Itoa(i)); ok {
+			fp++
+		}
+	}
+	if rate := float64(fp) / float64(n*5); rate > 0.02 {
+		t.Fatalf("false positive rate %v", rate)
+	}
+}
+
+// 写入的数据远超第一层的容量时自动扩容，误判率不超过设置的误判率
+func TestScalableBloomFilter(t *testing.T) {
+	ctx := context.TODO()
+	f, err := NewScalableBloomFilter(redis_store.NewMemory(), "scalable", 100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 800
+	for i := 0; i < n; i++ {
+		if err = f.Add(ctx, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if layers, _ := f.layers(ctx, 0); layers < 4 {
+		t.Fatalf("got %d layers", layers)
+	}
+	for i := 0; i < n; i++ {
+		if ok, err := f.Exists(ctx, strconv.Itoa(i)); err != nil || !ok {
+			t.Fatalf("%d should exist, err %v", i, err)
+		}
+	}
+	fp := 0
+	for i := n; i < n*4; i++ {
+		if ok, _ := f.Exists(ctx, strconv.Itoa(i)); ok {
+			fp++
+		}
+	}
+	if rate := float64(fp) / float64(n*3); rate > 0.02 {
+		t.Fatalf("false positive rate %v", rate)
+	}
+}
+
+// 重建后只保留数据源中的数据，重建期间写入的数据不会丢失
+func TestScalableBloomFilterRebuild(t *testing.T) {
+	ctx := context.TODO()
+	cli := redis_store.NewMemory()
+	f, _ := NewScalableBloomFilter(cli, "scalable", 100, 0.001)
+	for i := 0; i < 200; i++ {
+		f.Add(ctx, strconv.Itoa(i))
+	}
+	err := f.Rebuild(ctx, func(ctx context.Context, add func(items []string) error) error {
+		if err := f.Rebuild(ctx, nil); err != ErrRebuilding {
+			t.Fatalf("got %v", err)
+		}
+		for i := 0; i < 100; i += 10 {
+			items := make([]string, 0, 10)
+			for j := i; j < i+10; j++ {
+				items = append(items, strconv.Itoa(j))
+			}
+			if err := add(items); err != nil {
+				return err
+			}
+		}
+		return f.Add(ctx, "new")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []string{"0", "99", "new"} {
+		if ok, _ := f.Exists(ctx, item); !ok {
+			t.Fatalf("%s should exist", item)
+		}
+	}
+	missing := 0
+	for i := 100; i < 200; i++ {
+		if ok, _ := f.Exists(ctx, strconv.Itoa(i)); !ok {
+			missing++
+		}
+	}
+	if missing < 95 {
+		t.Fatalf("only %d removed items are missing", missing)
+	}
+	if exists, _ := cli.Exists(ctx, "scalable:building"); exists != 0 {
+		t.Fatal("building key should be deleted")
+	}
+}
+
+func TestCountingBloomFilter(t *testing.T) {
+	ctx := context.TODO()
+	f, _ := NewCountingBloomFilter(redis_store.NewMemory(), "counting", 1000, 0.01)
+	f.Add(ctx, "a")
+	f.Add(ctx, "b")
+	if ok, _ := f.Remove(ctx, "a"); !ok {
+		t.Fatal("remove a failed")
+	}
+	if ok, _ := f.Exists(ctx, "a"); ok {
+		t.Fatal("a should be removed")
+	}
+	if ok, _ := f.Exists(ctx, "b"); !ok {
+		t.Fatal("b should exist")
+	}
+	if ok, _ := f.Remove(ctx, "a"); ok {
+		t.Fatal("remove a twice")
+	}
+}
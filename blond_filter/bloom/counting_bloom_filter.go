@@ -0,0 +1,82 @@
+package bloom
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+)
+
+/*
+计数布隆过滤器，支持删除：
+1. 每个位置不再是1个bit，而是一个计数器，存储在redis hash中，field为位置，value为计数
+2. 写入时k个计数器加1，删除时k个计数器减1，减到0时删除field
+3. 只能删除写入过的数据，删除没写入过的数据（误判的数据）会把其他数据的计数器减掉，导致其他数据查询不到
+*/
+
+type CountingBloomFilter struct {
+	key      string
+	bits     uint64
+	hashes   int
+	redisCli redis_store.Client
+}
+
+func NewCountingBloomFilter(cli redis_store.Client, key string, capacity int64, fpRate float64) (*CountingBloomFilter, error) {
+	bits, hashes, err := Estimate(capacity, fpRate)
+	if err != nil {
+		return nil, err
+	}
+	return &CountingBloomFilter{
+		key:      key,
+		bits:     bits,
+		hashes:   hashes,
+		redisCli: cli,
+	}, nil
+}
+
+var countingAddCmd = "for i = 1, #ARGV do " +
+	"   redis.call('hincrby', KEYS[1], ARGV[i], 1) " +
+	"end " +
+	"return #ARGV"
+
+// 先检查所有计数器都大于0，再全部减1，避免删除不存在的数据时只减掉了一部分计数器
+var countingRemoveCmd = "for i = 1, #ARGV do " +
+	"   local count = tonumber(redis.call('hget', KEYS[1], ARGV[i]) or '0') " +
+	"   if count <= 0 then " +
+	"       return 0 " +
+	"   end " +
+	"end " +
+	"for i = 1, #ARGV do " +
+	"   if redis.call('hincrby', KEYS[1], ARGV[i], -1) <= 0 then " +
+	"       redis.call('hdel', KEYS[1], ARGV[i]) " +
+	"   end " +
+	"end " +
+	"return 1"
+
+var countingExistsCmd = "for i = 1, #ARGV do " +
+	"   local count = tonumber(redis.call('hget', KEYS[1], ARGV[i]) or '0') " +
+	"   if count <= 0 then " +
+	"       return 0 " +
+	"   end " +
+	"end " +
+	"return 1"
+
+func (f *CountingBloomFilter) Add(ctx context.Context, item string) error {
+	_, err := f.redisCli.Eval(ctx, countingAddCmd, []string{f.key}, offsets(item, f.bits, f.hashes)...)
+	return err
+}
+
+// Remove 删除数据，数据不存在时返回false
+func (f *CountingBloomFilter) Remove(ctx context.Context, item string) (bool, error) {
+	result, err := f.redisCli.Eval(ctx, countingRemoveCmd, []string{f.key}, offsets(item, f.bits, f.hashes)...)
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+func (f *CountingBloomFilter) Exists(ctx context.Context, item string) (bool, error) {
+	result, err := f.redisCli.Eval(ctx, countingExistsCmd, []string{f.key}, offsets(item, f.bits, f.hashes)...)
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
@@ -0,0 +1,306 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"myTest/demo_home/redis_demo/redis_store"
+	"strconv"
+	"time"
+)
+
+/*
+可扩容的布隆过滤器，数据量超过设计容量后误判率不会失控：
+1. 由多层布隆过滤器组成，只往最后一层写入，最后一层写满后新建一层，新的一层容量为上一层的growth倍，误判率为上一层的tightening倍
+2. 查询时任意一层存在就认为存在，总的误判率不超过 第一层误判率/(1-tightening)，所以第一层的误判率为 fpRate*(1-tightening)
+3. 每一代的数据：key:{gen}:meta 记录层数和最后一层已写入的数量，key:{gen}:{i} 为第i层的bitmap
+4. 在线重建：key记录当前生效的代，重建时在新的一代写入全量数据，key:building记录正在重建的代，
+   重建期间新写入的数据同时写入两代，重建完成后在lua脚本中切换key，旧的一代延迟删除
+*/
+
+var ErrRebuilding = errors.New("bloom filter is rebuilding")
+
+type ScalableBloomFilter struct {
+	key         string
+	buildingKey string
+	// 第一层的容量
+	capacity int64
+	// 期望的总误判率
+	fpRate float64
+	// 每一层的容量是上一层的growth倍
+	growth int64
+	// 每一层的误判率是上一层的tightening倍
+	tightening float64
+	// 重建的最长时间，超过后重建标记过期，可以重新开始重建
+	rebuildTimeout time.Duration
+	// 切换后旧的一代保留的时间，切换前读到旧的一代的请求还能继续查询
+	dropDelay time.Duration
+	redisCli  redis_store.Client
+}
+
+func NewScalableBloomFilter(cli redis_store.Client, key string, capacity int64, fpRate float64) (*ScalableBloomFilter, error) {
+	if _, _, err := Estimate(capacity, fpRate); err != nil {
+		return nil, err
+	}
+	return &ScalableBloomFilter{
+		key:            key,
+		buildingKey:    key + ":building",
+		capacity:       capacity,
+		fpRate:         fpRate,
+		growth:         2,
+		tightening:     0.5,
+		rebuildTimeout: time.Hour,
+		dropDelay:      time.Minute,
+		redisCli:       cli,
+	}, nil
+}
+
+func (f *ScalableBloomFilter) SetGrowth(growth int64) {
+	f.growth = growth
+}
+
+func (f *ScalableBloomFilter) SetTightening(tightening float64) {
+	f.tightening = tightening
+}
+
+func (f *ScalableBloomFilter) SetRebuildTimeout(d time.Duration) {
+	f.rebuildTimeout = d
+}
+
+func (f *ScalableBloomFilter) metaKey(gen int64) string {
+	return fmt.Sprintf("%s:%d:meta", f.key, gen)
+}
+
+func (f *ScalableBloomFilter) layerPrefix(gen int64) string {
+	return fmt.Sprintf("%s:%d:", f.key, gen)
+}
+
+func (f *ScalableBloomFilter) layerCapacity(i int) int64 {
+	capacity := float64(f.capacity) * math.Pow(float64(f.growth), float64(i))
+	if capacity > maxBits {
+		capacity = maxBits
+	}
+	return int64(capacity)
+}
+
+// layer 第i层的布隆过滤器，容量和误判率由层数决定
+func (f *ScalableBloomFilter) layer(gen int64, i int) (*BloomFilter, error) {
+	fpRate := f.fpRate * (1 - f.tightening) * math.Pow(f.tightening, float64(i))
+	return NewBloomFilter(f.redisCli, f.layerPrefix(gen)+strconv.Itoa(i), f.layerCapacity(i), fpRate)
+}
+
+// 返回{当前生效的代, 正在重建的代}，没有重建时为-1
+var genCmd = "local cur = redis.call('get', KEYS[1]) or '0' " +
+	"local building = redis.call('get', KEYS[2]) or '-1' " +
+	"return {tonumber(cur), tonumber(building)}"
+
+func (f *ScalableBloomFilter) gens(ctx context.Context) (int64, int64, error) {
+	result, err := f.redisCli.Eval(ctx, genCmd, []string{f.key, f.buildingKey})
+	if err != nil {
+		return 0, 0, err
+	}
+	reply := result.([]interface{})
+	return reply[0].(int64), reply[1].(int64), nil
+}
+
+func (f *ScalableBloomFilter) layers(ctx context.Context, gen int64) (int, error) {
+	result, err := f.redisCli.HGet(ctx, f.metaKey(gen), "layers")
+	if err == redis_store.Nil {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(result)
+}
+
+// 往最后一层写入数据，写满后新建一层
+// ARGV: 写入时的层数, 最后一层的容量, hash函数的个数, 每个数据的k个位置...
+// 返回写入的数据个数，层数已经变化时返回-1，需要重新计算位置
+var layerAddCmd = "local n = tonumber(redis.call('hget', KEYS[1], 'layers') or '1') " +
+	"if n ~= tonumber(ARGV[1]) then " +
+	"   return -1 " +
+	"end " +
+	"local capacity, k = tonumber(ARGV[2]), tonumber(ARGV[3]) " +
+	"local count = tonumber(redis.call('hget', KEYS[1], 'count') or '0') " +
+	"local added = 0 " +
+	"for i = 4, #ARGV, k do " +
+	"   for j = i, i + k - 1 do " +
+	"       redis.call('setbit', KEYS[2], ARGV[j], 1) " +
+	"   end " +
+	"   added = added + 1 " +
+	"   count = count + 1 " +
+	"   if count >= capacity then " +
+	"       redis.call('hset', KEYS[1], 'layers', n + 1) " +
+	"       count = 0 " +
+	"       break " +
+	"   end " +
+	"end " +
+	"redis.call('hset', KEYS[1], 'count', count) " +
+	"return added"
+
+func (f *ScalableBloomFilter) Add(ctx context.Context, item string) error {
+	return f.add(ctx, []string{item}, true)
+}
+
+// AddBatch 批量写入，不检查数据是否已经存在，重复写入会占用容量
+func (f *ScalableBloomFilter) AddBatch(ctx context.Context, items []string) error {
+	return f.add(ctx, items, false)
+}
+
+// add 写入当前生效的代，正在重建时同时写入重建的代
+func (f *ScalableBloomFilter) add(ctx context.Context, items []string, dedup bool) error {
+	cur, building, err := f.gens(ctx)
+	if err != nil {
+		return err
+	}
+	if err = f.addTo(ctx, cur, items, dedup); err != nil {
+		return err
+	}
+	if building >= 0 {
+		return f.addTo(ctx, building, items, dedup)
+	}
+	return nil
+}
+
+func (f *ScalableBloomFilter) addTo(ctx context.Context, gen int64, items []string, dedup bool) error {
+	if dedup {
+		//已经存在的数据不再写入，避免重复数据占用容量
+		remain := make([]string, 0, len(items))
+		for _, item := range items {
+			exists, err := f.existsIn(ctx, gen, item)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				remain = append(remain, item)
+			}
+		}
+		items = remain
+	}
+	for len(items) > 0 {
+		n, err := f.layers(ctx, gen)
+		if err != nil {
+			return err
+		}
+		last, err := f.layer(gen, n-1)
+		if err != nil {
+			return err
+		}
+		args := []interface{}{n, f.layerCapacity(n - 1), last.hashes}
+		for _, item := range items {
+			args = append(args, last.offsets(item)...)
+		}
+		result, err := f.redisCli.Eval(ctx, layerAddCmd, []string{f.metaKey(gen), last.key}, args...)
+		if err != nil {
+			return err
+		}
+		if added := result.(int64); added > 0 {
+			items = items[added:]
+		}
+	}
+	return nil
+}
+
+// Exists 查询当前生效的代，任意一层存在就认为存在
+func (f *ScalableBloomFilter) Exists(ctx context.Context, item string) (bool, error) {
+	cur, _, err := f.gens(ctx)
+	if err != nil {
+		return false, err
+	}
+	return f.existsIn(ctx, cur, item)
+}
+
+func (f *ScalableBloomFilter) existsIn(ctx context.Context, gen int64, item string) (bool, error) {
+	n, err := f.layers(ctx, gen)
+	if err != nil {
+		return false, err
+	}
+	//数据大多写在后面的层，从最后一层开始查
+	for i := n - 1; i >= 0; i-- {
+		l, err := f.layer(gen, i)
+		if err != nil {
+			return false, err
+		}
+		exists, err := l.Exists(ctx, item)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// 删除一代的所有数据，ARGV: bitmap key的前缀, 延迟删除的时间(ms)，为0时立即删除
+var dropGenCmd = "local n = tonumber(redis.call('hget', KEYS[1], 'layers') or '1') " +
+	"local delay = tonumber(ARGV[2]) " +
+	"for i = 0, n - 1 do " +
+	"   if delay > 0 then " +
+	"       redis.call('pexpire', ARGV[1] .. i, delay) " +
+	"   else " +
+	"       redis.call('del', ARGV[1] .. i) " +
+	"   end " +
+	"end " +
+	"if delay > 0 then " +
+	"   redis.call('pexpire', KEYS[1], delay) " +
+	"else " +
+	"   redis.call('del', KEYS[1]) " +
+	"end " +
+	"return n"
+
+func (f *ScalableBloomFilter) dropGen(ctx context.Context, gen int64, delay time.Duration) error {
+	_, err := f.redisCli.Eval(ctx, dropGenCmd, []string{f.metaKey(gen)}, f.layerPrefix(gen), delay.Milliseconds())
+	return err
+}
+
+// 重建完成后切换生效的代，重建标记已经过期或者被其他重建覆盖时不切换
+var swapGenCmd = "if redis.call('get', KEYS[2]) ~= ARGV[1] then " +
+	"   return 0 " +
+	"end " +
+	"redis.call('set', KEYS[1], ARGV[1]) " +
+	"redis.call('del', KEYS[2]) " +
+	"return 1"
+
+// Loader 遍历全量数据，每一批数据调用一次add
+type Loader func(ctx context.Context, add func(items []string) error) error
+
+// Rebuild 从数据源全量重建：写入新的一代，完成后原子切换，重建期间不影响查询和写入
+// 同一时间只能有一个重建，其他重建返回ErrRebuilding
+func (f *ScalableBloomFilter) Rebuild(ctx context.Context, loader Loader) error {
+	cur, _, err := f.gens(ctx)
+	if err != nil {
+		return err
+	}
+	next := cur + 1
+	ok, err := f.redisCli.SetNX(ctx, f.buildingKey, next, f.rebuildTimeout)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRebuilding
+	}
+	//清理上次重建失败留下的数据
+	if err = f.dropGen(ctx, next, 0); err != nil {
+		return err
+	}
+	err = loader(ctx, func(items []string) error {
+		return f.addTo(ctx, next, items, false)
+	})
+	if err == nil {
+		var swapped interface{}
+		swapped, err = f.redisCli.Eval(ctx, swapGenCmd, []string{f.key, f.buildingKey}, next)
+		if err == nil && swapped.(int64) == 0 {
+			err = ErrRebuilding
+		}
+	}
+	if err == ErrRebuilding {
+		//重建标记已经过期，由新的重建负责清理
+		return err
+	}
+	if err != nil {
+		f.redisCli.Del(ctx, f.buildingKey)
+		f.dropGen(ctx, next, 0)
+		return err
+	}
+	return f.dropGen(ctx, cur, f.dropDelay)
+}
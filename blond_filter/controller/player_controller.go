@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/mvc"
+	"myTest/demo_home/blond_filter/model"
 	"myTest/demo_home/blond_filter/service"
 	"net/http"
 	"strconv"
@@ -15,6 +16,7 @@ type PlayerController struct {
 
 func (p *PlayerController) BeforeActivation(b mvc.BeforeActivation) {
 	b.Handle("GET", "/find/{id}", "FindById")
+	b.Handle("POST", "/create", "Create")
 }
 
 func (p *PlayerController) FindById() mvc.Result {
@@ -50,3 +52,27 @@ func (p *PlayerController) FindById() mvc.Result {
 		ContentType: "application/json",
 	}
 }
+
+func (p *PlayerController) Create() mvc.Result {
+	defer p.Ctx.Next()
+	player := new(model.Player)
+	err := p.Ctx.ReadJSON(player)
+	if err != nil {
+		return mvc.Response{
+			Code:        http.StatusBadRequest,
+			Content:     []byte(err.Error()),
+			ContentType: "application/json",
+		}
+	}
+	err = service.PlayerService.Create(player)
+	if err != nil {
+		return mvc.Response{
+			Code:        http.StatusInternalServerError,
+			Content:     []byte(err.Error()),
+			ContentType: "application/json",
+		}
+	}
+	return mvc.Response{
+		Code: http.StatusOK,
+	}
+}
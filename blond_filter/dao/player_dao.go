@@ -22,9 +22,21 @@ func (p *playerDao) GetById(id int64) (*model.Player, error) {
 	get, err := pg.Engine.Where("id=?", id).Get(player)
 	if err != nil {
 		log.Errorf("%v", err)
+		return nil, err
 	}
 	if !get {
 		return nil, nil
 	}
 	return player, nil
 }
+
+// FindIds 按id升序查询大于afterId的玩家id，用于分批遍历所有玩家
+func (p *playerDao) FindIds(afterId int64, limit int) ([]int64, error) {
+	ids := make([]int64, 0, limit)
+	err := pg.Engine.Table(new(model.Player)).Cols("id").Where("id>?", afterId).Asc("id").Limit(limit).Find(&ids)
+	if err != nil {
+		log.Errorf("%v", err)
+		return nil, err
+	}
+	return ids, nil
+}
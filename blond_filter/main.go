@@ -5,6 +5,7 @@ import (
 	"github.com/kataras/iris/v12/mvc"
 	"myTest/demo_home/blond_filter/controller"
 	"myTest/demo_home/blond_filter/util"
+	"time"
 )
 
 func main() {
@@ -13,5 +14,6 @@ func main() {
 	pMvc := mvc.New(app.Party("player"))
 	pMvc.Handle(new(controller.PlayerController))
 	util.InitBlondFilter()
+	go util.StartRebuildBlondFilter(time.Hour * 24)
 	app.Listen(":9999", nil)
 }
@@ -1,16 +1,19 @@
 package redis
 
-import "github.com/go-redis/redis"
+import (
+	"github.com/go-redis/redis"
+	"myTest/demo_home/redis_demo/redis_store"
+)
 
 var (
-	Client       *redis.Client
+	Client       redis_store.Client
 	PlayerPrefix = "player:"
 )
 
 func init() {
-	Client = redis.NewClient(&redis.Options{
+	Client = redis_store.NewV6(redis.NewClient(&redis.Options{
 		Addr:     "127.0.0.1:6379",
 		Password: "", // no password set
 		DB:       0,  // use default DB
-	})
+	}))
 }
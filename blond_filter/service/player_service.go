@@ -19,26 +19,32 @@ func (s *playerService) FindById(id int64) (*model.Player, error) {
 		return nil, nil
 	}
 
-	//query redis
+	//query redis, load from db and cache the result when missing
 	player, err := util.PlayerCache.GetById(id)
 	if err != nil {
+		log.Errorf("%v", err)
 		return nil, err
 	}
-	if player != nil {
-		return player, nil
+	return player, nil
+}
+
+func (s *playerService) Create(player *model.Player) error {
+	_, err := dao.PlayerDao.InsertOne(*player)
+	if err != nil {
+		log.Errorf("%v", err)
+		return err
 	}
-	//query db and cache result
-	p, err := dao.PlayerDao.GetById(id)
+	//加入布隆过滤器，否则查询新玩家时会被过滤掉
+	err = util.AddToBlondFilter(player.Id)
 	if err != nil {
 		log.Errorf("%v", err)
-		return nil, err
+		return err
 	}
-	if p != nil {
-		err = util.PlayerCache.Put(p)
-		if err != nil {
-			log.Errorf("%v", err)
-		}
-		return p, nil
+	//删除之前查询时写入的空值缓存，否则在空值过期之前查询不到新玩家
+	err = util.PlayerCache.Del(player.Id)
+	if err != nil {
+		log.Errorf("%v", err)
+		return err
 	}
-	return p, nil
+	return nil
 }
@@ -1,46 +1,94 @@
 package util
 
 import (
-	"fmt"
+	"context"
 	"github.com/ziyifast/log"
-	"math"
+	"myTest/demo_home/blond_filter/bloom"
+	"myTest/demo_home/blond_filter/dao"
 	"myTest/demo_home/blond_filter/redis"
+	"strconv"
+	"time"
 )
 
-var base = 1 << 32
+const (
+	// 预计的玩家数量和误判率，决定bitmap的大小和hash函数的个数
+	playerCapacity = 1000000
+	playerFpRate   = 0.01
+	// 预加载时每次从数据库查询的玩家数量
+	preloadBatch = 1000
+)
+
+var PlayerFilter *bloom.ScalableBloomFilter
+
+func init() {
+	//玩家数量超过预计数量后自动扩容，误判率不会失控
+	f, err := bloom.NewScalableBloomFilter(redis.Client, redis.PlayerPrefix+"bloom", playerCapacity, playerFpRate)
+	if err != nil {
+		panic(err)
+	}
+	PlayerFilter = f
+}
 
 // achieve blond filter
-// 1. calculate the hash of key
-// 2. preload the players data
+// 1. all players share the bitmaps, every player sets k bits
+// 2. preload the players data from db in batches
 func InitBlondFilter() {
-	//get hashCode
-	key := fmt.Sprintf("%s%d", redis.PlayerPrefix, 1)
-	hashCode := int(math.Abs(float64(getHashCode(key))))
-	//calculate the offset
-	offset := hashCode % base
-	_, err := redis.Client.SetBit(key, int64(offset), 1).Result()
-	if err != nil {
+	if err := RebuildBlondFilter(); err != nil && err != bloom.ErrRebuilding {
 		panic(err)
 	}
 }
 
-func getHashCode(str string) int {
-	var hash int32 = 17
-	for i := 0; i < len(str); i++ {
-		hash = hash*31 + int32(str[i])
+// RebuildBlondFilter 从数据库全量重建布隆过滤器，清理已经删除的玩家，重建完成前继续使用旧的数据
+func RebuildBlondFilter() error {
+	var total int
+	err := PlayerFilter.Rebuild(context.TODO(), func(ctx context.Context, add func(items []string) error) error {
+		var lastId int64
+		for {
+			ids, err := dao.PlayerDao.FindIds(lastId, preloadBatch)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			items := make([]string, 0, len(ids))
+			for _, id := range ids {
+				items = append(items, strconv.FormatInt(id, 10))
+			}
+			if err = add(items); err != nil {
+				return err
+			}
+			total += len(ids)
+			lastId = ids[len(ids)-1]
+		}
+	})
+	if err != nil {
+		log.Errorf("rebuild blond filter err %v", err)
+		return err
 	}
-	return int(hash)
+	log.Infof("rebuild blond filter done, players: %d", total)
+	return nil
+}
+
+// StartRebuildBlondFilter 定时重建，多个服务同时重建时只有一个会执行
+func StartRebuildBlondFilter(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		RebuildBlondFilter()
+	}
+}
+
+// AddToBlondFilter 新增玩家后调用，否则新玩家会被过滤掉
+func AddToBlondFilter(id int64) error {
+	return PlayerFilter.Add(context.TODO(), strconv.FormatInt(id, 10))
 }
 
 func CheckExist(id int64) bool {
-	key := fmt.Sprintf("%s%d", redis.PlayerPrefix, id)
-	hashCode := int(math.Abs(float64(getHashCode(key))))
-	offset := hashCode % base
-	res, err := redis.Client.GetBit(key, int64(offset)).Result()
+	exists, err := PlayerFilter.Exists(context.TODO(), strconv.FormatInt(id, 10))
 	if err != nil {
 		log.Errorf("%v", err)
 		return false
 	}
-	log.Infof("%v", res)
-	return res == 1
+	return exists
 }
@@ -1,52 +1,64 @@
 package util
 
 import (
-	"encoding/json"
-	"github.com/go-redis/redis"
-	"github.com/ziyifast/log"
+	"context"
+	"myTest/demo_home/blond_filter/dao"
 	"myTest/demo_home/blond_filter/model"
 	redis2 "myTest/demo_home/blond_filter/redis"
+	"myTest/demo_home/redis_demo/cache_aside"
 	"strconv"
 	"time"
 )
 
 type playerCache struct {
+	cache *cache_aside.Cache[*model.Player]
 }
 
 var (
-	PlayerCache = new(playerCache)
-	PlayerKey   = "player"
+	PlayerCache = newPlayerCache()
+	PlayerKey   = "player:info:"
 )
 
-func (c *playerCache) GetById(id int64) (*model.Player, error) {
-	log.Infof("query redis,time:%v", time.Now().String())
-	result, err := redis2.Client.HGet(PlayerKey, strconv.FormatInt(id, 10)).Result()
-	if err != nil && err != redis.Nil {
-		log.Errorf("%v", err)
-		return nil, err
+func newPlayerCache() *playerCache {
+	//缓存10min，逻辑过期后继续保留10min返回旧数据，同时异步从数据库刷新
+	cache := cache_aside.New[*model.Player](redis2.Client, PlayerKey, loadPlayer, time.Minute*10)
+	//数据库中不存在的玩家缓存1min空值，防止不存在的id一直查询数据库
+	cache.SetMissTTL(time.Minute)
+	return &playerCache{
+		cache: cache,
 	}
-	if result == "" {
-		return nil, nil
+}
+
+func loadPlayer(ctx context.Context, key string) (*model.Player, error) {
+	id, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, err
 	}
-	p := new(model.Player)
-	err = json.Unmarshal([]byte(result), p)
+	p, err := dao.PlayerDao.GetById(id)
 	if err != nil {
-		log.Errorf("%v", err)
 		return nil, err
 	}
+	if p == nil {
+		return nil, cache_aside.ErrNotFound
+	}
 	return p, nil
 }
 
-func (c *playerCache) Put(player *model.Player) error {
-	marshal, err := json.Marshal(player)
-	if err != nil {
-		log.Errorf("%v", err)
-		return err
-	}
-	_, err = redis2.Client.HSet(PlayerKey, strconv.FormatInt(player.Id, 10), string(marshal)).Result()
-	if err != nil {
-		log.Errorf("%v", err)
-		return err
+// GetById 先查询redis，不存在时查询数据库并写入缓存，同一个id同时只会查询一次数据库
+// 玩家不存在（包括命中空值缓存）时返回nil, nil
+func (c *playerCache) GetById(id int64) (*model.Player, error) {
+	p, err := c.cache.Get(context.TODO(), strconv.FormatInt(id, 10))
+	if err == cache_aside.ErrNotFound {
+		return nil, nil
 	}
-	return nil
+	return p, err
+}
+
+func (c *playerCache) Put(player *model.Player) error {
+	return c.cache.Set(context.TODO(), strconv.FormatInt(player.Id, 10), player)
+}
+
+// Del 删除玩家缓存，新增或者修改玩家后调用，同时会删除空值缓存
+func (c *playerCache) Del(id int64) error {
+	return c.cache.Del(context.TODO(), strconv.FormatInt(id, 10))
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+延迟队列的管理接口：
+1. GET /tasks?page=1&pageSize=20 按执行时间升序分页查询等待执行的任务
+2. GET /tasks/{id} 查询单个任务，DELETE /tasks/{id} 取消任务，POST /tasks/{id}/fire 立即执行任务
+内存实现的任务交给worker后就从队列中删除，执行失败也不会重试，所以只有等待执行（pending）一种状态，
+没有基于redis实现中的执行中（processing）和死信队列（dead）
+*/
+
+// TaskInfo 管理接口返回的任务信息
+type TaskInfo struct {
+	Id          int64     `json:"id"`
+	ExecuteTime time.Time `json:"executeTime"`
+}
+
+// List 按执行时间升序分页查询等待执行的任务，返回任务和等待执行的任务总数
+func (d *DelayQueue) List(offset, count int) ([]*TaskInfo, int) {
+	d.mu.Lock()
+	tasks := make([]*TaskInfo, 0, len(d.tasks))
+	for _, t := range d.tasks {
+		tasks = append(tasks, &TaskInfo{Id: t.id, ExecuteTime: t.ExecuteTime})
+	}
+	d.mu.Unlock()
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].ExecuteTime.Equal(tasks[j].ExecuteTime) {
+			return tasks[i].Id < tasks[j].Id
+		}
+		return tasks[i].ExecuteTime.Before(tasks[j].ExecuteTime)
+	})
+	total := len(tasks)
+	if offset > total {
+		offset = total
+	}
+	end := offset + count
+	if end > total {
+		end = total
+	}
+	return tasks[offset:end], total
+}
+
+func (d *DelayQueue) handle(id int64) (*TaskHandle, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.pending[id]
+	if !ok {
+		return nil, false
+	}
+	return &TaskHandle{task: t, queue: d}, true
+}
+
+// Get 查询等待执行的任务，任务已经开始执行或者已经取消时返回false
+func (d *DelayQueue) Get(id int64) (*TaskInfo, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.pending[id]
+	if !ok {
+		return nil, false
+	}
+	return &TaskInfo{Id: t.id, ExecuteTime: t.ExecuteTime}, true
+}
+
+// Cancel 按id取消任务，任务已经开始执行或者已经取消时返回false
+func (d *DelayQueue) Cancel(id int64) bool {
+	h, ok := d.handle(id)
+	return ok && h.Cancel()
+}
+
+// FireNow 按id立即执行任务，任务已经开始执行或者已经取消时返回false
+func (d *DelayQueue) FireNow(id int64) bool {
+	h, ok := d.handle(id)
+	return ok && h.Reschedule(time.Now())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// AdminHandler 管理接口，需要同时注册/tasks和/tasks/
+func (d *DelayQueue) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/tasks"), "/")
+		if path == "" {
+			d.listTasks(w, r)
+			return
+		}
+		parts := strings.Split(path, "/")
+		id, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "fire") {
+			writeJSON(w, http.StatusNotFound, "not found")
+			return
+		}
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			task, ok := d.Get(id)
+			if !ok {
+				writeJSON(w, http.StatusNotFound, "task not found")
+				return
+			}
+			writeJSON(w, http.StatusOK, task)
+		case len(parts) == 1 && r.Method == http.MethodDelete:
+			if !d.Cancel(id) {
+				writeJSON(w, http.StatusNotFound, "task not found")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"cancelled": true})
+		case len(parts) == 2 && r.Method == http.MethodPost:
+			if !d.FireNow(id) {
+				writeJSON(w, http.StatusConflict, "task not found or executing")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"fired": true})
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+func (d *DelayQueue) listTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	page, pageSize := 1, 20
+	var err error
+	if v := r.URL.Query().Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil {
+			page = 0
+		}
+	}
+	if v := r.URL.Query().Get("pageSize"); v != "" {
+		if pageSize, err = strconv.Atoi(v); err != nil {
+			pageSize = 0
+		}
+	}
+	if page < 1 || pageSize < 1 || pageSize > 100 {
+		writeJSON(w, http.StatusBadRequest, "page must be >= 1 and pageSize must be in [1, 100]")
+		return
+	}
+	tasks, total := d.List((page-1)*pageSize, pageSize)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total": total, "page": page, "pageSize": pageSize, "tasks": tasks})
+}
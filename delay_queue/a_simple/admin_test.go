@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func request(t *testing.T, h http.Handler, method, url string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, url, nil))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v, body: %s", method, url, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func TestAdminListAndGet(t *testing.T) {
+	d := NewDelayQueue(1)
+	h := d.AdminHandler()
+	now := time.Now()
+	handles := make([]*TaskHandle, 0)
+	//后加入但执行时间更早的任务排在前面
+	for _, i := range []int{4, 3, 2, 1, 0} {
+		handles = append(handles, d.AddTask(&Task{ExecuteTime: now.Add(time.Duration(i) * time.Minute), Job: func() {}}))
+	}
+	var page struct {
+		Total int         `json:"total"`
+		Tasks []*TaskInfo `json:"tasks"`
+	}
+	if code := request(t, h, http.MethodGet, "/tasks?page=2&pageSize=2", &page); code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	if page.Total != 5 || len(page.Tasks) != 2 || page.Tasks[0].Id != handles[2].Id() || page.Tasks[1].Id != handles[1].Id() {
+		t.Fatalf("page = %+v", page)
+	}
+	if code := request(t, h, http.MethodGet, "/tasks?page=0", nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid page status = %d", code)
+	}
+
+	var task TaskInfo
+	if code := request(t, h, http.MethodGet, fmt.Sprintf("/tasks/%d", handles[0].Id()), &task); code != http.StatusOK {
+		t.Fatalf("get status = %d", code)
+	}
+	if !task.ExecuteTime.Equal(now.Add(time.Minute * 4)) {
+		t.Fatalf("task = %+v", task)
+	}
+	if code := request(t, h, http.MethodGet, "/tasks/100", nil); code != http.StatusNotFound {
+		t.Fatalf("get missing status = %d", code)
+	}
+}
+
+func TestAdminCancelAndFire(t *testing.T) {
+	d := NewDelayQueue(1)
+	h := d.AdminHandler()
+	executed := make(chan struct{}, 1)
+	cancelled := d.AddTask(&Task{ExecuteTime: time.Now().Add(time.Hour), Job: func() {}})
+	fired := d.AddTask(&Task{ExecuteTime: time.Now().Add(time.Hour), Job: func() { executed <- struct{}{} }})
+	d.Start()
+	defer d.Stop()
+
+	url := fmt.Sprintf("/tasks/%d", cancelled.Id())
+	if code := request(t, h, http.MethodDelete, url, nil); code != http.StatusOK {
+		t.Fatalf("cancel status = %d", code)
+	}
+	if code := request(t, h, http.MethodDelete, url, nil); code != http.StatusNotFound {
+		t.Fatalf("cancel twice status = %d", code)
+	}
+	if code := request(t, h, http.MethodPost, url+"/fire", nil); code != http.StatusConflict {
+		t.Fatalf("fire cancelled status = %d", code)
+	}
+
+	if code := request(t, h, http.MethodPost, fmt.Sprintf("/tasks/%d/fire", fired.Id()), nil); code != http.StatusOK {
+		t.Fatalf("fire status = %d", code)
+	}
+	select {
+	case <-executed:
+	case <-time.After(time.Second):
+		t.Fatal("fired task is not executed")
+	}
+	//已经开始执行的任务查询不到
+	if _, ok := d.Get(fired.Id()); ok {
+		t.Fatal("executed task is still pending")
+	}
+	if d.Len() != 0 {
+		t.Fatalf("len = %d", d.Len())
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	d := NewDelayQueue(1)
+	d.AddTask(&Task{ExecuteTime: time.Now().Add(-time.Second * 2), Job: func() {}})
+	d.AddTask(&Task{ExecuteTime: time.Now().Add(time.Hour), Job: func() {}}).Cancel()
+	if lag := d.Lag(); lag < time.Second*2 {
+		t.Fatalf("lag = %s, want >= 2s", lag)
+	}
+	rec := httptest.NewRecorder()
+	d.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE memory_delay_queue_events_total counter",
+		`memory_delay_queue_events_total{event="added"} 2`,
+		`memory_delay_queue_events_total{event="cancelled"} 1`,
+		`memory_delay_queue_events_total{event="executed"} 0`,
+		"memory_delay_queue_pending 1",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("metrics missing %q:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+基于最小堆实现延迟队列：
+1. 按执行时间排序，堆顶是最早执行的任务，后加入但执行时间更早的任务会排到前面
+2. 调度goroutine等待到堆顶任务的执行时间，等待期间有新任务加入、任务取消或者修改执行时间时会被唤醒重新计算等待时间
+3. 到期的任务交给固定数量的worker执行，任务执行慢时调度goroutine阻塞，不会无限创建goroutine
+*/
+type Task struct {
+	ExecuteTime time.Time
+	Job         func()
+	// AddTask时分配的任务id，用于管理接口查询
+	id int64
+	// 在堆中的下标，不在堆中（已执行或者已取消）时为-1
+	index int
+}
+
+// taskHeap 按执行时间排序的最小堆，实现heap.Interface
+type taskHeap []*Task
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool { return h[i].ExecuteTime.Before(h[j].ExecuteTime) }
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*Task)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*h = old[:n-1]
+	return t
+}
+
+type DelayQueue struct {
+	mu    sync.Mutex
+	tasks taskHeap
+	// 等待执行的任务，key为任务id
+	pending map[int64]*Task
+	nextId  int64
+	// 堆顶发生变化时通知调度goroutine
+	wakeup   chan struct{}
+	jobs     chan func()
+	workers  int
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	// 监控指标，通过atomic读写
+	added     int64
+	executed  int64
+	cancelled int64
+	panicked  int64
+}
+
+// TaskHandle AddTask返回的句柄，用于取消任务或者修改执行时间
+type TaskHandle struct {
+	task  *Task
+	queue *DelayQueue
+}
+
+func NewDelayQueue(workers int) *DelayQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &DelayQueue{
+		pending: make(map[int64]*Task),
+		wakeup:  make(chan struct{}, 1),
+		jobs:    make(chan func()),
+		workers: workers,
+		stop:    make(chan struct{}),
+	}
+}
+
+// AddTask 可以在任意goroutine中调用，包括队列运行中和任务执行中
+func (d *DelayQueue) AddTask(t *Task) *TaskHandle {
+	d.mu.Lock()
+	d.nextId++
+	t.id = d.nextId
+	d.pending[t.id] = t
+	heap.Push(&d.tasks, t)
+	d.mu.Unlock()
+	atomic.AddInt64(&d.added, 1)
+	d.notify()
+	return &TaskHandle{task: t, queue: d}
+}
+
+func (d *DelayQueue) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tasks.Len()
+}
+
+func (d *DelayQueue) notify() {
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Id 任务id，管理接口按id查询、取消和立即执行任务
+func (h *TaskHandle) Id() int64 {
+	return h.task.id
+}
+
+// Cancel 取消任务，任务已经开始执行或者已经取消时返回false
+func (h *TaskHandle) Cancel() bool {
+	d := h.queue
+	d.mu.Lock()
+	if h.task.index < 0 {
+		d.mu.Unlock()
+		return false
+	}
+	heap.Remove(&d.tasks, h.task.index)
+	delete(d.pending, h.task.id)
+	d.mu.Unlock()
+	atomic.AddInt64(&d.cancelled, 1)
+	d.notify()
+	return true
+}
+
+// Reschedule 修改任务的执行时间，任务已经开始执行或者已经取消时返回false
+func (h *TaskHandle) Reschedule(executeTime time.Time) bool {
+	d := h.queue
+	d.mu.Lock()
+	if h.task.index < 0 {
+		d.mu.Unlock()
+		return false
+	}
+	h.task.ExecuteTime = executeTime
+	heap.Fix(&d.tasks, h.task.index)
+	d.mu.Unlock()
+	d.notify()
+	return true
+}
+
+// Start 启动调度goroutine和worker
+func (d *DelayQueue) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	d.wg.Add(1)
+	go d.dispatch()
+}
+
+// Stop 停止调度，等待正在执行的任务完成，未到期的任务不再执行；可以重复调用
+func (d *DelayQueue) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+	d.wg.Wait()
+}
+
+func (d *DelayQueue) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case job := <-d.jobs:
+			d.execute(job)
+		}
+	}
+}
+
+func (d *DelayQueue) execute(job func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			atomic.AddInt64(&d.panicked, 1)
+			fmt.Printf("execute task panic: %v\n", err)
+		}
+	}()
+	defer atomic.AddInt64(&d.executed, 1)
+	job()
+}
+
+func (d *DelayQueue) dispatch() {
+	defer d.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		d.mu.Lock()
+		var wait time.Duration = -1
+		var due *Task
+		if d.tasks.Len() > 0 {
+			if wait = time.Until(d.tasks[0].ExecuteTime); wait <= 0 {
+				due = heap.Pop(&d.tasks).(*Task)
+				delete(d.pending, due.id)
+			}
+		}
+		d.mu.Unlock()
+		if due != nil {
+			select {
+			case d.jobs <- due.Job:
+			case <-d.stop:
+				return
+			}
+			continue
+		}
+		//队列为空时一直等待，直到有新任务加入
+		var timeout <-chan time.Time
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-d.wakeup:
+		case <-timeout:
+		}
+	}
+}
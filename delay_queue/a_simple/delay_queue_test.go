@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExecuteInDueOrder(t *testing.T) {
+	d := NewDelayQueue(1)
+	var mu sync.Mutex
+	order := make([]int, 0)
+	var wg sync.WaitGroup
+	now := time.Now()
+	//后加入但执行时间更早的任务先执行
+	for _, i := range []int{3, 1, 2} {
+		i := i
+		wg.Add(1)
+		d.AddTask(&Task{ExecuteTime: now.Add(time.Duration(i) * time.Millisecond * 20), Job: func() {
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			wg.Done()
+		}})
+	}
+	d.Start()
+	defer d.Stop()
+	wg.Wait()
+	if !reflect.DeepEqual(order, []int{1, 2, 3}) {
+		t.Fatalf("order = %v", order)
+	}
+}
+
+func TestCancelAndReschedule(t *testing.T) {
+	d := NewDelayQueue(1)
+	d.Start()
+	defer d.Stop()
+	var executed int32
+	cancelled := d.AddTask(&Task{ExecuteTime: time.Now().Add(time.Millisecond * 30), Job: func() {
+		atomic.AddInt32(&executed, 1)
+	}})
+	done := make(chan time.Time, 1)
+	rescheduled := d.AddTask(&Task{ExecuteTime: time.Now().Add(time.Hour), Job: func() {
+		done <- time.Now()
+	}})
+
+	if !cancelled.Cancel() || cancelled.Cancel() {
+		t.Fatal("cancel should succeed only once")
+	}
+	//提前执行时间，调度goroutine被唤醒重新计算等待时间
+	start := time.Now()
+	if !rescheduled.Reschedule(start.Add(time.Millisecond * 10)) {
+		t.Fatal("reschedule failed")
+	}
+	select {
+	case at := <-done:
+		if at.Sub(start) < time.Millisecond*10 {
+			t.Fatalf("executed %v before the rescheduled time", at.Sub(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rescheduled task was not executed")
+	}
+	//已经执行的任务不能再取消或者修改执行时间
+	if rescheduled.Cancel() || rescheduled.Reschedule(time.Now()) {
+		t.Fatal("executed task was cancelled or rescheduled")
+	}
+	time.Sleep(time.Millisecond * 50)
+	if atomic.LoadInt32(&executed) != 0 || d.Len() != 0 {
+		t.Fatalf("cancelled task executed %d times, %d tasks left", executed, d.Len())
+	}
+}
+
+func TestBoundedWorkers(t *testing.T) {
+	const workers = 2
+	d := NewDelayQueue(workers)
+	d.Start()
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		d.AddTask(&Task{ExecuteTime: time.Now(), Job: func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt32(&running, -1)
+		}})
+	}
+	wg.Wait()
+	if maxRunning != workers {
+		t.Fatalf("max running = %d, want %d", maxRunning, workers)
+	}
+	//重复调用Stop不会panic
+	d.Stop()
+	d.Stop()
+}
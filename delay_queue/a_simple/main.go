@@ -2,63 +2,56 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 )
 
 /*
 基于go实现延迟队列
 */
-type Task struct {
-	ExecuteTime time.Time
-	Job         func()
-}
-
-type DelayQueue struct {
-	Tasks []*Task
-}
-
-func (d *DelayQueue) AddTask(t *Task) {
-	d.Tasks = append(d.Tasks, t)
-}
-
-func (d *DelayQueue) RemoveTask() {
-	//FIFO: remove the first task to enqueue
-	d.Tasks = d.Tasks[1:]
-}
-
-func (d *DelayQueue) ExecuteTask() {
-	for len(d.Tasks) > 0 {
-		//dequeue a task
-		currentTask := d.Tasks[0]
-		if time.Now().Before(currentTask.ExecuteTime) {
-			//if the task execution time is not up, wait
-			time.Sleep(currentTask.ExecuteTime.Sub(time.Now()))
-		}
-		//execute the task
-		currentTask.Job()
-		//remove task who has been executed
-		d.RemoveTask()
-	}
-
-}
-
 func main() {
 	fmt.Println("start delayQueue")
-	delayQueue := &DelayQueue{}
-	firstTask := &Task{
-		ExecuteTime: time.Now().Add(time.Second * 1),
+	delayQueue := NewDelayQueue(2)
+	delayQueue.Start()
+	http.Handle("/metrics", delayQueue.MetricsHandler())
+	http.Handle("/tasks", delayQueue.AdminHandler())
+	http.Handle("/tasks/", delayQueue.AdminHandler())
+	go http.ListenAndServe(":9998", nil)
+	//等待task 1、2、4执行完成
+	wg := new(sync.WaitGroup)
+	wg.Add(3)
+	delayQueue.AddTask(&Task{
+		ExecuteTime: time.Now().Add(time.Second * 7),
 		Job: func() {
 			fmt.Println("executed task 1 after delay")
+			wg.Done()
 		},
-	}
-	delayQueue.AddTask(firstTask)
-	secondTask := &Task{
-		ExecuteTime: time.Now().Add(time.Second * 7),
+	})
+	//后加入但执行时间更早，会先执行
+	delayQueue.AddTask(&Task{
+		ExecuteTime: time.Now().Add(time.Second * 1),
 		Job: func() {
 			fmt.Println("executed task 2 after delay")
+			wg.Done()
+		},
+	})
+	canceled := delayQueue.AddTask(&Task{
+		ExecuteTime: time.Now().Add(time.Second * 3),
+		Job: func() {
+			fmt.Println("task 3 should not be executed")
+		},
+	})
+	canceled.Cancel()
+	rescheduled := delayQueue.AddTask(&Task{
+		ExecuteTime: time.Now().Add(time.Second * 10),
+		Job: func() {
+			fmt.Println("executed task 4 after reschedule")
+			wg.Done()
 		},
-	}
-	delayQueue.AddTask(secondTask)
-	delayQueue.ExecuteTask()
+	})
+	rescheduled.Reschedule(time.Now().Add(time.Second * 5))
+	wg.Wait()
+	delayQueue.Stop()
 	fmt.Println("all tasks have been done!!!")
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Lag 最早到期但还没有开始执行的任务已经延迟的时间，worker都在忙时会变大
+func (d *DelayQueue) Lag() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tasks.Len() == 0 {
+		return 0
+	}
+	if lag := time.Since(d.tasks[0].ExecuteTime); lag > 0 {
+		return lag
+	}
+	return 0
+}
+
+// WriteMetrics 按Prometheus文本格式输出监控指标
+func (d *DelayQueue) WriteMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP memory_delay_queue_events_total Number of task state changes.")
+	fmt.Fprintln(w, "# TYPE memory_delay_queue_events_total counter")
+	fmt.Fprintf(w, "memory_delay_queue_events_total{event=\"added\"} %d\n", atomic.LoadInt64(&d.added))
+	fmt.Fprintf(w, "memory_delay_queue_events_total{event=\"cancelled\"} %d\n", atomic.LoadInt64(&d.cancelled))
+	fmt.Fprintf(w, "memory_delay_queue_events_total{event=\"executed\"} %d\n", atomic.LoadInt64(&d.executed))
+	fmt.Fprintf(w, "memory_delay_queue_events_total{event=\"panicked\"} %d\n", atomic.LoadInt64(&d.panicked))
+	fmt.Fprintln(w, "# HELP memory_delay_queue_pending Number of tasks waiting to be executed.")
+	fmt.Fprintln(w, "# TYPE memory_delay_queue_pending gauge")
+	fmt.Fprintf(w, "memory_delay_queue_pending %d\n", d.Len())
+	fmt.Fprintln(w, "# HELP memory_delay_queue_lag_seconds Age of the oldest due task that has not been executed.")
+	fmt.Fprintln(w, "# TYPE memory_delay_queue_lag_seconds gauge")
+	fmt.Fprintf(w, "memory_delay_queue_lag_seconds %g\n", d.Lag().Seconds())
+}
+
+// MetricsHandler /metrics接口
+func (d *DelayQueue) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		d.WriteMetrics(w)
+	})
+}
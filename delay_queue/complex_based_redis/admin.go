@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kataras/iris/v12"
+	context2 "github.com/kataras/iris/v12/context"
+	"io"
+	"myTest/demo_home/redis_demo/redis_store"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+延迟队列的管理接口和监控指标：
+1. 按状态（pending、processing、dead）分页查询任务，查询单个任务，取消任务（定时任务的触发任务取消后推进到下一次），立即执行任务
+2. /metrics 按Prometheus文本格式输出各个状态变化的次数、各个状态的任务数量和最早到期任务的延迟
+*/
+
+const (
+	StatePending    = "pending"
+	StateProcessing = "processing"
+	StateDead       = "dead"
+)
+
+var ErrUnknownState = errors.New("unknown task state")
+
+// TaskInfo 管理接口返回的任务信息，Score含义由状态决定：执行时间、可见性超时时间、进入死信队列的时间
+type TaskInfo struct {
+	*Task
+	State string `json:"state"`
+	Score int64  `json:"score"`
+	// 已经失败的次数
+	Retry int64 `json:"retry"`
+}
+
+func (q *DelayQueue) stateKey(state string) (string, error) {
+	switch state {
+	case StatePending:
+		return q.key, nil
+	case StateProcessing:
+		return q.processingKey, nil
+	case StateDead:
+		return q.deadKey, nil
+	}
+	return "", ErrUnknownState
+}
+
+// List 按score升序分页查询某个状态的任务，返回任务和该状态的任务总数
+func (q *DelayQueue) List(ctx context.Context, state string, offset, count int64) ([]*TaskInfo, int64, error) {
+	key, err := q.stateKey(state)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := q.redisCli.ZCard(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	zs, err := q.redisCli.ZRangeByScoreWithScores(ctx, key, redis_store.ZRangeBy{
+		Min:    "-inf",
+		Max:    "+inf",
+		Offset: offset,
+		Count:  count,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	tasks := make([]*TaskInfo, 0, len(zs))
+	for _, z := range zs {
+		info, err := q.taskInfo(ctx, z.Member, state, int64(z.Score))
+		if err == redis_store.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		tasks = append(tasks, info)
+	}
+	return tasks, total, nil
+}
+
+func (q *DelayQueue) taskInfo(ctx context.Context, id, state string, score int64) (*TaskInfo, error) {
+	data, err := q.redisCli.HGet(ctx, q.tasksKey, id)
+	if err != nil {
+		return nil, err
+	}
+	task := new(Task)
+	if err = json.Unmarshal([]byte(data), task); err != nil {
+		return nil, err
+	}
+	info := &TaskInfo{Task: task, State: state, Score: score}
+	retry, err := q.redisCli.HGet(ctx, q.retryKey, id)
+	if err != nil && err != redis_store.Nil {
+		return nil, err
+	}
+	if retry != "" {
+		fmt.Sscan(retry, &info.Retry)
+	}
+	return info, nil
+}
+
+// Get 查询单个任务，任务不存在时返回redis_store.Nil
+func (q *DelayQueue) Get(ctx context.Context, id string) (*TaskInfo, error) {
+	for _, state := range []string{StatePending, StateProcessing, StateDead} {
+		key, _ := q.stateKey(state)
+		score, err := q.redisCli.ZScore(ctx, key, id)
+		if err == redis_store.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return q.taskInfo(ctx, id, state, int64(score))
+	}
+	return nil, redis_store.Nil
+}
+
+// 从所有状态中删除任务，执行中的任务取消后ack会失败
+var cancelCmd = "redis.call('zrem', KEYS[1], ARGV[1]) " +
+	"redis.call('zrem', KEYS[2], ARGV[1]) " +
+	"redis.call('zrem', KEYS[4], ARGV[1]) " +
+	"redis.call('hdel', KEYS[3], ARGV[1]) " +
+	"local removed = redis.call('hdel', KEYS[5], ARGV[1]) " +
+	"if removed == 1 then " +
+	"   redis.call('hincrby', KEYS[7], 'cancelled', 1) " +
+	"end " +
+	"return removed"
+
+// 等待中或者死信队列中的任务立即执行，死信队列中的任务重新计算重试次数，ARGV: 任务id, 当前时间
+var fireCmd = "if redis.call('zscore', KEYS[1], ARGV[1]) then " +
+	"   redis.call('zadd', KEYS[1], ARGV[2], ARGV[1]) " +
+	"elseif redis.call('zscore', KEYS[4], ARGV[1]) then " +
+	"   redis.call('zrem', KEYS[4], ARGV[1]) " +
+	"   redis.call('hdel', KEYS[3], ARGV[1]) " +
+	"   redis.call('zadd', KEYS[1], ARGV[2], ARGV[1]) " +
+	"else " +
+	"   return 0 " +
+	"end " +
+	"redis.call('rpush', KEYS[6], ARGV[1]) " +
+	"redis.call('ltrim', KEYS[6], 0, 99) " +
+	"return 1"
+
+// Cancel 取消任务，任务不存在时返回false
+func (q *DelayQueue) Cancel(ctx context.Context, id string) (bool, error) {
+	result, err := q.redisCli.Eval(ctx, cancelCmd, q.keys(), id)
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+// FireNow 立即执行等待中或者死信队列中的任务，任务不存在或者正在执行时返回false
+func (q *DelayQueue) FireNow(ctx context.Context, id string) (bool, error) {
+	result, err := q.redisCli.Eval(ctx, fireCmd, q.keys(), id, time.Now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+type QueueStats struct {
+	// 各个状态变化的累计次数：enqueued、acked、nacked、redelivered、dead、cancelled
+	Counters map[string]int64 `json:"counters"`
+	// 各个状态当前的任务数量
+	Tasks map[string]int64 `json:"tasks"`
+	// 最早到期但还没有被取走的任务已经延迟的时间
+	Lag time.Duration `json:"lag"`
+}
+
+func (q *DelayQueue) Stats(ctx context.Context) (*QueueStats, error) {
+	counters, err := q.redisCli.HGetAll(ctx, q.statsKey)
+	if err != nil {
+		return nil, err
+	}
+	stats := &QueueStats{
+		Counters: make(map[string]int64),
+		Tasks:    make(map[string]int64),
+	}
+	for _, name := range []string{"enqueued", "acked", "nacked", "redelivered", "dead", "cancelled"} {
+		var n int64
+		fmt.Sscan(counters[name], &n)
+		stats.Counters[name] = n
+	}
+	for _, state := range []string{StatePending, StateProcessing, StateDead} {
+		key, _ := q.stateKey(state)
+		if stats.Tasks[state], err = q.redisCli.ZCard(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	next, ok, err := q.NextDue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if lag := time.Since(next); ok && lag > 0 {
+		stats.Lag = lag
+	}
+	return stats, nil
+}
+
+// WriteMetrics 按Prometheus文本格式输出监控指标
+func (q *DelayQueue) WriteMetrics(ctx context.Context, w io.Writer) error {
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "# HELP delay_queue_events_total Number of task state changes.")
+	fmt.Fprintln(w, "# TYPE delay_queue_events_total counter")
+	for _, name := range sortedKeys(stats.Counters) {
+		fmt.Fprintf(w, "delay_queue_events_total{queue=%q,event=%q} %d\n", q.key, name, stats.Counters[name])
+	}
+	fmt.Fprintln(w, "# HELP delay_queue_tasks Number of tasks in each state.")
+	fmt.Fprintln(w, "# TYPE delay_queue_tasks gauge")
+	for _, state := range sortedKeys(stats.Tasks) {
+		fmt.Fprintf(w, "delay_queue_tasks{queue=%q,state=%q} %d\n", q.key, state, stats.Tasks[state])
+	}
+	fmt.Fprintln(w, "# HELP delay_queue_lag_seconds Age of the oldest due task that has not been claimed.")
+	fmt.Fprintln(w, "# TYPE delay_queue_lag_seconds gauge")
+	fmt.Fprintf(w, "delay_queue_lag_seconds{queue=%q} %g\n", q.key, stats.Lag.Seconds())
+	return nil
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// registerAdmin 注册管理接口
+func registerAdmin(app *iris.Application, queue *DelayQueue, scheduler *Scheduler) {
+	app.Get("/tasks", func(c *context2.Context) {
+		state := c.URLParamDefault("state", StatePending)
+		page := c.URLParamInt64Default("page", 1)
+		pageSize := c.URLParamInt64Default("pageSize", 20)
+		if page < 1 || pageSize < 1 || pageSize > 100 {
+			c.StatusCode(http.StatusBadRequest)
+			c.JSON("page must be >= 1 and pageSize must be in [1, 100]")
+			return
+		}
+		tasks, total, err := queue.List(context.TODO(), state, (page-1)*pageSize, pageSize)
+		if err == ErrUnknownState {
+			c.StatusCode(http.StatusBadRequest)
+			c.JSON(err.Error())
+			return
+		}
+		if err != nil {
+			c.StatusCode(http.StatusInternalServerError)
+			c.JSON(err.Error())
+			return
+		}
+		c.JSON(map[string]interface{}{"total": total, "page": page, "pageSize": pageSize, "tasks": tasks})
+	})
+	app.Get("/tasks/{id}", func(c *context2.Context) {
+		task, err := queue.Get(context.TODO(), c.Params().Get("id"))
+		if err == redis_store.Nil {
+			c.StatusCode(http.StatusNotFound)
+			c.JSON("task not found")
+			return
+		}
+		if err != nil {
+			c.StatusCode(http.StatusInternalServerError)
+			c.JSON(err.Error())
+			return
+		}
+		c.JSON(task)
+	})
+	app.Delete("/tasks/{id}", func(c *context2.Context) {
+		id := c.Params().Get("id")
+		cancel := queue.Cancel
+		//定时任务的触发任务取消后需要写入下一次的触发任务
+		if strings.HasPrefix(id, cronTopic+":") {
+			cancel = scheduler.Skip
+		}
+		ok, err := cancel(context.TODO(), id)
+		if err != nil {
+			c.StatusCode(http.StatusInternalServerError)
+			c.JSON(err.Error())
+			return
+		}
+		if !ok {
+			c.StatusCode(http.StatusNotFound)
+			c.JSON("task not found")
+			return
+		}
+		c.JSON(map[string]interface{}{"cancelled": true})
+	})
+	app.Post("/tasks/{id}/fire", func(c *context2.Context) {
+		ok, err := queue.FireNow(context.TODO(), c.Params().Get("id"))
+		if err != nil {
+			c.StatusCode(http.StatusInternalServerError)
+			c.JSON(err.Error())
+			return
+		}
+		if !ok {
+			c.StatusCode(http.StatusConflict)
+			c.JSON("task not found or processing")
+			return
+		}
+		c.JSON(map[string]interface{}{"fired": true})
+	})
+	app.Get("/metrics", func(c *context2.Context) {
+		buf := new(strings.Builder)
+		if err := queue.WriteMetrics(context.TODO(), buf); err != nil {
+			c.StatusCode(http.StatusInternalServerError)
+			c.JSON(err.Error())
+			return
+		}
+		c.ContentType("text/plain; version=0.0.4")
+		c.WriteString(buf.String())
+	})
+}
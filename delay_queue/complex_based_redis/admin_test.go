@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListAndGet(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	now := time.Now()
+	ids := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		task, _ := q.Add(ctx, "topic", i, now.Add(time.Duration(i)*time.Minute))
+		ids = append(ids, task.Id)
+	}
+	//按执行时间升序分页
+	tasks, total, err := q.List(ctx, StatePending, 2, 2)
+	if err != nil || total != 5 || len(tasks) != 2 {
+		t.Fatalf("list = %v, %d, %v", tasks, total, err)
+	}
+	if tasks[0].Id != ids[2] || tasks[1].Id != ids[3] || tasks[0].Score != now.Add(time.Minute*2).UnixMilli() {
+		t.Fatalf("page = %+v, %+v", tasks[0], tasks[1])
+	}
+	if _, _, err = q.List(ctx, "unknown", 0, 10); err != ErrUnknownState {
+		t.Fatalf("list unknown state err = %v", err)
+	}
+
+	info, err := q.Get(ctx, ids[0])
+	if err != nil || info.State != StatePending || info.Topic != "topic" {
+		t.Fatalf("get pending = %+v, %v", info, err)
+	}
+	q.Claim(ctx, 1)
+	if info, _ = q.Get(ctx, ids[0]); info.State != StateProcessing {
+		t.Fatalf("get processing = %+v", info)
+	}
+	if _, err = q.Get(ctx, "missing"); err != redis_store.Nil {
+		t.Fatalf("get missing err = %v", err)
+	}
+}
+
+func TestDeadTaskRetry(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	q.SetRetryDelay(0)
+	q.SetMaxRetry(1)
+	q.SetVisibilityTimeout(0)
+	nacked, _ := q.Add(ctx, "topic", "nack", time.Now())
+	q.Claim(ctx, 1)
+	q.Nack(ctx, nacked.Id)
+	q.Claim(ctx, 1)
+	q.Nack(ctx, nacked.Id)
+	timeout, _ := q.Add(ctx, "topic", "timeout", time.Now())
+	for i := 0; i < 2; i++ {
+		q.Claim(ctx, 1)
+		q.Redeliver(ctx)
+	}
+	//进入死信队列后仍然能查到失败的次数
+	tasks, total, _ := q.List(ctx, StateDead, 0, 10)
+	if total != 2 || len(tasks) != 2 {
+		t.Fatalf("dead tasks = %v", tasks)
+	}
+	for _, info := range tasks {
+		if info.Retry != 2 {
+			t.Fatalf("dead task %s retry = %d, want 2", info.Id, info.Retry)
+		}
+	}
+
+	//死信队列中的任务立即执行时重新计算重试次数
+	if ok, _ := q.FireNow(ctx, timeout.Id); !ok {
+		t.Fatal("fire dead task")
+	}
+	info, _ := q.Get(ctx, timeout.Id)
+	if info.State != StatePending || info.Retry != 0 {
+		t.Fatalf("fired dead task = %+v", info)
+	}
+}
+
+func TestCancelAndFireNow(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	later, _ := q.Add(ctx, "topic", "later", time.Now().Add(time.Hour))
+	cancelled, _ := q.Add(ctx, "topic", "cancelled", time.Now().Add(time.Hour))
+
+	if ok, _ := q.Cancel(ctx, cancelled.Id); !ok {
+		t.Fatal("cancel pending task")
+	}
+	if ok, _ := q.Cancel(ctx, cancelled.Id); ok {
+		t.Fatal("cancel twice")
+	}
+	if ok, _ := q.FireNow(ctx, cancelled.Id); ok {
+		t.Fatal("fire cancelled task")
+	}
+
+	if ok, _ := q.FireNow(ctx, later.Id); !ok {
+		t.Fatal("fire pending task")
+	}
+	tasks, _ := q.Claim(ctx, 10)
+	if len(tasks) != 1 || tasks[0].Id != later.Id {
+		t.Fatalf("claim after fire = %v", tasks)
+	}
+	//执行中的任务不能立即执行，取消后ack失败
+	if ok, _ := q.FireNow(ctx, later.Id); ok {
+		t.Fatal("fire processing task")
+	}
+	q.Cancel(ctx, later.Id)
+	if ok, _ := q.Ack(ctx, later.Id); ok {
+		t.Fatal("ack cancelled task")
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	q.Add(ctx, "topic", "due", time.Now().Add(-time.Second*2))
+	q.Add(ctx, "topic", "later", time.Now().Add(time.Hour))
+	task, _ := q.Add(ctx, "topic", "cancelled", time.Now().Add(time.Hour))
+	q.Cancel(ctx, task.Id)
+
+	buf := new(strings.Builder)
+	if err := q.WriteMetrics(ctx, buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE delay_queue_events_total counter",
+		`delay_queue_events_total{queue="test-queue",event="enqueued"} 3`,
+		`delay_queue_events_total{queue="test-queue",event="cancelled"} 1`,
+		`delay_queue_tasks{queue="test-queue",state="pending"} 2`,
+		`delay_queue_tasks{queue="test-queue",state="dead"} 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("metrics missing %q:\n%s", line, out)
+		}
+	}
+	stats, _ := q.Stats(ctx)
+	if stats.Lag < time.Second*2 {
+		t.Fatalf("lag = %s, want >= 2s", stats.Lag)
+	}
+}
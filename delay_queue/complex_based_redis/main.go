@@ -1,25 +1,29 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/go-redis/redis"
+	"github.com/kataras/iris/v12"
 	log "github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/redis_store"
 	"time"
 )
 
 /*
 基于redis zset实现延迟队列
 */
-var redisdb *redis.Client
+var redisdb redis_store.Client
 var DelayQueueKey = "delay-queue"
 
 func initClient() (err error) {
-	redisdb = redis.NewClient(&redis.Options{
+	redisdb = redis_store.NewV6(redis.NewClient(&redis.Options{
 		Addr:     "localhost:6379",
 		Password: "", // not set password
 		DB:       0,  //use default db
-	})
-	_, err = redisdb.Ping().Result()
+	}))
+	err = redisdb.Ping(context.TODO())
 	if err != nil {
 		log.Errorf("%v", err)
 		return err
@@ -27,48 +31,72 @@ func initClient() (err error) {
 	return nil
 }
 
+type OrderTimeout struct {
+	OrderId int64 `json:"orderId"`
+}
+
+type SmsNotify struct {
+	Phone   string `json:"phone"`
+	Content string `json:"content"`
+}
+
 func main() {
 	err := initClient()
 	if err != nil {
 		log.Errorf("init redis client err: %v", err)
 		return
 	}
-	addTaskToQueue("task1", time.Now().Add(time.Second*3).Unix())
-	addTaskToQueue("task2", time.Now().Add(time.Second*8).Unix())
+	queue := NewDelayQueue(redisdb, DelayQueueKey)
+	worker := NewWorker(queue)
+	worker.Register("order.timeout", func(ctx context.Context, task *Task) error {
+		o := new(OrderTimeout)
+		if err := task.Decode(o); err != nil {
+			return err
+		}
+		fmt.Printf("cancel order %d, attempt %d\n", o.OrderId, task.Attempt)
+		return nil
+	})
+	worker.Register("sms.notify", func(ctx context.Context, task *Task) error {
+		s := new(SmsNotify)
+		if err := task.Decode(s); err != nil {
+			return err
+		}
+		fmt.Printf("send sms to %s: %s\n", s.Phone, s.Content)
+		return nil
+	})
+	worker.Register("report.daily", func(ctx context.Context, task *Task) error {
+		fmt.Printf("generate report, due at %s\n", time.UnixMilli(task.DueAt).Format(time.RFC3339))
+		return nil
+	})
+	scheduler := NewScheduler(redisdb, queue, worker)
+	//服务重启后恢复已经保存的定时任务
+	if err = scheduler.Start(context.TODO()); err != nil {
+		log.Errorf("start scheduler err: %v", err)
+		return
+	}
+	addSchedule(scheduler, &Schedule{Name: "heartbeat", Spec: "@every 5m", Topic: "sms.notify", Payload: json.RawMessage(`{"phone":"10086","content":"heartbeat"}`)})
+	addSchedule(scheduler, &Schedule{Name: "daily-report", Spec: "30 9 * * *", TimeZone: "Asia/Shanghai", Topic: "report.daily"})
+	addTaskToQueue(queue, "order.timeout", &OrderTimeout{OrderId: 1}, time.Now().Add(time.Second*3))
+	addTaskToQueue(queue, "sms.notify", &SmsNotify{Phone: "10086", Content: "hello"}, time.Now().Add(time.Millisecond*1500))
+	//管理接口和监控指标
+	app := iris.New()
+	registerAdmin(app, queue, scheduler)
+	go app.Listen(":9999")
 	//执行队列中的任务
-	getAndExecuteTask()
+	worker.Run(context.TODO())
 }
 
-// executeTime为unix时间戳，作为zset中的score。允许redis按照task应该执行时间来进行排序
-func addTaskToQueue(task string, executeTime int64) {
-	err := redisdb.ZAdd(DelayQueueKey, redis.Z{
-		Score:  float64(executeTime),
-		Member: task,
-	}).Err()
+func addTaskToQueue(queue *DelayQueue, topic string, payload interface{}, dueAt time.Time) {
+	task, err := queue.Add(context.TODO(), topic, payload, dueAt)
 	if err != nil {
 		panic(err)
 	}
+	log.Infof("add task %s, topic: %s", task.Id, task.Topic)
 }
 
-// 从redis中取一个task并执行
-func getAndExecuteTask() {
-	for {
-		tasks, err := redisdb.ZRangeByScore(DelayQueueKey, redis.ZRangeBy{
-			Min:    "-inf",
-			Max:    fmt.Sprintf("%d", time.Now().Unix()),
-			Offset: 0,
-			Count:  1,
-		}).Result()
-		if err != nil {
-			time.Sleep(time.Second * 1)
-			continue
-		}
-		//处理任务
-		for _, task := range tasks {
-			fmt.Println("Execute task: ", task)
-			//执行完任务之后用 ZREM 移除该任务
-			redisdb.ZRem(DelayQueueKey, task)
-		}
-		time.Sleep(time.Second * 1)
+func addSchedule(scheduler *Scheduler, schedule *Schedule) {
+	err := scheduler.AddSchedule(context.TODO(), schedule)
+	if err != nil {
+		panic(err)
 	}
 }
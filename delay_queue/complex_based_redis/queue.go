@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"myTest/demo_home/redis_demo/redis_store"
+	"time"
+)
+
+/*
+可靠的延迟队列，任务在redis中的状态：
+1. 任务数据：DelayQueueKey:tasks（hash，field为任务id，value为任务的json），zset中只保存任务id
+2. 等待执行：DelayQueueKey（zset，score为执行时间，单位ms）
+3. 执行中：DelayQueueKey:processing（zset，score为可见性超时时间），到期的任务在同一个lua脚本里从等待队列移到执行中，多个worker不会拿到同一个任务
+4. 执行成功后ack删除任务；执行失败nack或者超时未ack时重新放回等待队列，重试次数记录在DelayQueueKey:retry（hash）
+5. 重试次数超过maxRetry后放入死信队列DelayQueueKey:dead（zset，score为进入死信队列的时间），任务数据和重试次数保留
+6. 新增任务时往DelayQueueKey:notify中写入通知，空闲的worker通过BLPOP等待，不需要固定间隔轮询
+7. 各个状态变化的次数在lua脚本中累加到DelayQueueKey:stats（hash），用于监控
+*/
+
+// Task 任务信封，Payload为业务数据的json，时间的单位为ms
+type Task struct {
+	Id      string          `json:"id"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+	// 第几次执行，从1开始，由重试次数计算，不保存在任务数据中
+	Attempt   int64 `json:"attempt,omitempty"`
+	CreatedAt int64 `json:"createdAt"`
+	DueAt     int64 `json:"dueAt"`
+}
+
+// Decode 把Payload解析到v中
+func (t *Task) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+type DelayQueue struct {
+	key           string
+	processingKey string
+	retryKey      string
+	deadKey       string
+	tasksKey      string
+	notifyKey     string
+	statsKey      string
+	// 任务被取走后多久没有ack就重新投递
+	visibilityTimeout time.Duration
+	// 失败后延迟多久重试
+	retryDelay time.Duration
+	maxRetry   int64
+	redisCli   redis_store.Client
+}
+
+func NewDelayQueue(cli redis_store.Client, key string) *DelayQueue {
+	return &DelayQueue{
+		key:               key,
+		processingKey:     key + ":processing",
+		retryKey:          key + ":retry",
+		deadKey:           key + ":dead",
+		tasksKey:          key + ":tasks",
+		notifyKey:         key + ":notify",
+		statsKey:          key + ":stats",
+		visibilityTimeout: time.Second * 30,
+		retryDelay:        time.Second * 5,
+		maxRetry:          3,
+		redisCli:          cli,
+	}
+}
+
+func (q *DelayQueue) SetVisibilityTimeout(d time.Duration) {
+	q.visibilityTimeout = d
+}
+
+func (q *DelayQueue) SetRetryDelay(d time.Duration) {
+	q.retryDelay = d
+}
+
+func (q *DelayQueue) SetMaxRetry(maxRetry int64) {
+	q.maxRetry = maxRetry
+}
+
+func (q *DelayQueue) keys() []string {
+	return []string{q.key, q.processingKey, q.retryKey, q.deadKey, q.tasksKey, q.notifyKey, q.statsKey}
+}
+
+// 保存任务数据并加入等待队列，通知list最多保留100条，避免没有worker时无限增长
+// ARGV: 任务id, 任务数据, 执行时间
+var addCmd = "redis.call('hset', KEYS[5], ARGV[1], ARGV[2]) " +
+	"redis.call('zadd', KEYS[1], ARGV[3], ARGV[1]) " +
+	"redis.call('rpush', KEYS[6], ARGV[1]) " +
+	"redis.call('ltrim', KEYS[6], 0, 99) " +
+	"redis.call('hincrby', KEYS[7], 'enqueued', 1) " +
+	"return 1"
+
+// 取出到期的任务放入执行中，ARGV: 当前时间, 可见性超时时间, 最多取出的个数
+// 返回值：{任务数据, 重试次数, ...}，任务数据已经不存在的直接丢弃
+var claimCmd = "local ids = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3]) " +
+	"local result = {} " +
+	"for _, id in ipairs(ids) do " +
+	"   redis.call('zrem', KEYS[1], id) " +
+	"   local data = redis.call('hget', KEYS[5], id) " +
+	"   if data then " +
+	"       redis.call('zadd', KEYS[2], ARGV[1] + ARGV[2], id) " +
+	"       table.insert(result, data) " +
+	"       table.insert(result, tonumber(redis.call('hget', KEYS[3], id) or '0')) " +
+	"   end " +
+	"end " +
+	"return result"
+
+// 执行成功，删除任务，已经超时被重新投递时返回0
+var ackCmd = "local removed = redis.call('zrem', KEYS[2], ARGV[1]) " +
+	"if removed == 1 then " +
+	"   redis.call('hdel', KEYS[3], ARGV[1]) " +
+	"   redis.call('hdel', KEYS[5], ARGV[1]) " +
+	"   redis.call('hincrby', KEYS[7], 'acked', 1) " +
+	"end " +
+	"return removed"
+
+// 执行失败，重试次数加1后重新放回等待队列，超过最大重试次数时放入死信队列，重试次数保留给管理接口查询
+// ARGV: 任务id, 当前时间, 重试延迟, 最大重试次数
+// 返回值：0 任务不在执行中，1 重新放回等待队列，2 放入死信队列
+var nackCmd = "if redis.call('zrem', KEYS[2], ARGV[1]) == 0 then " +
+	"   return 0 " +
+	"end " +
+	"redis.call('hincrby', KEYS[7], 'nacked', 1) " +
+	"local retry = redis.call('hincrby', KEYS[3], ARGV[1], 1) " +
+	"if retry > tonumber(ARGV[4]) then " +
+	"   redis.call('zadd', KEYS[4], ARGV[2], ARGV[1]) " +
+	"   redis.call('hincrby', KEYS[7], 'dead', 1) " +
+	"   return 2 " +
+	"end " +
+	"redis.call('zadd', KEYS[1], ARGV[2] + ARGV[3], ARGV[1]) " +
+	"return 1"
+
+// 可见性超时未ack的任务当作执行失败处理，ARGV: 当前时间, 重试延迟, 最大重试次数
+var redeliverCmd = "local ids = redis.call('zrangebyscore', KEYS[2], '-inf', ARGV[1]) " +
+	"for _, id in ipairs(ids) do " +
+	"   redis.call('zrem', KEYS[2], id) " +
+	"   local retry = redis.call('hincrby', KEYS[3], id, 1) " +
+	"   if retry > tonumber(ARGV[3]) then " +
+	"       redis.call('zadd', KEYS[4], ARGV[1], id) " +
+	"       redis.call('hincrby', KEYS[7], 'dead', 1) " +
+	"   else " +
+	"       redis.call('zadd', KEYS[1], ARGV[1] + ARGV[2], id) " +
+	"   end " +
+	"end " +
+	"redis.call('hincrby', KEYS[7], 'redelivered', #ids) " +
+	"return #ids"
+
+// Add 新增一个任务，dueAt为执行时间，支持ms级别的延迟
+func (q *DelayQueue) Add(ctx context.Context, topic string, payload interface{}, dueAt time.Time) (*Task, error) {
+	return q.AddWithId(ctx, uuid.New().String(), topic, payload, dueAt)
+}
+
+// AddWithId 指定任务id新增任务，id相同的任务只会保留最后一次写入的，可以用来保证幂等
+func (q *DelayQueue) AddWithId(ctx context.Context, id, topic string, payload interface{}, dueAt time.Time) (*Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	task := &Task{
+		Id:        id,
+		Topic:     topic,
+		Payload:   data,
+		CreatedAt: time.Now().UnixMilli(),
+		DueAt:     dueAt.UnixMilli(),
+	}
+	marshal, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	_, err = q.redisCli.Eval(ctx, addCmd, q.keys(), task.Id, string(marshal), task.DueAt)
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Claim 取出最多n个到期的任务，取出的任务需要在可见性超时时间内ack或者nack
+func (q *DelayQueue) Claim(ctx context.Context, n int) ([]*Task, error) {
+	result, err := q.redisCli.Eval(ctx, claimCmd, q.keys(), time.Now().UnixMilli(), q.visibilityTimeout.Milliseconds(), n)
+	if err != nil {
+		return nil, err
+	}
+	reply := result.([]interface{})
+	tasks := make([]*Task, 0, len(reply)/2)
+	for i := 0; i < len(reply); i += 2 {
+		task := new(Task)
+		if err = json.Unmarshal([]byte(reply[i].(string)), task); err != nil {
+			return nil, err
+		}
+		task.Attempt = reply[i+1].(int64) + 1
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// Ack 任务执行成功，任务已经超时被重新投递时返回false
+func (q *DelayQueue) Ack(ctx context.Context, id string) (bool, error) {
+	result, err := q.redisCli.Eval(ctx, ackCmd, q.keys(), id)
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+// Nack 任务执行失败，返回任务是否进入了死信队列
+func (q *DelayQueue) Nack(ctx context.Context, id string) (bool, error) {
+	result, err := q.redisCli.Eval(ctx, nackCmd, q.keys(), id, time.Now().UnixMilli(), q.retryDelay.Milliseconds(), q.maxRetry)
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 2, nil
+}
+
+// Redeliver 重新投递可见性超时的任务，返回处理的任务个数
+func (q *DelayQueue) Redeliver(ctx context.Context) (int64, error) {
+	result, err := q.redisCli.Eval(ctx, redeliverCmd, q.keys(), time.Now().UnixMilli(), q.retryDelay.Milliseconds(), q.maxRetry)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// NextDue 最早到期的任务的执行时间，队列为空时返回false
+func (q *DelayQueue) NextDue(ctx context.Context) (time.Time, bool, error) {
+	zs, err := q.redisCli.ZRangeByScoreWithScores(ctx, q.key, redis_store.ZRangeBy{
+		Min:   "-inf",
+		Max:   "+inf",
+		Count: 1,
+	})
+	if err != nil || len(zs) == 0 {
+		return time.Time{}, false, err
+	}
+	return time.UnixMilli(int64(zs[0].Score)), true, nil
+}
+
+// WaitNotify 等待新任务的通知，收到通知或者超时后返回
+func (q *DelayQueue) WaitNotify(ctx context.Context, timeout time.Duration) error {
+	_, err := q.redisCli.BLPop(ctx, timeout, q.notifyKey)
+	if err == redis_store.Nil {
+		return nil
+	}
+	return err
+}
+
+// Scheduled 任务是否在等待队列或者执行中
+func (q *DelayQueue) Scheduled(ctx context.Context, id string) (bool, error) {
+	for _, key := range []string{q.key, q.processingKey} {
+		_, err := q.redisCli.ZScore(ctx, key, id)
+		if err == nil {
+			return true, nil
+		}
+		if err != redis_store.Nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
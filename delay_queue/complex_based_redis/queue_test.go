@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestQueue() (*DelayQueue, *redis_store.Memory) {
+	m := redis_store.NewMemory()
+	return NewDelayQueue(m, "test-queue"), m
+}
+
+func TestClaimOnce(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	for i := 0; i < 20; i++ {
+		if _, err := q.Add(ctx, "topic", i, time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//多个worker同时取任务，每个任务只会被一个worker取到
+	var mu sync.Mutex
+	claimed := make(map[string]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				tasks, err := q.Claim(ctx, 3)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(tasks) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, task := range tasks {
+					claimed[task.Id]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(claimed) != 20 {
+		t.Fatalf("claimed %d tasks, want 20", len(claimed))
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Fatalf("task %s claimed %d times", id, n)
+		}
+	}
+}
+
+func TestRedeliverAfterVisibilityTimeout(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	q.SetVisibilityTimeout(time.Millisecond * 10)
+	q.SetRetryDelay(0)
+	task, _ := q.Add(ctx, "topic", "data", time.Now())
+
+	tasks, _ := q.Claim(ctx, 1)
+	if len(tasks) != 1 || tasks[0].Attempt != 1 {
+		t.Fatalf("claim = %v", tasks)
+	}
+	//可见性超时之前不重新投递
+	if n, _ := q.Redeliver(ctx); n != 0 {
+		t.Fatalf("redeliver before timeout = %d", n)
+	}
+	time.Sleep(time.Millisecond * 20)
+	if n, _ := q.Redeliver(ctx); n != 1 {
+		t.Fatalf("redeliver after timeout = %d", n)
+	}
+	//超时后ack失败，任务已经重新投递
+	if ok, _ := q.Ack(ctx, task.Id); ok {
+		t.Fatal("ack after redelivery should return false")
+	}
+	tasks, _ = q.Claim(ctx, 1)
+	if len(tasks) != 1 || tasks[0].Id != task.Id || tasks[0].Attempt != 2 {
+		t.Fatalf("claim after redelivery = %v", tasks)
+	}
+	if ok, _ := q.Ack(ctx, task.Id); !ok {
+		t.Fatal("ack of claimed task should return true")
+	}
+	if scheduled, _ := q.Scheduled(ctx, task.Id); scheduled {
+		t.Fatal("acked task is still scheduled")
+	}
+}
+
+func TestNackDeadLetter(t *testing.T) {
+	ctx := context.TODO()
+	q, m := newTestQueue()
+	q.SetRetryDelay(0)
+	q.SetMaxRetry(2)
+	task, _ := q.Add(ctx, "topic", "data", time.Now())
+
+	for attempt := int64(1); attempt <= 3; attempt++ {
+		tasks, _ := q.Claim(ctx, 1)
+		if len(tasks) != 1 || tasks[0].Attempt != attempt {
+			t.Fatalf("attempt %d claim = %v", attempt, tasks)
+		}
+		dead, err := q.Nack(ctx, task.Id)
+		if err != nil || dead != (attempt == 3) {
+			t.Fatalf("attempt %d nack = %v, %v", attempt, dead, err)
+		}
+	}
+	//超过最大重试次数后进入死信队列，任务数据保留
+	if _, err := m.ZScore(ctx, "test-queue:dead", task.Id); err != nil {
+		t.Fatalf("task is not in dead queue: %v", err)
+	}
+	if _, err := m.HGet(ctx, "test-queue:tasks", task.Id); err != nil {
+		t.Fatalf("task data of dead task: %v", err)
+	}
+	if scheduled, _ := q.Scheduled(ctx, task.Id); scheduled {
+		t.Fatal("dead task is still scheduled")
+	}
+	//不在执行中的任务nack无效
+	if dead, _ := q.Nack(ctx, task.Id); dead {
+		t.Fatal("nack of dead task")
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	log "github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/distributed_lock/lock"
+	"myTest/demo_home/redis_demo/redis_store"
+	"time"
+)
+
+/*
+基于延迟队列实现定时任务：
+1. 定时任务的配置保存在DelayQueueKey:schedules（hash），下一次触发时间保存在DelayQueueKey:schedules:next（hash），服务重启后不会丢失
+2. 每个定时任务同时只有一个触发任务在延迟队列中，topic为cronTopic，任务id为 cron:名称:触发时间，重复写入是幂等的
+3. 触发时先在lua脚本里把下一次触发时间从本次推进到下一次，再写入下一次的触发任务，然后执行定时任务；
+   执行失败重试时下一次触发时间已经推进过，只执行不再推进；修改或者删除定时任务后，旧的触发任务直接丢弃
+   管理接口取消触发任务时通过Skip推进到下一次，定时任务不会中断
+4. 同一个定时任务执行时加分布式锁，上一次还没执行完时跳过本次，避免重叠执行
+*/
+
+const cronTopic = "cron"
+
+// cron表达式支持标准的5位格式和@every 5m、@daily等描述符
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule 定时任务，到时间后按Topic和Payload执行Worker中注册的Handler
+type Schedule struct {
+	Name string `json:"name"`
+	Spec string `json:"spec"`
+	// 时区，例如Asia/Shanghai，为空时使用UTC
+	TimeZone string          `json:"timeZone"`
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Next 计算after之后的下一次触发时间
+func (s *Schedule) Next(after time.Time) (time.Time, error) {
+	loc := time.UTC
+	if s.TimeZone != "" {
+		l, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+	spec, err := cronParser.Parse(s.Spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := spec.Next(after.In(loc))
+	if next.IsZero() {
+		return next, fmt.Errorf("schedule %s never fires", s.Name)
+	}
+	return next, nil
+}
+
+type cronFire struct {
+	Name   string `json:"name"`
+	FireAt int64  `json:"fireAt"`
+}
+
+type Scheduler struct {
+	queue        *DelayQueue
+	worker       *Worker
+	schedulesKey string
+	nextKey      string
+	redisCli     redis_store.Client
+}
+
+// NewScheduler 在worker上注册cronTopic的Handler，定时任务由worker执行
+func NewScheduler(cli redis_store.Client, queue *DelayQueue, worker *Worker) *Scheduler {
+	s := &Scheduler{
+		queue:        queue,
+		worker:       worker,
+		schedulesKey: queue.key + ":schedules",
+		nextKey:      queue.key + ":schedules:next",
+		redisCli:     cli,
+	}
+	worker.Register(cronTopic, s.fire)
+	return s
+}
+
+func fireTaskId(name string, fireAt int64) string {
+	return fmt.Sprintf("cron:%s:%d", name, fireAt)
+}
+
+// AddSchedule 新增或者修改定时任务，修改后按新的配置重新计算下一次触发时间
+func (s *Scheduler) AddSchedule(ctx context.Context, schedule *Schedule) error {
+	next, err := schedule.Next(time.Now())
+	if err != nil {
+		return err
+	}
+	marshal, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	if _, err = s.redisCli.HSet(ctx, s.schedulesKey, schedule.Name, string(marshal)); err != nil {
+		return err
+	}
+	if _, err = s.redisCli.HSet(ctx, s.nextKey, schedule.Name, next.UnixMilli()); err != nil {
+		return err
+	}
+	return s.enqueue(ctx, schedule.Name, next.UnixMilli())
+}
+
+// RemoveSchedule 删除定时任务，已经在队列中的触发任务执行时会被丢弃
+func (s *Scheduler) RemoveSchedule(ctx context.Context, name string) error {
+	if _, err := s.redisCli.HDel(ctx, s.schedulesKey, name); err != nil {
+		return err
+	}
+	_, err := s.redisCli.HDel(ctx, s.nextKey, name)
+	return err
+}
+
+func (s *Scheduler) getSchedule(ctx context.Context, name string) (*Schedule, error) {
+	result, err := s.redisCli.HGet(ctx, s.schedulesKey, name)
+	if err != nil {
+		return nil, err
+	}
+	schedule := new(Schedule)
+	if err = json.Unmarshal([]byte(result), schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *Scheduler) enqueue(ctx context.Context, name string, fireAt int64) error {
+	_, err := s.queue.AddWithId(ctx, fireTaskId(name, fireAt), cronTopic, &cronFire{Name: name, FireAt: fireAt}, time.UnixMilli(fireAt))
+	return err
+}
+
+// Start 服务启动时检查所有定时任务，下一次的触发任务不在队列中时重新写入
+func (s *Scheduler) Start(ctx context.Context) error {
+	schedules, err := s.redisCli.HGetAll(ctx, s.schedulesKey)
+	if err != nil {
+		return err
+	}
+	for name := range schedules {
+		result, err := s.redisCli.HGet(ctx, s.nextKey, name)
+		if err == redis_store.Nil {
+			schedule, err := s.getSchedule(ctx, name)
+			if err != nil {
+				return err
+			}
+			if err = s.AddSchedule(ctx, schedule); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var fireAt int64
+		if _, err = fmt.Sscan(result, &fireAt); err != nil {
+			return err
+		}
+		scheduled, err := s.queue.Scheduled(ctx, fireTaskId(name, fireAt))
+		if err != nil {
+			return err
+		}
+		if !scheduled {
+			if err = s.enqueue(ctx, name, fireAt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 推进下一次触发时间，ARGV: 名称, 本次触发时间, 下一次触发时间, 第几次执行
+// 返回需要写入队列的下一次触发时间：推进成功时为新的触发时间；
+// 执行失败重试时已经推进过，返回已经推进的触发时间；触发任务已经过时（定时任务被修改）时返回0
+var advanceCmd = "local cur = redis.call('hget', KEYS[1], ARGV[1]) " +
+	"if cur == ARGV[2] then " +
+	"   redis.call('hset', KEYS[1], ARGV[1], ARGV[3]) " +
+	"   return tonumber(ARGV[3]) " +
+	"end " +
+	"if cur and tonumber(ARGV[4]) > 1 and tonumber(cur) > tonumber(ARGV[2]) then " +
+	"   return tonumber(cur) " +
+	"end " +
+	"return 0"
+
+// advance 计算fireAt之后的下一次触发时间并推进，返回值同advanceCmd
+func (s *Scheduler) advance(ctx context.Context, schedule *Schedule, fireAt, attempt int64) (int64, error) {
+	next, err := schedule.Next(time.UnixMilli(fireAt))
+	if err != nil {
+		return 0, err
+	}
+	//错过的触发时间只执行一次，下一次触发时间从当前时间开始计算
+	if next.Before(time.Now()) {
+		if next, err = schedule.Next(time.Now()); err != nil {
+			return 0, err
+		}
+	}
+	result, err := s.redisCli.Eval(ctx, advanceCmd, []string{s.nextKey}, schedule.Name, fireAt, next.UnixMilli(), attempt)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// Skip 取消定时任务的一次触发，同时写入下一次的触发任务；
+// 直接通过Cancel取消cron:名称:触发时间的任务会中断定时任务，直到下一次调用Start
+func (s *Scheduler) Skip(ctx context.Context, id string) (bool, error) {
+	info, err := s.queue.Get(ctx, id)
+	if err == redis_store.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	f := new(cronFire)
+	if err = info.Decode(f); err != nil {
+		return false, err
+	}
+	schedule, err := s.getSchedule(ctx, f.Name)
+	if err != nil && err != redis_store.Nil {
+		return false, err
+	}
+	//定时任务已经删除，或者这次触发已经推进过（执行中、死信队列中、已经过时）时只取消
+	if err == nil {
+		nextAt, err := s.advance(ctx, schedule, f.FireAt, 1)
+		if err != nil {
+			return false, err
+		}
+		if nextAt != 0 {
+			if err = s.enqueue(ctx, f.Name, nextAt); err != nil {
+				return false, err
+			}
+		}
+	}
+	return s.queue.Cancel(ctx, id)
+}
+
+func (s *Scheduler) fire(ctx context.Context, task *Task) error {
+	f := new(cronFire)
+	if err := task.Decode(f); err != nil {
+		return err
+	}
+	schedule, err := s.getSchedule(ctx, f.Name)
+	if err == redis_store.Nil {
+		log.Infof("schedule %s has been removed", f.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	nextAt, err := s.advance(ctx, schedule, f.FireAt, task.Attempt)
+	if err != nil {
+		return err
+	}
+	if nextAt == 0 {
+		log.Infof("schedule %s fire at %d is outdated", f.Name, f.FireAt)
+		return nil
+	}
+	//重试时下一次的触发任务不在队列中也写入一次，防止上次推进后还没写入就宕机了
+	scheduled, err := s.queue.Scheduled(ctx, fireTaskId(f.Name, nextAt))
+	if err != nil {
+		return err
+	}
+	if !scheduled {
+		if err = s.enqueue(ctx, f.Name, nextAt); err != nil {
+			return err
+		}
+	}
+	jobLock := lock.NewRedisLock(s.redisCli, s.schedulesKey+":lock:"+f.Name)
+	if !jobLock.TryLock() {
+		log.Infof("schedule %s is still running, skip fire at %d", f.Name, f.FireAt)
+		return nil
+	}
+	defer jobLock.Unlock()
+	return s.worker.execute(ctx, &Task{
+		Id:        task.Id,
+		Topic:     schedule.Topic,
+		Payload:   schedule.Payload,
+		Attempt:   task.Attempt,
+		CreatedAt: task.CreatedAt,
+		DueAt:     f.FireAt,
+	})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/distributed_lock/lock"
+	"myTest/demo_home/redis_demo/redis_store"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testScheduler struct {
+	*Scheduler
+	m *redis_store.Memory
+	// 定时任务执行时收到的任务
+	fired []*Task
+}
+
+func newTestScheduler() *testScheduler {
+	q, m := newTestQueue()
+	q.SetRetryDelay(0)
+	return startTestScheduler(q, m)
+}
+
+func startTestScheduler(q *DelayQueue, m *redis_store.Memory) *testScheduler {
+	w := NewWorker(q)
+	s := &testScheduler{Scheduler: NewScheduler(m, q, w), m: m}
+	w.Register("job", func(ctx context.Context, task *Task) error {
+		s.fired = append(s.fired, task)
+		return nil
+	})
+	return s
+}
+
+// fireNow 立即执行定时任务的触发任务
+func (s *testScheduler) fireNow(t *testing.T, name string, fireAt int64) {
+	ctx := context.TODO()
+	if ok, err := s.queue.FireNow(ctx, fireTaskId(name, fireAt)); !ok || err != nil {
+		t.Fatalf("fire now %s at %d = %v, %v", name, fireAt, ok, err)
+	}
+	tasks, err := s.queue.Claim(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range tasks {
+		s.worker.handle(ctx, task)
+	}
+}
+
+func (s *testScheduler) nextAt(t *testing.T, name string) int64 {
+	result, err := s.m.HGet(context.TODO(), s.nextKey, name)
+	if err != nil {
+		t.Fatalf("next fire time of %s: %v", name, err)
+	}
+	fireAt, _ := strconv.ParseInt(result, 10, 64)
+	return fireAt
+}
+
+func (s *testScheduler) scheduled(t *testing.T, name string, fireAt int64) bool {
+	scheduled, err := s.queue.Scheduled(context.TODO(), fireTaskId(name, fireAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduled
+}
+
+func TestScheduleAdvance(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestScheduler()
+	if err := s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 1h", Topic: "job"}); err != nil {
+		t.Fatal(err)
+	}
+	fireAt := s.nextAt(t, "a")
+	if !s.scheduled(t, "a", fireAt) {
+		t.Fatal("first fire is not scheduled")
+	}
+
+	s.fireNow(t, "a", fireAt)
+	if len(s.fired) != 1 || s.fired[0].DueAt != fireAt {
+		t.Fatalf("fired = %v", s.fired)
+	}
+	//执行时推进到下一次，并写入下一次的触发任务
+	next := fireAt + time.Hour.Milliseconds()
+	if got := s.nextAt(t, "a"); got != next {
+		t.Fatalf("next fire time = %d, want %d", got, next)
+	}
+	if s.scheduled(t, "a", fireAt) || !s.scheduled(t, "a", next) {
+		t.Fatal("fire task is not replaced by the next one")
+	}
+
+	//执行失败重试时只执行，不再推进
+	retry := &Task{Id: fireTaskId("a", fireAt), Topic: cronTopic, Attempt: 2}
+	retry.Payload = []byte(`{"name":"a","fireAt":` + strconv.FormatInt(fireAt, 10) + `}`)
+	if err := s.fire(ctx, retry); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.fired) != 2 || s.nextAt(t, "a") != next {
+		t.Fatalf("retry fired %d times, next fire time %d", len(s.fired), s.nextAt(t, "a"))
+	}
+	//重复投递的第一次执行已经过时，直接丢弃
+	retry.Attempt = 1
+	if err := s.fire(ctx, retry); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.fired) != 2 {
+		t.Fatal("duplicated fire is executed")
+	}
+}
+
+func TestScheduleMissedFire(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestScheduler()
+	if err := s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 1m", Topic: "job"}); err != nil {
+		t.Fatal(err)
+	}
+	//服务停了一个小时，错过的触发时间只执行一次，下一次从当前时间开始计算
+	missed := time.Now().Add(-time.Hour).UnixMilli()
+	s.m.HSet(ctx, s.nextKey, "a", missed)
+	if err := s.enqueue(ctx, "a", missed); err != nil {
+		t.Fatal(err)
+	}
+	s.fireNow(t, "a", missed)
+	if len(s.fired) != 1 {
+		t.Fatalf("missed fire executed %d times", len(s.fired))
+	}
+	next := s.nextAt(t, "a")
+	if next <= time.Now().UnixMilli() || !s.scheduled(t, "a", next) {
+		t.Fatalf("next fire time %d is not in the future", next)
+	}
+}
+
+func TestScheduleOutdated(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestScheduler()
+	s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 1h", Topic: "job"})
+	old := s.nextAt(t, "a")
+	//修改定时任务后旧的触发任务过时
+	s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 2h", Topic: "job"})
+	next := s.nextAt(t, "a")
+	if next == old {
+		t.Fatal("next fire time is not recalculated")
+	}
+	s.fireNow(t, "a", old)
+	if len(s.fired) != 0 {
+		t.Fatal("outdated fire is executed")
+	}
+	if s.nextAt(t, "a") != next || s.scheduled(t, "a", old) || !s.scheduled(t, "a", next) {
+		t.Fatal("outdated fire changed the schedule")
+	}
+
+	//删除定时任务后触发任务直接丢弃
+	if err := s.RemoveSchedule(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	s.fireNow(t, "a", next)
+	if len(s.fired) != 0 || s.scheduled(t, "a", next) {
+		t.Fatal("fire of removed schedule is executed")
+	}
+}
+
+func TestScheduleOverlap(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestScheduler()
+	s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 1h", Topic: "job"})
+	fireAt := s.nextAt(t, "a")
+	//上一次还在执行中，跳过本次，但是仍然推进到下一次
+	running := lock.NewRedisLock(s.m, s.schedulesKey+":lock:a")
+	if !running.TryLock() {
+		t.Fatal("lock job")
+	}
+	s.fireNow(t, "a", fireAt)
+	running.Unlock()
+	if len(s.fired) != 0 {
+		t.Fatal("overlapped fire is executed")
+	}
+	next := fireAt + time.Hour.Milliseconds()
+	if s.nextAt(t, "a") != next || !s.scheduled(t, "a", next) {
+		t.Fatal("skipped fire did not schedule the next one")
+	}
+	s.fireNow(t, "a", next)
+	if len(s.fired) != 1 {
+		t.Fatal("fire after the overlap is not executed")
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		timeZone string
+		want     time.Time
+	}{
+		{"", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)},
+		{"Asia/Shanghai", time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)},
+	} {
+		s := &Schedule{Name: "report", Spec: "30 9 * * *", TimeZone: c.timeZone}
+		next, err := s.Next(after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !next.Equal(c.want) {
+			t.Fatalf("time zone %q next = %s, want %s", c.timeZone, next.UTC(), c.want)
+		}
+	}
+	s := &Schedule{Name: "report", Spec: "30 9 * * *", TimeZone: "Mars/Olympus"}
+	if _, err := s.Next(after); err == nil {
+		t.Fatal("unknown time zone should fail")
+	}
+}
+
+func TestScheduleRestore(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestScheduler()
+	s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 1h", Topic: "job"})
+	s.AddSchedule(ctx, &Schedule{Name: "b", Spec: "@every 1h", Topic: "job"})
+	fireAt := s.nextAt(t, "a")
+	//a的触发任务丢失，b的下一次触发时间丢失
+	s.queue.Cancel(ctx, fireTaskId("a", fireAt))
+	s.m.HDel(ctx, s.nextKey, "b")
+
+	restarted := startTestScheduler(s.queue, s.m)
+	if err := restarted.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.nextAt(t, "a") != fireAt || !restarted.scheduled(t, "a", fireAt) {
+		t.Fatal("fire of a is not restored")
+	}
+	if next := restarted.nextAt(t, "b"); !restarted.scheduled(t, "b", next) {
+		t.Fatal("fire of b is not restored")
+	}
+	restarted.fireNow(t, "a", fireAt)
+	if len(restarted.fired) != 1 {
+		t.Fatal("restored fire is not executed")
+	}
+}
+
+func TestScheduleSkip(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestScheduler()
+	s.AddSchedule(ctx, &Schedule{Name: "a", Spec: "@every 1h", Topic: "job"})
+	fireAt := s.nextAt(t, "a")
+	//取消一次触发后推进到下一次，定时任务不会中断
+	if ok, err := s.Skip(ctx, fireTaskId("a", fireAt)); !ok || err != nil {
+		t.Fatalf("skip = %v, %v", ok, err)
+	}
+	next := fireAt + time.Hour.Milliseconds()
+	if s.nextAt(t, "a") != next || s.scheduled(t, "a", fireAt) || !s.scheduled(t, "a", next) {
+		t.Fatal("skip did not schedule the next fire")
+	}
+	if ok, _ := s.Skip(ctx, fireTaskId("a", fireAt)); ok {
+		t.Fatal("skip of cancelled fire should return false")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	log "github.com/ziyifast/log"
+	"sync"
+	"time"
+)
+
+// Handler 处理一个topic的任务，返回错误时任务会延迟重试
+type Handler func(ctx context.Context, task *Task) error
+
+/*
+按topic分发任务：
+1. 每个topic注册一个Handler，没有注册的topic当作执行失败，重试多次后进入死信队列
+2. 没有到期的任务时，等待到最早的任务到期，等待期间有新任务加入会被BLPOP唤醒
+*/
+type Worker struct {
+	queue    *DelayQueue
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	// 每次最多取出的任务个数
+	batch int
+	// 最长等待时间，其他worker执行失败重新放回队列的任务不会发送通知，需要定时检查
+	maxWait time.Duration
+}
+
+func NewWorker(queue *DelayQueue) *Worker {
+	return &Worker{
+		queue:    queue,
+		handlers: make(map[string]Handler),
+		batch:    10,
+		maxWait:  time.Second * 5,
+	}
+}
+
+func (w *Worker) Register(topic string, handler Handler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[topic] = handler
+}
+
+func (w *Worker) handler(topic string) (Handler, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	h, ok := w.handlers[topic]
+	return h, ok
+}
+
+// Run 循环取出到期的任务并执行，直到ctx结束
+func (w *Worker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		//其他worker取走任务后宕机，超时后重新投递
+		if _, err := w.queue.Redeliver(ctx); err != nil {
+			log.Errorf("redeliver task err: %v", err)
+		}
+		tasks, err := w.queue.Claim(ctx, w.batch)
+		if err != nil {
+			log.Errorf("claim task err: %v", err)
+			w.sleep(ctx, time.Second)
+			continue
+		}
+		for _, task := range tasks {
+			w.handle(ctx, task)
+		}
+		if len(tasks) == 0 {
+			w.wait(ctx)
+		}
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, task *Task) {
+	err := w.execute(ctx, task)
+	if err == nil {
+		if _, err = w.queue.Ack(ctx, task.Id); err != nil {
+			log.Errorf("ack task %s err: %v", task.Id, err)
+		}
+		return
+	}
+	log.Errorf("execute task %s topic %s attempt %d err: %v", task.Id, task.Topic, task.Attempt, err)
+	dead, err := w.queue.Nack(ctx, task.Id)
+	if err != nil {
+		log.Errorf("nack task %s err: %v", task.Id, err)
+	} else if dead {
+		log.Errorf("task %s moved to dead letter queue", task.Id)
+	}
+}
+
+func (w *Worker) execute(ctx context.Context, task *Task) (err error) {
+	h, ok := w.handler(task.Topic)
+	if !ok {
+		return fmt.Errorf("no handler for topic %s", task.Topic)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("handler panic: %v", e)
+		}
+	}()
+	return h(ctx, task)
+}
+
+// wait 等待到最早的任务到期或者有新任务加入
+func (w *Worker) wait(ctx context.Context) {
+	wait := w.maxWait
+	next, ok, err := w.queue.NextDue(ctx)
+	if err != nil {
+		log.Errorf("query next task err: %v", err)
+	} else if ok {
+		if d := time.Until(next); d < wait {
+			wait = d
+		}
+	}
+	if wait <= 0 {
+		return
+	}
+	//BLPOP的超时时间最小为1s，不足1s时直接sleep
+	if wait < time.Second {
+		w.sleep(ctx, wait)
+		return
+	}
+	if err = w.queue.WaitNotify(ctx, wait.Truncate(time.Second)); err != nil && ctx.Err() == nil {
+		log.Errorf("wait notify err: %v", err)
+		w.sleep(ctx, time.Second)
+	}
+}
+
+func (w *Worker) sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
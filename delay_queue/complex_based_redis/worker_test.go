@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// runDue 取出所有到期的任务并执行
+func runDue(w *Worker) {
+	ctx := context.TODO()
+	tasks, _ := w.queue.Claim(ctx, 10)
+	for _, task := range tasks {
+		w.handle(ctx, task)
+	}
+}
+
+func TestWorkerDispatchByTopic(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	w := NewWorker(q)
+	got := make(map[string][]string)
+	for _, topic := range []string{"order.timeout", "sms.notify"} {
+		topic := topic
+		w.Register(topic, func(ctx context.Context, task *Task) error {
+			var s string
+			if err := task.Decode(&s); err != nil {
+				return err
+			}
+			got[topic] = append(got[topic], s)
+			return nil
+		})
+	}
+	q.Add(ctx, "order.timeout", "order", time.Now())
+	q.Add(ctx, "sms.notify", "sms", time.Now())
+	runDue(w)
+	if len(got["order.timeout"]) != 1 || got["order.timeout"][0] != "order" ||
+		len(got["sms.notify"]) != 1 || got["sms.notify"][0] != "sms" {
+		t.Fatalf("dispatched = %v", got)
+	}
+	stats, _ := q.Stats(ctx)
+	if stats.Counters["acked"] != 2 || stats.Tasks[StatePending] != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestWorkerUnknownTopic(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	q.SetRetryDelay(0)
+	q.SetMaxRetry(1)
+	w := NewWorker(q)
+	task, _ := q.Add(ctx, "unknown", "data", time.Now())
+	//没有注册的topic当作执行失败，重试后进入死信队列
+	runDue(w)
+	if info, _ := q.Get(ctx, task.Id); info == nil || info.State != StatePending || info.Retry != 1 {
+		t.Fatalf("after first attempt = %+v", info)
+	}
+	runDue(w)
+	if info, _ := q.Get(ctx, task.Id); info == nil || info.State != StateDead {
+		t.Fatalf("after retry = %+v", info)
+	}
+}
+
+func TestWorkerPanicNack(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	q.SetRetryDelay(0)
+	w := NewWorker(q)
+	attempts := 0
+	w.Register("topic", func(ctx context.Context, task *Task) error {
+		attempts++
+		if task.Attempt == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+	task, _ := q.Add(ctx, "topic", "data", time.Now())
+	//panic当作执行失败，重新放回等待队列后再次执行成功
+	runDue(w)
+	if info, _ := q.Get(ctx, task.Id); info == nil || info.Retry != 1 {
+		t.Fatalf("panicked task = %+v", info)
+	}
+	runDue(w)
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts)
+	}
+	if scheduled, _ := q.Scheduled(ctx, task.Id); scheduled {
+		t.Fatal("task is not acked after retry")
+	}
+	stats, _ := q.Stats(ctx)
+	if stats.Counters["nacked"] != 1 || stats.Counters["acked"] != 1 {
+		t.Fatalf("stats = %+v", stats.Counters)
+	}
+}
+
+func TestMillisecondDue(t *testing.T) {
+	ctx := context.TODO()
+	q, _ := newTestQueue()
+	dueAt := time.Now().Add(time.Millisecond * 300)
+	task, _ := q.Add(ctx, "topic", "data", dueAt)
+	next, ok, _ := q.NextDue(ctx)
+	if !ok || next.UnixMilli() != dueAt.UnixMilli() {
+		t.Fatalf("next due = %v, want %v", next, dueAt)
+	}
+	if tasks, _ := q.Claim(ctx, 1); len(tasks) != 0 {
+		t.Fatal("task is claimed before due")
+	}
+	time.Sleep(time.Until(next) + time.Millisecond)
+	tasks, _ := q.Claim(ctx, 1)
+	if len(tasks) != 1 || tasks[0].Id != task.Id {
+		t.Fatalf("claim after due = %v", tasks)
+	}
+}
+
+func TestWorkerWakeup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	q, _ := newTestQueue()
+	w := NewWorker(q)
+	executed := make(chan time.Time, 2)
+	w.Register("topic", func(ctx context.Context, task *Task) error {
+		executed <- time.Now()
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	//worker空闲时在BLPOP上等待maxWait，新任务加入后立即被唤醒
+	time.Sleep(time.Millisecond * 50)
+	q.Add(ctx, "topic", "now", time.Now())
+	select {
+	case <-executed:
+	case <-time.After(w.maxWait / 2):
+		t.Fatal("worker is not woken up by the new task")
+	}
+	//不足1s的延迟按到期时间sleep，不会按1s轮询
+	dueAt := time.Now().Add(time.Millisecond * 300).Truncate(time.Millisecond)
+	q.Add(ctx, "topic", "later", dueAt)
+	select {
+	case at := <-executed:
+		if at.Before(dueAt) {
+			t.Fatalf("task executed %s before due", dueAt.Sub(at))
+		}
+		if lag := at.Sub(dueAt); lag > time.Millisecond*500 {
+			t.Fatalf("task executed %s after due", lag)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("delayed task is not executed")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop after ctx is done")
+	}
+}
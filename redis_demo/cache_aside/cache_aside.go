@@ -0,0 +1,197 @@
+package cache_aside
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ziyifast/log"
+	"golang.org/x/sync/singleflight"
+	"math/rand"
+	"myTest/demo_home/redis_demo/redis_store"
+	"time"
+)
+
+/*
+旁路缓存，防止热点key击穿和缓存雪崩：
+1. singleflight：同一个服务内，同一个key同时只有一个goroutine查询数据源，其他goroutine等待结果
+2. 逻辑过期：缓存中记录逻辑过期时间，redis中的过期时间更长；逻辑过期后先返回旧数据，由一个goroutine异步刷新（多个服务之间通过setnx互斥）
+3. 过期时间加随机值，避免大量key同时过期
+4. 缓存空值：数据源中不存在的key写入一个过期时间很短的空值标记，防止缓存穿透，数据写入数据源后需要调用Del删除空值
+*/
+
+// ErrNotFound loader查询不到数据或者命中空值缓存时返回
+var ErrNotFound = errors.New("cache aside: not found")
+
+// Loader 从数据源加载key对应的数据，数据不存在时返回ErrNotFound
+type Loader[T any] func(ctx context.Context, key string) (T, error)
+
+type envelope[T any] struct {
+	Data T `json:"data"`
+	// 空值标记，数据源中不存在该数据
+	Miss bool `json:"miss,omitempty"`
+	// 逻辑过期时间，单位: ms
+	ExpireAt int64 `json:"expireAt"`
+}
+
+type Cache[T any] struct {
+	prefix string
+	loader Loader[T]
+	// 逻辑过期时间
+	ttl time.Duration
+	// 过期时间的随机范围[0, jitter)
+	jitter time.Duration
+	// 逻辑过期后在redis中继续保留的时间，这段时间内返回旧数据
+	grace time.Duration
+	// 空值的过期时间，默认为0不缓存空值，需要时通过SetMissTTL开启
+	missTTL time.Duration
+	// 异步刷新的互斥锁的过期时间
+	refreshLockTTL time.Duration
+	group          singleflight.Group
+	redisCli       redis_store.Client
+}
+
+func New[T any](cli redis_store.Client, prefix string, loader Loader[T], ttl time.Duration) *Cache[T] {
+	return &Cache[T]{
+		prefix:         prefix,
+		loader:         loader,
+		ttl:            ttl,
+		jitter:         ttl / 10,
+		grace:          ttl,
+		refreshLockTTL: time.Second * 10,
+		redisCli:       cli,
+	}
+}
+
+func (c *Cache[T]) SetJitter(d time.Duration) {
+	c.jitter = d
+}
+
+func (c *Cache[T]) SetGrace(d time.Duration) {
+	c.grace = d
+}
+
+func (c *Cache[T]) SetMissTTL(d time.Duration) {
+	c.missTTL = d
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.prefix + key
+}
+
+// Get 查询缓存，缓存不存在时通过loader加载；逻辑过期时返回旧数据并异步刷新
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+	result, err := c.redisCli.Get(ctx, c.key(key))
+	if err != nil && err != redis_store.Nil {
+		return zero, err
+	}
+	if err == nil {
+		e := new(envelope[T])
+		if err = json.Unmarshal([]byte(result), e); err == nil {
+			if e.Miss {
+				return zero, ErrNotFound
+			}
+			if time.Now().UnixMilli() >= e.ExpireAt {
+				c.refreshAsync(key)
+			}
+			return e.Data, nil
+		}
+		//缓存的数据格式不对，当作缓存不存在重新加载
+		log.Errorf("unmarshal cache %s err %v", c.key(key), err)
+	}
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		return c.load(ctx, key)
+	})
+	if err != nil {
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// refreshAsync 逻辑过期后异步刷新，同一个key在所有服务中只有一个goroutine刷新
+// 使用单独的singleflight key：没有抢到刷新锁时返回nil，不能让缓存不存在时的Get等待这个结果
+func (c *Cache[T]) refreshAsync(key string) {
+	go c.group.Do(key+":refresh", func() (interface{}, error) {
+		return c.refresh(context.TODO(), key)
+	})
+}
+
+// 只删除自己加的刷新锁，ARGV: 加锁时写入的token
+var releaseCmd = "if redis.call('get', KEYS[1]) == ARGV[1] then " +
+	"   return redis.call('del', KEYS[1]) " +
+	"end " +
+	"return 0"
+
+// refresh 抢到刷新锁后重新加载，没有抢到时返回nil；
+// 加载时间超过refreshLockTTL时锁可能已经被其他服务抢到，释放时通过token判断，不能直接del
+func (c *Cache[T]) refresh(ctx context.Context, key string) (interface{}, error) {
+	lockKey := c.key(key) + ":refresh"
+	token := uuid.New().String()
+	ok, err := c.redisCli.SetNX(ctx, lockKey, token, c.refreshLockTTL)
+	if err != nil || !ok {
+		return nil, err
+	}
+	defer func() {
+		if _, err := c.redisCli.Eval(ctx, releaseCmd, []string{lockKey}, token); err != nil {
+			log.Errorf("release refresh lock %s err %v", lockKey, err)
+		}
+	}()
+	v, err := c.load(ctx, key)
+	if err != nil && err != ErrNotFound {
+		log.Errorf("refresh cache %s err %v", c.key(key), err)
+	}
+	return v, err
+}
+
+func (c *Cache[T]) load(ctx context.Context, key string) (T, error) {
+	v, err := c.loader(ctx, key)
+	if err == ErrNotFound && c.missTTL > 0 {
+		if err := c.setMiss(ctx, key); err != nil {
+			log.Errorf("set miss cache %s err %v", c.key(key), err)
+		}
+	}
+	if err != nil {
+		return v, err
+	}
+	if err = c.Set(ctx, key, v); err != nil {
+		//写缓存失败不影响返回结果
+		log.Errorf("set cache %s err %v", c.key(key), err)
+	}
+	return v, nil
+}
+
+// Set 写入缓存，逻辑过期时间为ttl加上随机值
+func (c *Cache[T]) Set(ctx context.Context, key string, v T) error {
+	ttl := c.ttl
+	if c.jitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(c.jitter)))
+	}
+	marshal, err := json.Marshal(&envelope[T]{
+		Data:     v,
+		ExpireAt: time.Now().Add(ttl).UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	return c.redisCli.Set(ctx, c.key(key), string(marshal), ttl+c.grace)
+}
+
+// setMiss 写入空值标记，只在redis中短暂保留，过期后重新查询数据源
+func (c *Cache[T]) setMiss(ctx context.Context, key string) error {
+	ttl := c.missTTL
+	marshal, err := json.Marshal(&envelope[T]{
+		Miss:     true,
+		ExpireAt: time.Now().Add(ttl).UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	return c.redisCli.Set(ctx, c.key(key), string(marshal), ttl)
+}
+
+// Del 删除缓存（包括空值标记），数据源更新后调用
+func (c *Cache[T]) Del(ctx context.Context, key string) error {
+	_, err := c.redisCli.Del(ctx, c.key(key))
+	return err
+}
@@ -0,0 +1,218 @@
+package cache_aside
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myTest/demo_home/redis_demo/redis_store"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingClient SetNX前通知entered并等待release，用于让异步刷新停在抢锁的位置
+type blockingClient struct {
+	redis_store.Client
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	close(c.entered)
+	<-c.release
+	return c.Client.SetNX(ctx, key, value, expiration)
+}
+
+func TestGetDuringRefreshWithoutLock(t *testing.T) {
+	ctx := context.TODO()
+	mem := redis_store.NewMemory()
+	cli := &blockingClient{Client: mem, entered: make(chan struct{}), release: make(chan struct{})}
+	cache := New[[]string](cli, "players:", func(ctx context.Context, key string) ([]string, error) {
+		return []string{"fresh"}, nil
+	}, time.Minute)
+	cache.SetGrace(time.Minute)
+
+	//已经逻辑过期的旧数据，另一个服务持有刷新锁
+	stale, _ := json.Marshal(&envelope[[]string]{Data: []string{"stale"}, ExpireAt: time.Now().Add(-time.Second).UnixMilli()})
+	mem.Set(ctx, "players:k", string(stale), time.Minute)
+	mem.Set(ctx, "players:k:refresh", 1, time.Minute)
+
+	if v, err := cache.Get(ctx, "k"); err != nil || v[0] != "stale" {
+		t.Fatalf("get stale = %v, %v", v, err)
+	}
+	<-cli.entered
+	//刷新停在抢锁时key被删除，缓存不存在的Get不能拿到刷新的nil结果
+	mem.Del(ctx, "players:k")
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		v, err := cache.Get(ctx, "k")
+		if err == nil && (len(v) != 1 || v[0] != "fresh") {
+			err = fmt.Errorf("got %v", v)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		close(cli.release)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Millisecond * 100):
+		close(cli.release)
+		t.Fatal("get waited for the refresh flight")
+	}
+}
+
+func TestMissCache(t *testing.T) {
+	ctx := context.TODO()
+	loads := 0
+	found := false
+	cache := New[string](redis_store.NewMemory(), "player:", func(ctx context.Context, key string) (string, error) {
+		loads++
+		if !found {
+			return "", ErrNotFound
+		}
+		return "p1", nil
+	}, time.Minute)
+
+	//默认不缓存空值
+	cache.Get(ctx, "1")
+	cache.Get(ctx, "1")
+	if loads != 2 {
+		t.Fatalf("loads without miss ttl = %d, want 2", loads)
+	}
+
+	cache.SetMissTTL(time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get(ctx, "2"); err != ErrNotFound {
+			t.Fatalf("get missing err = %v", err)
+		}
+	}
+	if loads != 3 {
+		t.Fatalf("loads with miss ttl = %d, want 3", loads)
+	}
+
+	//写入数据源后删除空值缓存
+	found = true
+	if err := cache.Del(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := cache.Get(ctx, "2"); err != nil || v != "p1" {
+		t.Fatalf("get after del = %v, %v", v, err)
+	}
+}
+
+// countingClient 记录Get的次数，所有goroutine都查询过redis后通知missed
+type countingClient struct {
+	redis_store.Client
+	gets   int32
+	want   int32
+	missed chan struct{}
+}
+
+func (c *countingClient) Get(ctx context.Context, key string) (string, error) {
+	v, err := c.Client.Get(ctx, key)
+	if atomic.AddInt32(&c.gets, 1) == c.want {
+		close(c.missed)
+	}
+	return v, err
+}
+
+func TestSingleflightLoad(t *testing.T) {
+	ctx := context.TODO()
+	const n = 20
+	cli := &countingClient{Client: redis_store.NewMemory(), want: n, missed: make(chan struct{})}
+	var loads int32
+	cache := New[string](cli, "player:", func(ctx context.Context, key string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		//等所有goroutine都没有命中缓存后再返回
+		<-cli.missed
+		time.Sleep(time.Millisecond * 20)
+		return "p1", nil
+	}, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := cache.Get(ctx, "1"); err != nil || v != "p1" {
+				t.Errorf("get = %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("loads = %d, want 1", loads)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	ctx := context.TODO()
+	mem := redis_store.NewMemory()
+	ttl, jitter, grace := time.Minute, time.Second*10, time.Minute
+	cache := New[string](mem, "player:", nil, ttl)
+	cache.SetJitter(jitter)
+	cache.SetGrace(grace)
+	expires := make(map[int64]bool)
+	for i := 0; i < 50; i++ {
+		before := time.Now().UnixMilli()
+		if err := cache.Set(ctx, "1", "p1"); err != nil {
+			t.Fatal(err)
+		}
+		after := time.Now().UnixMilli()
+		result, _ := mem.Get(ctx, "player:1")
+		e := new(envelope[string])
+		json.Unmarshal([]byte(result), e)
+		//逻辑过期时间在[ttl, ttl+jitter)之间
+		if e.ExpireAt < before+ttl.Milliseconds() || e.ExpireAt >= after+(ttl+jitter).Milliseconds() {
+			t.Fatalf("expire after %dms, want [%s, %s)", e.ExpireAt-before, ttl, ttl+jitter)
+		}
+		//redis中的过期时间多保留grace
+		if d, _ := mem.TTL(ctx, "player:1"); d < ttl+grace-time.Second || d > ttl+grace+jitter {
+			t.Fatalf("redis ttl = %s", d)
+		}
+		expires[e.ExpireAt-before] = true
+	}
+	if len(expires) < 2 {
+		t.Fatal("expire time has no jitter")
+	}
+}
+
+func TestRefreshReleasesOwnLock(t *testing.T) {
+	ctx := context.TODO()
+	mem := redis_store.NewMemory()
+	lockKey := "player:1:refresh"
+	cache := New[string](mem, "player:", func(ctx context.Context, key string) (string, error) {
+		//加载时间超过refreshLockTTL，锁过期后被另一个服务抢到
+		mem.Del(ctx, lockKey)
+		mem.SetNX(ctx, lockKey, "other", time.Minute)
+		return "p1", nil
+	}, time.Minute)
+
+	if v, err := cache.refresh(ctx, "1"); err != nil || v != "p1" {
+		t.Fatalf("refresh = %v, %v", v, err)
+	}
+	if owner, err := mem.Get(ctx, lockKey); err != nil || owner != "other" {
+		t.Fatalf("refresh lock of another instance = %q, %v", owner, err)
+	}
+	//没有抢到锁时不加载
+	if v, err := cache.refresh(ctx, "1"); err != nil || v != nil {
+		t.Fatalf("refresh without lock = %v, %v", v, err)
+	}
+
+	mem.Del(ctx, lockKey)
+	cache.loader = func(ctx context.Context, key string) (string, error) {
+		return "p2", nil
+	}
+	cache.refresh(ctx, "1")
+	if n, _ := mem.Exists(ctx, lockKey); n != 0 {
+		t.Fatal("refresh lock is not released")
+	}
+}
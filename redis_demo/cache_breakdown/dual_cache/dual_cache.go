@@ -0,0 +1,195 @@
+package dual_cache
+
+import (
+	"context"
+	"errors"
+	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/distributed_lock/lock"
+	"myTest/demo_home/redis_demo/redis_store"
+	"sync/atomic"
+	"time"
+)
+
+/*
+双缓存（A/B两份list）防止缓存击穿：
+1. 指针key记录当前生效的是A还是B，读的时候在同一个lua脚本里读取指针和对应的list
+2. 重建时通过loader加载数据，写入备用的list后切换指针，写入和切换在同一个lua脚本里完成，读的一方不会读到写了一半的数据
+3. 过期时间错开：生效的list过期时间为ttl，切换后旧的list过期时间延长为ttl+stagger，重建失败时读取旧的数据兜底
+4. 生效的list剩余过期时间小于refreshBefore时触发重建，多个服务通过分布式锁保证只有一个在重建，
+   同一个服务内通过atomic标记保证只有一个异步重建在进行，热点key的每次读取不会都去抢锁
+*/
+
+var ErrEmptyLoad = errors.New("dual cache loader returned no data")
+
+// Loader 从数据源（数据库等）加载全部数据
+type Loader func(ctx context.Context) ([]string, error)
+
+type DualCache struct {
+	pointerKey string
+	bufferKeys []string
+	lockKey    string
+	loader     Loader
+	// 生效的list的过期时间
+	ttl time.Duration
+	// 备用list比生效的list多保留的时间
+	stagger time.Duration
+	// 剩余过期时间小于该值时触发重建
+	refreshBefore time.Duration
+	// 本服务是否有异步重建正在进行，通过atomic读写
+	rebuilding int32
+	redisCli   redis_store.Client
+}
+
+func New(cli redis_store.Client, name string, loader Loader, ttl time.Duration) *DualCache {
+	return &DualCache{
+		pointerKey:    name + ":active",
+		bufferKeys:    []string{name + ":A", name + ":B"},
+		lockKey:       name + ":rebuild",
+		loader:        loader,
+		ttl:           ttl,
+		stagger:       ttl / 2,
+		refreshBefore: ttl / 3,
+		redisCli:      cli,
+	}
+}
+
+func (c *DualCache) SetStagger(d time.Duration) {
+	c.stagger = d
+}
+
+func (c *DualCache) SetRefreshBefore(d time.Duration) {
+	c.refreshBefore = d
+}
+
+func (c *DualCache) keys() []string {
+	return []string{c.pointerKey, c.bufferKeys[0], c.bufferKeys[1]}
+}
+
+// 读取的lua脚本：生效的list不存在时读取备用的list
+// 返回值：{生效list的剩余过期时间(ms), 数据}，指针不存在时剩余过期时间为-2
+var rangeCmd = "local active = redis.call('get', KEYS[1]) " +
+	"if not active then " +
+	"   return {-2, {}} " +
+	"end " +
+	"local activeKey, standbyKey = KEYS[2], KEYS[3] " +
+	"if active == 'B' then " +
+	"   activeKey, standbyKey = KEYS[3], KEYS[2] " +
+	"end " +
+	"local ttl = redis.call('pttl', activeKey) " +
+	"if ttl == -2 then " +
+	"   return {ttl, redis.call('lrange', standbyKey, ARGV[1], ARGV[2])} " +
+	"end " +
+	"return {ttl, redis.call('lrange', activeKey, ARGV[1], ARGV[2])}"
+
+// LRange 读取生效的list，快过期时异步触发重建；生效的和备用的list都没有数据时同步重建
+func (c *DualCache) LRange(ctx context.Context, start, stop int64) ([]string, error) {
+	ttl, items, err := c.lrange(ctx, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == -2 && len(items) == 0 {
+		//第一次加载，或者两个list都已经过期，阻塞等待重建完成，不返回空的list
+		if err = c.rebuild(ctx, true); err != nil {
+			return nil, err
+		}
+		_, items, err = c.lrange(ctx, start, stop)
+		return items, err
+	}
+	if ttl != -1 && time.Duration(ttl)*time.Millisecond < c.refreshBefore && atomic.CompareAndSwapInt32(&c.rebuilding, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&c.rebuilding, 0)
+			if err := c.rebuild(context.TODO(), false); err != nil {
+				log.Errorf("rebuild %s err %v", c.pointerKey, err)
+			}
+		}()
+	}
+	return items, nil
+}
+
+func (c *DualCache) lrange(ctx context.Context, start, stop int64) (int64, []string, error) {
+	result, err := c.redisCli.Eval(ctx, rangeCmd, c.keys(), start, stop)
+	if err != nil {
+		return 0, nil, err
+	}
+	reply := result.([]interface{})
+	items := make([]string, 0)
+	for _, item := range reply[1].([]interface{}) {
+		items = append(items, item.(string))
+	}
+	return reply[0].(int64), items, nil
+}
+
+// 重建的lua脚本：重写备用的list、切换指针、延长旧list的过期时间
+// ARGV: ttl(ms), 旧list的过期时间(ms), 数据...
+var rebuildCmd = "local active = redis.call('get', KEYS[1]) " +
+	"local standby, activeKey, standbyKey = 'B', KEYS[2], KEYS[3] " +
+	"if active == 'B' then " +
+	"   standby, activeKey, standbyKey = 'A', KEYS[3], KEYS[2] " +
+	"end " +
+	"redis.call('del', standbyKey) " +
+	"for i = 3, #ARGV do " +
+	"   redis.call('rpush', standbyKey, ARGV[i]) " +
+	"end " +
+	"redis.call('pexpire', standbyKey, ARGV[1]) " +
+	"redis.call('set', KEYS[1], standby) " +
+	"if redis.call('exists', activeKey) == 1 then " +
+	"   redis.call('pexpire', activeKey, ARGV[2]) " +
+	"end " +
+	"return standby"
+
+// Rebuild 重新加载数据并切换缓存，已经有其他服务在重建时直接返回
+func (c *DualCache) Rebuild(ctx context.Context) error {
+	return c.rebuild(ctx, false)
+}
+
+func (c *DualCache) rebuild(ctx context.Context, wait bool) error {
+	rebuildLock := lock.NewRedisLock(c.redisCli, c.lockKey)
+	if wait {
+		rebuildLock.Lock()
+	} else if !rebuildLock.TryLock() {
+		return nil
+	}
+	defer rebuildLock.Unlock()
+	//拿到锁之后再检查一次，其他服务可能刚刚重建完成
+	ttl, _, err := c.lrange(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+	if ttl == -1 || time.Duration(ttl)*time.Millisecond >= c.refreshBefore {
+		return nil
+	}
+	items, err := c.loader(ctx)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		//不用空数据覆盖缓存，继续使用旧的数据
+		return ErrEmptyLoad
+	}
+	args := []interface{}{c.ttl.Milliseconds(), (c.ttl + c.stagger).Milliseconds()}
+	for _, item := range items {
+		args = append(args, item)
+	}
+	active, err := c.redisCli.Eval(ctx, rebuildCmd, c.keys(), args...)
+	if err != nil {
+		return err
+	}
+	log.Infof("rebuild %s done, active buffer: %v", c.pointerKey, active)
+	return nil
+}
+
+// Run 定时检查过期时间并重建，不依赖读请求触发
+func (c *DualCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Rebuild(ctx); err != nil {
+				log.Errorf("rebuild %s err %v", c.pointerKey, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package dual_cache
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRangeRebuildWhenBothBuffersExpired(t *testing.T) {
+	ctx := context.TODO()
+	m := redis_store.NewMemory()
+	now := time.Now()
+	m.SetClock(func() time.Time { return now })
+	loads := 0
+	cache := New(m, "goods", func(ctx context.Context) ([]string, error) {
+		loads++
+		return []string{"a", "b"}, nil
+	}, time.Minute)
+
+	//第一次读取同步加载
+	if items, err := cache.LRange(ctx, 0, -1); err != nil || !reflect.DeepEqual(items, []string{"a", "b"}) {
+		t.Fatalf("first lrange = %v, %v", items, err)
+	}
+
+	//指针还在，两个list都已经过期，读取时同步重建，不返回空的list
+	now = now.Add(time.Hour)
+	if n, _ := m.Exists(ctx, "goods:active"); n != 1 {
+		t.Fatal("pointer key should still exist")
+	}
+	if items, err := cache.LRange(ctx, 0, -1); err != nil || !reflect.DeepEqual(items, []string{"a", "b"}) {
+		t.Fatalf("lrange after expiry = %v, %v", items, err)
+	}
+	if loads != 2 {
+		t.Fatalf("loads = %d, want 2", loads)
+	}
+}
+
+// countingClient 记录Eval的次数
+type countingClient struct {
+	redis_store.Client
+	evals int32
+}
+
+func (c *countingClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	atomic.AddInt32(&c.evals, 1)
+	return c.Client.Eval(ctx, script, keys, args...)
+}
+
+func TestLRangeSingleAsyncRebuild(t *testing.T) {
+	ctx := context.TODO()
+	m := redis_store.NewMemory()
+	var mu sync.Mutex
+	now := time.Now()
+	m.SetClock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	cli := &countingClient{Client: m}
+	var loads int32
+	release := make(chan struct{})
+	cache := New(cli, "goods", func(ctx context.Context) ([]string, error) {
+		if atomic.AddInt32(&loads, 1) > 1 {
+			<-release
+		}
+		return []string{"a", "b"}, nil
+	}, time.Minute)
+	cache.LRange(ctx, 0, -1)
+
+	//进入重建窗口后大量读取，重建还没完成时只有一个异步重建，不会每次读取都去抢锁
+	mu.Lock()
+	now = now.Add(time.Second * 50)
+	mu.Unlock()
+	atomic.StoreInt32(&cli.evals, 0)
+	const reads = 50
+	for i := 0; i < reads; i++ {
+		if items, err := cache.LRange(ctx, 0, -1); err != nil || len(items) != 2 {
+			t.Fatalf("lrange = %v, %v", items, err)
+		}
+	}
+	if n := atomic.LoadInt32(&cli.evals); n > reads+3 {
+		t.Fatalf("%d evals for %d reads", n, reads)
+	}
+	close(release)
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&cache.rebuilding) == 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("rebuild did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads = %d, want 2", n)
+	}
+}
@@ -8,20 +8,22 @@ import (
 	"github.com/kataras/iris/v12"
 	context2 "github.com/kataras/iris/v12/context"
 	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/cache_aside"
+	"myTest/demo_home/redis_demo/cache_breakdown/dual_cache"
+	"myTest/demo_home/redis_demo/redis_store"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-var RedisCli *redis.Client
+var RedisCli redis_store.Client
 
 func init() {
-	RedisCli = redis.NewClient(&redis.Options{
+	RedisCli = redis_store.NewV8(redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
 		DB:   0,
-	})
-	_, err := RedisCli.Del(context.TODO(), GoodsKeyCacheA).Result()
-	if err != nil {
-		panic(err)
-	}
+	}))
 }
 
 type Goods struct {
@@ -30,29 +32,44 @@ type Goods struct {
 }
 
 var (
-	GoodsKeyCacheA = "goodsA"
-	GoodsKeyCacheB = "goodsB"
+	GoodsCacheKey = "goods"
+	goodsCache    *dual_cache.DualCache
+	// 双缓存都不可用时的兜底缓存，按分页缓存，同一页同时只查询一次数据库
+	goodsPageCache *cache_aside.Cache[[]string]
+	// 模拟数据库中的商品不断更新，每次加载的商品id不同，方便观察缓存的切换
+	goodsVersion int64
 )
 
-func InitDb(s, count int, cacheKey string) {
-	for i := s; i < s+count; i++ {
+// QueryGoodsFromDb 模拟从数据库查询商品
+func QueryGoodsFromDb(ctx context.Context) ([]string, error) {
+	s := int(atomic.AddInt64(&goodsVersion, 1)-1) * 2000
+	goods := make([]string, 0, 20)
+	for i := s; i < s+20; i++ {
 		g := &Goods{
 			Id:   i + 1,
 			Name: fmt.Sprintf("good-%d", i+1),
 		}
 		marshal, err := json.Marshal(g)
 		if err != nil {
-			panic(err)
-		}
-		_, err = RedisCli.RPush(context.TODO(), cacheKey, string(marshal)).Result()
-		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		goods = append(goods, string(marshal))
 	}
+	log.Infof("query goods from db, first id: %d", s+1)
+	return goods, nil
 }
 
 func main() {
-	InitDb(0, 20, GoodsKeyCacheA)
+	//缓存20s过期，剩余时间小于5s时重建，旧的缓存多保留10s兜底
+	goodsCache = dual_cache.New(RedisCli, GoodsCacheKey, QueryGoodsFromDb, time.Second*20)
+	goodsCache.SetRefreshBefore(time.Second * 5)
+	goodsCache.SetStagger(time.Second * 10)
+	if err := goodsCache.Rebuild(context.TODO()); err != nil {
+		panic(err)
+	}
+	go goodsCache.Run(context.TODO(), time.Second)
+	goodsPageCache = cache_aside.New[[]string](RedisCli, GoodsCacheKey+":page:", queryGoodsPage, time.Second*20)
+
 	app := iris.New()
 	app.Get("/goods/top/{offset}/{pageSize}", func(c *context2.Context) {
 		offset, err := c.Params().GetInt64("offset")
@@ -70,41 +87,46 @@ func main() {
 			panic(err)
 		}
 	})
-	//set the expire time
-	_, err := RedisCli.Expire(context.TODO(), GoodsKeyCacheA, time.Second*8).Result()
-	if err != nil {
-		panic(err)
-	}
-	InitDb(0, 20, GoodsKeyCacheB)
-	//add cacheB, expire time is different from cacheA (make sure new goods will be added to cacheA)
-	_, err = RedisCli.Expire(context.TODO(), GoodsKeyCacheB, time.Second*20).Result()
-	if err != nil {
-		panic(err)
-	}
-	go ReloadNewGoods()
 	app.Listen(":9999", nil)
 }
 
 func QueryForData(start, end int64) []string {
-	val := RedisCli.LRange(context.TODO(), GoodsKeyCacheA, start, end).Val()
-	log.Infof("query redis of cache A")
-	if len(val) == 0 {
-		log.Infof("cacheA is not exist, query redis of cache B")
-		val = RedisCli.LRange(context.TODO(), GoodsKeyCacheB, start, end).Val()
-		if len(val) == 0 {
-			log.Infof("cacheB is not exist, query db, no!!!")
-			return val
-		}
+	val, err := goodsCache.LRange(context.TODO(), start, end)
+	if err == nil && len(val) > 0 {
+		return val
+	}
+	if err != nil {
+		log.Errorf("query goods cache err %v", err)
+	}
+	//A、B两份缓存都没有数据，走旁路缓存查询数据库
+	val, err = goodsPageCache.Get(context.TODO(), fmt.Sprintf("%d:%d", start, end))
+	if err != nil {
+		log.Errorf("query goods page cache err %v", err)
+		return []string{}
 	}
 	return val
 }
 
-func ReloadNewGoods() {
-	time.Sleep(time.Second * 15)
-	log.Infof("start ReloadNewGoods......")
-	InitDb(2000, 20, GoodsKeyCacheA)
-	//set the expire time of cacheA
-	log.Infof("ReloadNewGoods......DONE")
-	//reload cacheB....
-	//set the expire time of cacheB
+// queryGoodsPage 从数据库查询一页商品，key的格式为start:end
+func queryGoodsPage(ctx context.Context, key string) ([]string, error) {
+	pos := strings.Index(key, ":")
+	start, err := strconv.ParseInt(key[:pos], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	end, err := strconv.ParseInt(key[pos+1:], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	goods, err := QueryGoodsFromDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 || start >= int64(len(goods)) || start > end {
+		return []string{}, nil
+	}
+	if end >= int64(len(goods)) {
+		end = int64(len(goods)) - 1
+	}
+	return goods[start : end+1], nil
 }
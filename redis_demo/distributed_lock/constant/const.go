@@ -1,9 +1,9 @@
 package constant
 
-import "github.com/go-redis/redis/v8"
+import "myTest/demo_home/redis_demo/redis_store"
 
 var (
 	BizKey   = "XXOO"
 	AppleKey = "apple"
-	RedisCli *redis.Client
+	RedisCli redis_store.Client
 )
@@ -3,9 +3,9 @@ package lock
 import (
 	"context"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/redis_store"
 	"strings"
 	"time"
 )
@@ -37,20 +37,24 @@ type RedisLock struct {
 	// 锁的标识
 	Id string
 	// Redis客户端
-	redisCli *redis.Client
+	redisCli redis_store.Client
 }
 
-func NewRedisLock(cli *redis.Client, key string) *RedisLock {
-	//去掉uuid中间的-
-	id := strings.Join(strings.Split(uuid.New().String(), "-"), "")
+func NewRedisLock(cli redis_store.Client, key string) *RedisLock {
 	return &RedisLock{
 		key:      key,
 		expire:   uint32(defaultExpireTime),
-		Id:       id,
+		Id:       newHolderId(),
 		redisCli: cli,
 	}
 }
 
+// 生成锁持有者的唯一标识
+func newHolderId() string {
+	//去掉uuid中间的-
+	return strings.Join(strings.Split(uuid.New().String(), "-"), "")
+}
+
 func (r *RedisLock) TryLock() bool {
 	//通过lua脚本加锁[hincrby如果key不存在，则会主动创建,如果存在则会给count数加1，表示又重入一次]
 	lockCmd := "if redis.call('exists', KEYS[1]) == 0 or redis.call('hexists', KEYS[1], ARGV[1]) == 1 " +
@@ -61,7 +65,7 @@ func (r *RedisLock) TryLock() bool {
 		"else " +
 		"   return 0 " +
 		"end"
-	result, err := r.redisCli.Eval(context.TODO(), lockCmd, []string{r.key}, r.Id, r.expire).Result()
+	result, err := r.redisCli.Eval(context.TODO(), lockCmd, []string{r.key}, r.Id, r.expire)
 	if err != nil {
 		log.Errorf("tryLock %s %v", r.key, err)
 		return false
@@ -101,8 +105,8 @@ func (r *RedisLock) Unlock() {
 		"else " +
 		"   return 0 " +
 		"end"
-	resp, err := r.redisCli.Eval(context.TODO(), delCmd, []string{r.key}, r.Id).Result()
-	if err != nil && err != redis.Nil {
+	resp, err := r.redisCli.Eval(context.TODO(), delCmd, []string{r.key}, r.Id)
+	if err != nil && err != redis_store.Nil {
 		log.Errorf("unlock %s %v", r.key, err)
 	}
 	if resp == nil {
@@ -124,8 +128,8 @@ func (r *RedisLock) reNewExpire() {
 		select {
 		case <-ticker.C:
 			//查看锁是否存在，如果存在进行续期
-			resp, err := r.redisCli.Eval(context.TODO(), renewCmd, []string{r.key}, r.Id, r.expire).Result()
-			if err != nil && err != redis.Nil {
+			resp, err := r.redisCli.Eval(context.TODO(), renewCmd, []string{r.key}, r.Id, r.expire)
+			if err != nil && err != redis_store.Nil {
 				log.Errorf("renew key %s err %v", r.key, err)
 			}
 			if resp.(int64) == 0 {
@@ -0,0 +1,215 @@
+package lock
+
+import (
+	"context"
+	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/redis_store"
+	"time"
+)
+
+/*
+	通过Redis+Lua脚本实现分布式读写锁
+	1. 读读共享、读写互斥、写写互斥
+	2. 写锁优先：写锁等待期间，新的读锁不能再加锁，防止写锁饿死
+	3. 可重入：同一个持有者可以重复加读锁/写锁，持有写锁时也可以再加读锁（不支持读锁升级为写锁，避免死锁）
+	4. 防止死锁：每个持有者单独的租约，自动续期只刷新自己的租约；加锁、解锁、续期前先清理租约已过期的持有者，
+	   宕机的读锁持有者不会因为其他读锁一直在续期而永远占着锁，导致写锁饿死
+	5. 只能释放自己的锁
+
+	数据结构：
+	KEYS[1] hash: mode -> read/write，持有者Id -> 重入次数
+	KEYS[2] string: 写锁等待标记，value为等待的写锁持有者Id，写锁加锁失败时设置，短时间后自动过期
+	KEYS[3] zset: 持有者Id -> 租约到期时间(ms)
+	注意：到期时间使用客户端时间计算，各个服务之间的时钟偏差需要远小于租约时间
+*/
+
+var (
+	// 写锁等待标记的过期时间，单位: ms，需要大于写锁重试的间隔
+	writeWaitExpireTime = 200
+)
+
+// 所有脚本的参数：ARGV[1] 持有者Id, ARGV[2] 过期时间(s), ARGV[3] 当前时间(ms), ARGV[4] 租约到期时间(ms)
+// 清理租约已过期的持有者，只剩下mode时删除整个锁
+var pruneLeasesCmd = "for _, id in ipairs(redis.call('zrangebyscore', KEYS[3], '-inf', ARGV[3])) do " +
+	"   redis.call('hdel', KEYS[1], id) " +
+	"   redis.call('zrem', KEYS[3], id) " +
+	"end " +
+	"if redis.call('hlen', KEYS[1]) <= 1 then " +
+	"   redis.call('del', KEYS[1]) " +
+	"end "
+
+// 刷新自己的租约，整个key的过期时间只是兜底
+var refreshLeaseCmd = "redis.call('zadd', KEYS[3], ARGV[4], ARGV[1]) " +
+	"redis.call('expire', KEYS[1], ARGV[2]) " +
+	"redis.call('expire', KEYS[3], ARGV[2]) "
+
+type RedisRWLock struct {
+	key string
+	// 写锁等待标记的key
+	writeWaitKey string
+	// 持有者租约的key
+	leaseKey string
+	// 锁的过期时间，单位: s
+	expire uint32
+	// 锁的标识
+	Id string
+	// Redis客户端
+	redisCli redis_store.Client
+}
+
+func NewRedisRWLock(cli redis_store.Client, key string) *RedisRWLock {
+	return &RedisRWLock{
+		key:          key,
+		writeWaitKey: key + ":write_wait",
+		leaseKey:     key + ":leases",
+		expire:       uint32(defaultExpireTime),
+		Id:           newHolderId(),
+		redisCli:     cli,
+	}
+}
+
+func (r *RedisRWLock) SetExpire(t uint32) {
+	r.expire = t
+}
+
+func (r *RedisRWLock) keys() []string {
+	return []string{r.key, r.writeWaitKey, r.leaseKey}
+}
+
+// args 所有脚本共用的参数：持有者Id、过期时间、当前时间、租约到期时间
+func (r *RedisRWLock) args() []interface{} {
+	now := time.Now().UnixMilli()
+	return []interface{}{r.Id, r.expire, now, now + int64(r.expire)*1000}
+}
+
+// TryRLock 尝试加读锁
+func (r *RedisRWLock) TryRLock() bool {
+	//1. 没有人持有锁：没有写锁在等待时才能加读锁
+	//2. 读锁模式：自己已经持有读锁可以直接重入，否则同样需要没有写锁在等待
+	//3. 写锁模式：只有写锁持有者自己可以再加读锁
+	rLockCmd := pruneLeasesCmd +
+		"local mode = redis.call('hget', KEYS[1], 'mode') " +
+		"if mode == false then " +
+		"   if redis.call('exists', KEYS[2]) == 1 then " +
+		"       return 0 " +
+		"   end " +
+		"   redis.call('hset', KEYS[1], 'mode', 'read') " +
+		"elseif mode == 'read' then " +
+		"   if redis.call('hexists', KEYS[1], ARGV[1]) == 0 and redis.call('exists', KEYS[2]) == 1 then " +
+		"       return 0 " +
+		"   end " +
+		"elseif redis.call('hexists', KEYS[1], ARGV[1]) == 0 then " +
+		"   return 0 " +
+		"end " +
+		"local count = redis.call('hincrby', KEYS[1], ARGV[1], 1) " +
+		refreshLeaseCmd +
+		"return count"
+	return r.tryLock(rLockCmd, r.args()...)
+}
+
+// TryLock 尝试加写锁，加锁失败时设置写锁等待标记，阻止新的读锁进入；加锁成功时清除自己设置的等待标记
+func (r *RedisRWLock) TryLock() bool {
+	lockCmd := pruneLeasesCmd +
+		"local mode = redis.call('hget', KEYS[1], 'mode') " +
+		"if mode == false or (mode == 'write' and redis.call('hexists', KEYS[1], ARGV[1]) == 1) then " +
+		"   redis.call('hset', KEYS[1], 'mode', 'write') " +
+		"   local count = redis.call('hincrby', KEYS[1], ARGV[1], 1) " +
+		refreshLeaseCmd +
+		"   if redis.call('get', KEYS[2]) == ARGV[1] then " +
+		"       redis.call('del', KEYS[2]) " +
+		"   end " +
+		"   return count " +
+		"end " +
+		"redis.call('set', KEYS[2], ARGV[1], 'PX', ARGV[5]) " +
+		"return 0"
+	return r.tryLock(lockCmd, append(r.args(), writeWaitExpireTime)...)
+}
+
+// tryLock 加锁脚本成功时返回自己的重入次数，失败时返回0；
+// 只有第一次加锁时启动续期，重入时续期的goroutine已经在运行
+func (r *RedisRWLock) tryLock(script string, args ...interface{}) bool {
+	result, err := r.redisCli.Eval(context.TODO(), script, r.keys(), args...)
+	if err != nil {
+		log.Errorf("tryLock %s %v", r.key, err)
+		return false
+	}
+	count := result.(int64)
+	if count == 1 {
+		//获取锁成功&自动续期
+		go r.reNewExpire()
+	}
+	return count > 0
+}
+
+func (r *RedisRWLock) RLock() {
+	for {
+		if r.TryRLock() {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func (r *RedisRWLock) Lock() {
+	for {
+		if r.TryLock() {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+// RUnlock 读锁和写锁的重入次数记录在同一个持有者Id下，释放逻辑一致
+func (r *RedisRWLock) RUnlock() {
+	r.Unlock()
+}
+
+func (r *RedisRWLock) Unlock() {
+	//1. 清理租约已过期的持有者，自己没有持有锁，直接返回
+	//2. 重入次数减1，减到0时删除自己的记录和租约
+	//3. 除了mode之外没有其他持有者时，删除整个key
+	delCmd := pruneLeasesCmd +
+		"if redis.call('hexists', KEYS[1], ARGV[1]) == 0 " +
+		"then " +
+		"   return nil " +
+		"end " +
+		"if redis.call('hincrby', KEYS[1], ARGV[1], -1) > 0 " +
+		"then " +
+		"   return 0 " +
+		"end " +
+		"redis.call('hdel', KEYS[1], ARGV[1]) " +
+		"redis.call('zrem', KEYS[3], ARGV[1]) " +
+		"if redis.call('hlen', KEYS[1]) <= 1 " +
+		"then " +
+		"   redis.call('del', KEYS[3]) " +
+		"   return redis.call('del', KEYS[1]) " +
+		"end " +
+		"return 0"
+	_, err := r.redisCli.Eval(context.TODO(), delCmd, r.keys(), r.args()...)
+	if err != nil && err != redis_store.Nil {
+		log.Errorf("unlock %s %v", r.key, err)
+	}
+}
+
+// 自动续期：自己还持有锁（没有释放、租约没有过期）时刷新自己的租约
+func (r *RedisRWLock) reNewExpire() {
+	renewCmd := pruneLeasesCmd +
+		"if redis.call('hexists', KEYS[1], ARGV[1]) == 0 " +
+		"then " +
+		"   return 0 " +
+		"end " +
+		refreshLeaseCmd +
+		"return 1"
+	ticker := time.NewTicker(time.Duration(r.expire) * time.Second / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		resp, err := r.redisCli.Eval(context.TODO(), renewCmd, r.keys(), r.args()...)
+		if err != nil && err != redis_store.Nil {
+			log.Errorf("renew key %s err %v", r.key, err)
+			continue
+		}
+		if resp.(int64) == 0 {
+			return
+		}
+	}
+}
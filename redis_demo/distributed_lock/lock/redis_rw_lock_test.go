@@ -0,0 +1,135 @@
+package lock
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRWLock(t *testing.T) {
+	cli := redis_store.NewMemory()
+	r1, r2 := NewRedisRWLock(cli, "rw"), NewRedisRWLock(cli, "rw")
+	w := NewRedisRWLock(cli, "rw")
+
+	//读读共享，读写互斥
+	if !r1.TryRLock() || !r2.TryRLock() {
+		t.Fatal("readers should share the lock")
+	}
+	if w.TryLock() {
+		t.Fatal("writer acquired the lock held by readers")
+	}
+	//写锁等待期间新的读锁不能加锁，已经持有读锁的可以重入
+	if NewRedisRWLock(cli, "rw").TryRLock() {
+		t.Fatal("new reader acquired the lock while a writer is waiting")
+	}
+	if !r1.TryRLock() {
+		t.Fatal("reader should reenter")
+	}
+	r1.RUnlock()
+	r1.RUnlock()
+	r2.RUnlock()
+	if !w.TryLock() {
+		t.Fatal("writer should acquire the released lock")
+	}
+	if r1.TryRLock() || NewRedisRWLock(cli, "rw").TryLock() {
+		t.Fatal("lock held by writer was acquired by others")
+	}
+	//持有写锁时可以再加读锁
+	if !w.TryRLock() {
+		t.Fatal("writer should acquire read lock")
+	}
+	w.RUnlock()
+	w.Unlock()
+	if n, _ := cli.Exists(context.TODO(), "rw", "rw:leases"); n != 0 {
+		t.Fatalf("%d keys left after unlock", n)
+	}
+}
+
+func TestRWLockExpiredReader(t *testing.T) {
+	ctx := context.TODO()
+	cli := redis_store.NewMemory()
+	alive := NewRedisRWLock(cli, "rw")
+	if !alive.TryRLock() {
+		t.Fatal("reader should acquire the lock")
+	}
+	//宕机的读锁持有者：租约已经过期，但整个key还在被其他读锁续期
+	cli.HSet(ctx, "rw", "crashed", 1)
+	cli.ZAdd(ctx, "rw:leases", redis_store.Z{Score: float64(time.Now().Add(-time.Second).UnixMilli()), Member: "crashed"})
+
+	w := NewRedisRWLock(cli, "rw")
+	if w.TryLock() {
+		t.Fatal("writer acquired the lock held by a live reader")
+	}
+	alive.RUnlock()
+	if !w.TryLock() {
+		t.Fatal("writer should not wait for the expired reader")
+	}
+	if ok, _ := cli.HExists(ctx, "rw", "crashed"); ok {
+		t.Fatal("expired reader was not pruned")
+	}
+	w.Unlock()
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.TODO()
+	cli := redis_store.NewMemory()
+	s1, s2, s3 := NewRedisSemaphore(cli, "sem", 2), NewRedisSemaphore(cli, "sem", 2), NewRedisSemaphore(cli, "sem", 2)
+	if !s1.TryAcquire() || !s2.TryAcquire() {
+		t.Fatal("should acquire 2 permits")
+	}
+	if s3.TryAcquire() || s1.Available() != 0 {
+		t.Fatal("permits exceeded")
+	}
+	//已经持有许可时只刷新租约
+	if !s1.TryAcquire() || s1.Available() != 0 {
+		t.Fatal("holder should refresh its lease")
+	}
+	s2.Release()
+	if !s3.TryAcquire() {
+		t.Fatal("released permit should be acquired")
+	}
+
+	//租约过期的持有者被清理，许可不会泄漏
+	s3.Release()
+	cli.ZAdd(ctx, "sem", redis_store.Z{Score: float64(time.Now().Add(-time.Second).UnixMilli()), Member: "crashed"})
+	if !s3.TryAcquire() || s3.Available() != 0 {
+		t.Fatal("expired lease should be reclaimed")
+	}
+}
+
+// countingClient 记录Eval的次数
+type countingClient struct {
+	redis_store.Client
+	evals int32
+}
+
+func (c *countingClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	atomic.AddInt32(&c.evals, 1)
+	return c.Client.Eval(ctx, script, keys, args...)
+}
+
+func TestReentrantRenewOnce(t *testing.T) {
+	cli := &countingClient{Client: redis_store.NewMemory()}
+	l := NewRedisRWLock(cli, "rw")
+	s := NewRedisSemaphore(cli, "sem", 1)
+	//续期间隔为1s
+	l.SetExpire(3)
+	s.SetExpire(3)
+	for i := 0; i < 3; i++ {
+		if !l.TryLock() || !l.TryRLock() || !s.TryAcquire() {
+			t.Fatal("should reenter")
+		}
+	}
+	//重入多次只有一个续期的goroutine，锁和信号量在一个续期间隔内各续期一次
+	atomic.StoreInt32(&cli.evals, 0)
+	time.Sleep(time.Millisecond * 1500)
+	if n := atomic.LoadInt32(&cli.evals); n != 2 {
+		t.Fatalf("%d renew evals in one interval, want 2", n)
+	}
+	for i := 0; i < 6; i++ {
+		l.Unlock()
+	}
+	s.Release()
+}
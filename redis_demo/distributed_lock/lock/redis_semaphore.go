@@ -0,0 +1,133 @@
+package lock
+
+import (
+	"context"
+	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/redis_store"
+	"time"
+)
+
+/*
+	通过Redis+Lua脚本实现分布式信号量
+	1. 最多允许permits个持有者同时获取许可
+	2. 租约过期：zset中member为持有者Id，score为租约到期时间(ms)，获取许可前先清理已过期的持有者，防止持有者宕机后许可泄漏
+	3. 自动续期，只能释放自己的许可
+	注意：到期时间使用客户端时间计算，各个服务之间的时钟偏差需要远小于租约时间
+*/
+
+type RedisSemaphore struct {
+	key string
+	// 许可数量
+	permits int
+	// 租约的过期时间，单位: s
+	expire uint32
+	// 持有者标识
+	Id string
+	// Redis客户端
+	redisCli redis_store.Client
+}
+
+func NewRedisSemaphore(cli redis_store.Client, key string, permits int) *RedisSemaphore {
+	return &RedisSemaphore{
+		key:      key,
+		permits:  permits,
+		expire:   uint32(defaultExpireTime),
+		Id:       newHolderId(),
+		redisCli: cli,
+	}
+}
+
+func (s *RedisSemaphore) SetExpire(t uint32) {
+	s.expire = t
+}
+
+func (s *RedisSemaphore) leaseDeadline() (now, deadline int64) {
+	now = time.Now().UnixMilli()
+	return now, now + int64(s.expire)*1000
+}
+
+// TryAcquire 尝试获取一个许可，已经持有许可时只刷新租约
+func (s *RedisSemaphore) TryAcquire() bool {
+	//返回值：0 没有可用的许可，1 获取成功，2 已经持有许可
+	acquireCmd := "redis.call('zremrangebyscore', KEYS[1], '-inf', ARGV[2]) " +
+		"local held = redis.call('zscore', KEYS[1], ARGV[1]) " +
+		"if held == false and redis.call('zcard', KEYS[1]) >= tonumber(ARGV[4]) " +
+		"then " +
+		"   return 0 " +
+		"end " +
+		"redis.call('zadd', KEYS[1], ARGV[3], ARGV[1]) " +
+		"redis.call('expire', KEYS[1], ARGV[5]) " +
+		"if held then " +
+		"   return 2 " +
+		"end " +
+		"return 1"
+	now, deadline := s.leaseDeadline()
+	result, err := s.redisCli.Eval(context.TODO(), acquireCmd, []string{s.key}, s.Id, now, deadline, s.permits, s.expire)
+	if err != nil {
+		log.Errorf("tryAcquire %s %v", s.key, err)
+		return false
+	}
+	switch result.(int64) {
+	case 1:
+		//获取许可成功&自动续期
+		go s.reNewExpire()
+		return true
+	case 2:
+		//已经持有许可，只刷新了租约，续期的goroutine已经在运行
+		return true
+	}
+	return false
+}
+
+func (s *RedisSemaphore) Acquire() {
+	for {
+		if s.TryAcquire() {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func (s *RedisSemaphore) Release() {
+	_, err := s.redisCli.ZRem(context.TODO(), s.key, s.Id)
+	if err != nil && err != redis_store.Nil {
+		log.Errorf("release %s %v", s.key, err)
+	}
+}
+
+// Available 当前剩余的许可数量
+func (s *RedisSemaphore) Available() int {
+	countCmd := "redis.call('zremrangebyscore', KEYS[1], '-inf', ARGV[1]) " +
+		"return tonumber(ARGV[2]) - redis.call('zcard', KEYS[1])"
+	now, _ := s.leaseDeadline()
+	result, err := s.redisCli.Eval(context.TODO(), countCmd, []string{s.key}, now, s.permits)
+	if err != nil {
+		log.Errorf("available %s %v", s.key, err)
+		return 0
+	}
+	return int(result.(int64))
+}
+
+// 自动续期：许可还在（未释放、未过期）时刷新租约到期时间
+func (s *RedisSemaphore) reNewExpire() {
+	renewCmd := "if redis.call('zscore', KEYS[1], ARGV[1]) == false " +
+		"then " +
+		"   return 0 " +
+		"end " +
+		"redis.call('zadd', KEYS[1], ARGV[2], ARGV[1]) " +
+		"redis.call('expire', KEYS[1], ARGV[3]) " +
+		"return 1"
+	ticker := time.NewTicker(time.Duration(s.expire) * time.Second / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, deadline := s.leaseDeadline()
+		resp, err := s.redisCli.Eval(context.TODO(), renewCmd, []string{s.key}, s.Id, deadline, s.expire)
+		if err != nil && err != redis_store.Nil {
+			log.Errorf("renew key %s err %v", s.key, err)
+			continue
+		}
+		if resp.(int64) == 0 {
+			return
+		}
+	}
+}
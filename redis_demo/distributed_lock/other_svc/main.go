@@ -8,16 +8,17 @@ import (
 	context2 "github.com/kataras/iris/v12/context"
 	"myTest/demo_home/redis_demo/distributed_lock/constant"
 	service2 "myTest/demo_home/redis_demo/distributed_lock/other_svc/service"
+	"myTest/demo_home/redis_demo/redis_store"
 	"sync/atomic"
 )
 
 func main() {
-	constant.RedisCli = redis.NewClient(&redis.Options{
+	constant.RedisCli = redis_store.NewV8(redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
 		DB:   0,
-	})
-	_, err := constant.RedisCli.Set(context.TODO(), constant.AppleKey, 500, -1).Result()
-	if err != nil && err != redis.Nil {
+	}))
+	err := constant.RedisCli.Set(context.TODO(), constant.AppleKey, 500, -1)
+	if err != nil {
 		panic(err)
 	}
 	app := iris.New()
@@ -2,10 +2,10 @@ package service2
 
 import (
 	"context"
-	"github.com/go-redis/redis/v8"
 	"github.com/ziyifast/log"
 	"myTest/demo_home/redis_demo/distributed_lock/constant"
 	"myTest/demo_home/redis_demo/distributed_lock/lock"
+	"myTest/demo_home/redis_demo/redis_store"
 	"strconv"
 )
 
@@ -19,8 +19,8 @@ func (g *goodsService2) Consume() {
 	redisLock.Lock()
 	defer redisLock.Unlock()
 	//consume goods
-	result, err := constant.RedisCli.Get(context.TODO(), constant.AppleKey).Result()
-	if err != nil && err != redis.Nil {
+	result, err := constant.RedisCli.Get(context.TODO(), constant.AppleKey)
+	if err != nil && err != redis_store.Nil {
 		panic(err)
 	}
 	i, err := strconv.ParseInt(result, 10, 64)
@@ -31,8 +31,8 @@ func (g *goodsService2) Consume() {
 		log.Infof("no more apple...")
 		return
 	}
-	_, err = constant.RedisCli.Set(context.TODO(), constant.AppleKey, i-1, -1).Result()
-	if err != nil && err != redis.Nil {
+	err = constant.RedisCli.Set(context.TODO(), constant.AppleKey, i-1, -1)
+	if err != nil {
 		panic(err)
 	}
 	log.Infof("consume success...appleID:%v", i)
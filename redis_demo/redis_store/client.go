@@ -0,0 +1,125 @@
+package redis_store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+对demo中用到的Redis命令做一层抽象：
+1. NewV8/NewV6 包装go-redis的客户端，连接真实的Redis
+2. NewMemory 纯内存实现，支持过期时间、list、hash、zset、bitmap以及通过Lua执行EVAL脚本，方便在没有Redis的环境下做单元测试
+
+返回值的语义与go-redis的Result()保持一致：key或者元素不存在时返回Nil
+*/
+
+// Nil 与go-redis的redis.Nil含义相同，adapter会把redis.Nil统一转换为该错误
+var Nil = errors.New("redis: nil")
+
+type Z struct {
+	Score  float64
+	Member string
+}
+
+// ZRangeBy 与go-redis一致：Offset和Count都为0时不限制返回数量
+type ZRangeBy struct {
+	Min, Max      string
+	Offset, Count int64
+}
+
+type Client interface {
+	Ping(ctx context.Context) error
+
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	IncrBy(ctx context.Context, key string, value int64) (int64, error)
+	Del(ctx context.Context, keys ...string) (int64, error)
+	Exists(ctx context.Context, keys ...string) (int64, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Rename(ctx context.Context, key, newKey string) error
+
+	LPush(ctx context.Context, key string, values ...interface{}) (int64, error)
+	RPush(ctx context.Context, key string, values ...interface{}) (int64, error)
+	LPop(ctx context.Context, key string) (string, error)
+	RPop(ctx context.Context, key string) (string, error)
+	// BLPop 阻塞等待任意一个list有数据，返回{key, 元素}，超时返回Nil，timeout为0时一直等待
+	BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error)
+	LRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+	LLen(ctx context.Context, key string) (int64, error)
+	LTrim(ctx context.Context, key string, start, stop int64) error
+
+	HGet(ctx context.Context, key, field string) (string, error)
+	// HSet values为field, value交替出现
+	HSet(ctx context.Context, key string, values ...interface{}) (int64, error)
+	HExists(ctx context.Context, key, field string) (bool, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) (int64, error)
+	HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error)
+
+	ZAdd(ctx context.Context, key string, members ...Z) (int64, error)
+	ZRem(ctx context.Context, key string, members ...string) (int64, error)
+	ZScore(ctx context.Context, key, member string) (float64, error)
+	ZCard(ctx context.Context, key string) (int64, error)
+	ZRangeByScore(ctx context.Context, key string, opt ZRangeBy) ([]string, error)
+	ZRangeByScoreWithScores(ctx context.Context, key string, opt ZRangeBy) ([]Z, error)
+
+	SetBit(ctx context.Context, key string, offset int64, value int) (int64, error)
+	GetBit(ctx context.Context, key string, offset int64) (int64, error)
+
+	// Eval 返回值：整数为int64，字符串为string，数组为[]interface{}，nil返回Nil错误
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// 参数转换规则与go-redis一致
+func toArg(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return strconv.FormatInt(int64(v), 10)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
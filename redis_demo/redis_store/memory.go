@@ -0,0 +1,396 @@
+package redis_store
+
+import (
+	"context"
+	"errors"
+	"github.com/yuin/gopher-lua"
+	"sync"
+	"time"
+)
+
+/*
+Redis的纯内存实现，只用于单元测试：
+1. 所有命令（包括EVAL脚本）在同一把锁下执行，保证脚本的原子性
+2. 过期时间采用惰性删除，访问key时判断是否过期；可以通过SetClock控制当前时间
+3. bitmap和Redis一样可以按字符串读取，SETBIT写入后保存为[]byte，GET时才转换为字符串
+*/
+
+var (
+	errWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+	errNotFloat   = errors.New("ERR value is not a valid float")
+	errSyntax     = errors.New("ERR syntax error")
+	errNoSuchKey  = errors.New("ERR no such key")
+)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindList
+	kindHash
+	kindZSet
+)
+
+type entry struct {
+	kind kind
+	str  string
+	// SETBIT写入的bitmap，不为nil时字符串的值为string(bits)，避免每次SETBIT都复制整个bitmap
+	bits     []byte
+	list     []string
+	hash     map[string]string
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+// value 字符串的值，bitmap在这里才转换为字符串
+func (e *entry) value() string {
+	if e.bits != nil {
+		return string(e.bits)
+	}
+	return e.str
+}
+
+func (e *entry) empty() bool {
+	switch e.kind {
+	case kindList:
+		return len(e.list) == 0
+	case kindHash:
+		return len(e.hash) == 0
+	case kindZSet:
+		return len(e.zset) == 0
+	}
+	return false
+}
+
+type Memory struct {
+	mu   sync.Mutex
+	data map[string]*entry
+	now  func() time.Time
+	// 编译后的Lua脚本缓存，key为脚本内容
+	scripts map[string]*lua.FunctionProto
+	// 执行脚本的LState，第一次EVAL时创建
+	lua *lua.LState
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		data:    make(map[string]*entry),
+		now:     time.Now,
+		scripts: make(map[string]*lua.FunctionProto),
+	}
+}
+
+// SetClock 替换当前时间的获取方式，测试中可以用来模拟key过期
+func (m *Memory) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// FlushAll 清空所有数据
+func (m *Memory) FlushAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = make(map[string]*entry)
+}
+
+// lookup 获取未过期的key，已经过期的key直接删除
+func (m *Memory) lookup(key string) *entry {
+	e, ok := m.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !m.now().Before(e.expireAt) {
+		delete(m.data, key)
+		return nil
+	}
+	return e
+}
+
+// lookupKind 获取指定类型的key，不存在时返回nil，类型不一致时返回WRONGTYPE
+func (m *Memory) lookupKind(key string, k kind) (*entry, error) {
+	e := m.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.kind != k {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+// create 获取指定类型的key，不存在时创建
+func (m *Memory) create(key string, k kind) (*entry, error) {
+	e, err := m.lookupKind(key, k)
+	if err != nil || e != nil {
+		return e, err
+	}
+	e = &entry{kind: k}
+	switch k {
+	case kindHash:
+		e.hash = make(map[string]string)
+	case kindZSet:
+		e.zset = make(map[string]float64)
+	}
+	m.data[key] = e
+	return e, nil
+}
+
+// removeIfEmpty 和Redis一样，集合类型的元素为空时删除key
+func (m *Memory) removeIfEmpty(key string, e *entry) {
+	if e != nil && e.empty() {
+		delete(m.data, key)
+	}
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(key)
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, toArg(value), expiration, false, false)
+	return nil
+}
+
+func (m *Memory) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.set(key, toArg(value), expiration, true, false), nil
+}
+
+func (m *Memory) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.incrBy(key, value)
+}
+
+func (m *Memory) Del(ctx context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.del(keys...), nil
+}
+
+func (m *Memory) Exists(ctx context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exists(keys...), nil
+}
+
+func (m *Memory) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expire(key, expiration), nil
+}
+
+func (m *Memory) TTL(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ttl := m.pttl(key)
+	if ttl < 0 {
+		//与go-redis一致：-1表示没有过期时间，-2表示key不存在
+		return time.Duration(ttl), nil
+	}
+	//与Redis的TTL命令一致，按秒四舍五入
+	return time.Duration((ttl+500)/1000) * time.Second, nil
+}
+
+func (m *Memory) Rename(ctx context.Context, key, newKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rename(key, newKey)
+}
+
+func (m *Memory) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.push(key, toArgs(values), true)
+}
+
+func (m *Memory) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.push(key, toArgs(values), false)
+}
+
+func (m *Memory) LPop(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pop(key, true)
+}
+
+func (m *Memory) RPop(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pop(key, false)
+}
+
+// BLPop 内存实现没有阻塞队列，每10ms检查一次list
+func (m *Memory) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for {
+		m.mu.Lock()
+		for _, key := range keys {
+			val, err := m.pop(key, true)
+			if err == Nil {
+				continue
+			}
+			m.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return []string{key, val}, nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, Nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Memory) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lrange(key, start, stop)
+}
+
+func (m *Memory) LLen(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.llen(key)
+}
+
+func (m *Memory) LTrim(ctx context.Context, key string, start, stop int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ltrim(key, start, stop)
+}
+
+func (m *Memory) HGet(ctx context.Context, key, field string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hget(key, field)
+}
+
+func (m *Memory) HSet(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hset(key, toArgs(values))
+}
+
+func (m *Memory) HExists(ctx context.Context, key, field string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.hget(key, field)
+	if err == Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *Memory) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hgetall(key)
+}
+
+func (m *Memory) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hdel(key, fields)
+}
+
+func (m *Memory) HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hincrBy(key, field, incr)
+}
+
+func (m *Memory) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zadd(key, members, false, false)
+}
+
+func (m *Memory) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zrem(key, members)
+}
+
+func (m *Memory) ZScore(ctx context.Context, key, member string) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zscore(key, member)
+}
+
+func (m *Memory) ZCard(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zcard(key)
+}
+
+func (m *Memory) ZRangeByScore(ctx context.Context, key string, opt ZRangeBy) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zs, err := m.zrangeByScore(key, opt)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(zs))
+	for _, z := range zs {
+		res = append(res, z.Member)
+	}
+	return res, nil
+}
+
+func (m *Memory) ZRangeByScoreWithScores(ctx context.Context, key string, opt ZRangeBy) ([]Z, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zrangeByScore(key, opt)
+}
+
+func (m *Memory) SetBit(ctx context.Context, key string, offset int64, value int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setbit(key, offset, value)
+}
+
+func (m *Memory) GetBit(ctx context.Context, key string, offset int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getbit(key, offset)
+}
+
+func (m *Memory) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.eval(script, keys, toArgs(args))
+}
+
+func toArgs(values []interface{}) []string {
+	args := make([]string, 0, len(values))
+	for _, v := range values {
+		args = append(args, toArg(v))
+	}
+	return args
+}
@@ -0,0 +1,582 @@
+package redis_store
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 以下命令的实现都需要在持有m.mu的情况下调用
+
+func (m *Memory) get(key string) (string, error) {
+	e, err := m.lookupKind(key, kindString)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", Nil
+	}
+	return e.value(), nil
+}
+
+// keepTTL 与go-redis的redis.KeepTTL一致，SET时保留原有的过期时间
+const keepTTL = -1
+
+// set nx: 只在key不存在时设置，xx: 只在key存在时设置；expiration为0表示不过期
+func (m *Memory) set(key, value string, expiration time.Duration, nx, xx bool) bool {
+	old := m.lookup(key)
+	if (nx && old != nil) || (xx && old == nil) {
+		return false
+	}
+	e := &entry{kind: kindString, str: value}
+	if expiration > 0 {
+		e.expireAt = m.now().Add(expiration)
+	} else if expiration == keepTTL && old != nil {
+		e.expireAt = old.expireAt
+	}
+	m.data[key] = e
+	return true
+}
+
+func (m *Memory) incrBy(key string, value int64) (int64, error) {
+	e, err := m.lookupKind(key, kindString)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if e != nil {
+		cur, err = strconv.ParseInt(e.value(), 10, 64)
+		if err != nil {
+			return 0, errNotInteger
+		}
+	} else {
+		e = &entry{kind: kindString}
+		m.data[key] = e
+	}
+	cur += value
+	e.str, e.bits = strconv.FormatInt(cur, 10), nil
+	return cur, nil
+}
+
+func (m *Memory) del(keys ...string) int64 {
+	var n int64
+	for _, k := range keys {
+		if m.lookup(k) != nil {
+			delete(m.data, k)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Memory) exists(keys ...string) int64 {
+	var n int64
+	for _, k := range keys {
+		if m.lookup(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// expire 与Redis一致，过期时间<=0时直接删除key
+func (m *Memory) expire(key string, expiration time.Duration) bool {
+	e := m.lookup(key)
+	if e == nil {
+		return false
+	}
+	if expiration <= 0 {
+		delete(m.data, key)
+		return true
+	}
+	e.expireAt = m.now().Add(expiration)
+	return true
+}
+
+func (m *Memory) persist(key string) bool {
+	e := m.lookup(key)
+	if e == nil || e.expireAt.IsZero() {
+		return false
+	}
+	e.expireAt = time.Time{}
+	return true
+}
+
+// pttl 剩余的过期时间，单位: ms；-1表示没有过期时间，-2表示key不存在
+func (m *Memory) pttl(key string) int64 {
+	e := m.lookup(key)
+	if e == nil {
+		return -2
+	}
+	if e.expireAt.IsZero() {
+		return -1
+	}
+	return int64(e.expireAt.Sub(m.now()) / time.Millisecond)
+}
+
+func (m *Memory) rename(key, newKey string) error {
+	e := m.lookup(key)
+	if e == nil {
+		return errNoSuchKey
+	}
+	delete(m.data, key)
+	m.data[newKey] = e
+	return nil
+}
+
+func (m *Memory) push(key string, values []string, left bool) (int64, error) {
+	e, err := m.create(key, kindList)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range values {
+		if left {
+			e.list = append([]string{v}, e.list...)
+		} else {
+			e.list = append(e.list, v)
+		}
+	}
+	return int64(len(e.list)), nil
+}
+
+func (m *Memory) pop(key string, left bool) (string, error) {
+	e, err := m.lookupKind(key, kindList)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", Nil
+	}
+	var v string
+	if left {
+		v, e.list = e.list[0], e.list[1:]
+	} else {
+		v, e.list = e.list[len(e.list)-1], e.list[:len(e.list)-1]
+	}
+	m.removeIfEmpty(key, e)
+	return v, nil
+}
+
+// normalizeRange 按Redis的规则处理负数下标，返回[start, stop)
+func normalizeRange(start, stop, length int64) (int64, int64) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+func (m *Memory) lrange(key string, start, stop int64) ([]string, error) {
+	e, err := m.lookupKind(key, kindList)
+	if err != nil || e == nil {
+		return []string{}, err
+	}
+	from, to := normalizeRange(start, stop, int64(len(e.list)))
+	res := make([]string, to-from)
+	copy(res, e.list[from:to])
+	return res, nil
+}
+
+func (m *Memory) llen(key string) (int64, error) {
+	e, err := m.lookupKind(key, kindList)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return int64(len(e.list)), nil
+}
+
+func (m *Memory) ltrim(key string, start, stop int64) error {
+	e, err := m.lookupKind(key, kindList)
+	if err != nil || e == nil {
+		return err
+	}
+	from, to := normalizeRange(start, stop, int64(len(e.list)))
+	e.list = append([]string{}, e.list[from:to]...)
+	m.removeIfEmpty(key, e)
+	return nil
+}
+
+// lrem 与Redis一致：count>0从头开始删除，count<0从尾开始删除，count=0删除全部
+func (m *Memory) lrem(key string, count int64, value string) (int64, error) {
+	e, err := m.lookupKind(key, kindList)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	var removed int64
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	keep := make([]string, 0, len(e.list))
+	if count >= 0 {
+		for _, v := range e.list {
+			if v == value && (limit == 0 || removed < limit) {
+				removed++
+				continue
+			}
+			keep = append(keep, v)
+		}
+	} else {
+		for i := len(e.list) - 1; i >= 0; i-- {
+			v := e.list[i]
+			if v == value && removed < limit {
+				removed++
+				continue
+			}
+			keep = append([]string{v}, keep...)
+		}
+	}
+	e.list = keep
+	m.removeIfEmpty(key, e)
+	return removed, nil
+}
+
+func (m *Memory) hget(key, field string) (string, error) {
+	e, err := m.lookupKind(key, kindHash)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", Nil
+	}
+	v, ok := e.hash[field]
+	if !ok {
+		return "", Nil
+	}
+	return v, nil
+}
+
+// hset values为field, value交替出现，返回新增的field数量
+func (m *Memory) hset(key string, values []string) (int64, error) {
+	if len(values) == 0 || len(values)%2 != 0 {
+		return 0, errSyntax
+	}
+	e, err := m.create(key, kindHash)
+	if err != nil {
+		return 0, err
+	}
+	var added int64
+	for i := 0; i < len(values); i += 2 {
+		if _, ok := e.hash[values[i]]; !ok {
+			added++
+		}
+		e.hash[values[i]] = values[i+1]
+	}
+	return added, nil
+}
+
+func (m *Memory) hgetall(key string) (map[string]string, error) {
+	e, err := m.lookupKind(key, kindHash)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string)
+	if e == nil {
+		return res, nil
+	}
+	for k, v := range e.hash {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func (m *Memory) hdel(key string, fields []string) (int64, error) {
+	e, err := m.lookupKind(key, kindHash)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	var n int64
+	for _, f := range fields {
+		if _, ok := e.hash[f]; ok {
+			delete(e.hash, f)
+			n++
+		}
+	}
+	m.removeIfEmpty(key, e)
+	return n, nil
+}
+
+func (m *Memory) hlen(key string) (int64, error) {
+	e, err := m.lookupKind(key, kindHash)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return int64(len(e.hash)), nil
+}
+
+func (m *Memory) hincrBy(key, field string, incr int64) (int64, error) {
+	e, err := m.create(key, kindHash)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if v, ok := e.hash[field]; ok {
+		cur, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errNotInteger
+		}
+	}
+	cur += incr
+	e.hash[field] = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+// zadd nx: 只添加新元素，xx: 只更新已有元素；返回新增的元素数量
+func (m *Memory) zadd(key string, members []Z, nx, xx bool) (int64, error) {
+	e, err := m.lookupKind(key, kindZSet)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil && xx {
+		return 0, nil
+	}
+	if e == nil {
+		e, _ = m.create(key, kindZSet)
+	}
+	var added int64
+	for _, z := range members {
+		_, ok := e.zset[z.Member]
+		if (nx && ok) || (xx && !ok) {
+			continue
+		}
+		if !ok {
+			added++
+		}
+		e.zset[z.Member] = z.Score
+	}
+	m.removeIfEmpty(key, e)
+	return added, nil
+}
+
+func (m *Memory) zincrBy(key string, incr float64, member string) (float64, error) {
+	e, err := m.create(key, kindZSet)
+	if err != nil {
+		return 0, err
+	}
+	e.zset[member] += incr
+	return e.zset[member], nil
+}
+
+func (m *Memory) zrem(key string, members []string) (int64, error) {
+	e, err := m.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	var n int64
+	for _, member := range members {
+		if _, ok := e.zset[member]; ok {
+			delete(e.zset, member)
+			n++
+		}
+	}
+	m.removeIfEmpty(key, e)
+	return n, nil
+}
+
+func (m *Memory) zscore(key, member string) (float64, error) {
+	e, err := m.lookupKind(key, kindZSet)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		return 0, Nil
+	}
+	score, ok := e.zset[member]
+	if !ok {
+		return 0, Nil
+	}
+	return score, nil
+}
+
+func (m *Memory) zcard(key string) (int64, error) {
+	e, err := m.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return int64(len(e.zset)), nil
+}
+
+// sortedZ 与Redis一致：按score升序，score相同时按member字典序
+func sortedZ(e *entry) []Z {
+	zs := make([]Z, 0, len(e.zset))
+	for member, score := range e.zset {
+		zs = append(zs, Z{Score: score, Member: member})
+	}
+	sort.Slice(zs, func(i, j int) bool {
+		if zs[i].Score != zs[j].Score {
+			return zs[i].Score < zs[j].Score
+		}
+		return zs[i].Member < zs[j].Member
+	})
+	return zs
+}
+
+// scoreBound 解析zset的区间：-inf、+inf、(1.5 表示开区间
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (scoreBound, error) {
+	var b scoreBound
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	switch strings.ToLower(s) {
+	case "-inf":
+		b.value = math.Inf(-1)
+	case "+inf", "inf":
+		b.value = math.Inf(1)
+	default:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return b, errNotFloat
+		}
+		b.value = v
+	}
+	return b, nil
+}
+
+func (b scoreBound) lessOrEqual(score float64) bool {
+	if b.exclusive {
+		return b.value < score
+	}
+	return b.value <= score
+}
+
+func (b scoreBound) greaterOrEqual(score float64) bool {
+	if b.exclusive {
+		return b.value > score
+	}
+	return b.value >= score
+}
+
+func (m *Memory) zrangeByScore(key string, opt ZRangeBy) ([]Z, error) {
+	min, err := parseScoreBound(opt.Min)
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(opt.Max)
+	if err != nil {
+		return nil, err
+	}
+	e, err := m.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return []Z{}, err
+	}
+	res := make([]Z, 0)
+	var skipped int64
+	for _, z := range sortedZ(e) {
+		if !min.lessOrEqual(z.Score) || !max.greaterOrEqual(z.Score) {
+			continue
+		}
+		if opt.Offset != 0 || opt.Count != 0 {
+			//LIMIT offset count，count<0表示返回offset之后的全部
+			if skipped < opt.Offset {
+				skipped++
+				continue
+			}
+			if opt.Count >= 0 && int64(len(res)) >= opt.Count {
+				break
+			}
+		}
+		res = append(res, z)
+	}
+	return res, nil
+}
+
+// zrange 按排名返回
+func (m *Memory) zrange(key string, start, stop int64) ([]Z, error) {
+	e, err := m.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return []Z{}, err
+	}
+	zs := sortedZ(e)
+	from, to := normalizeRange(start, stop, int64(len(zs)))
+	return zs[from:to], nil
+}
+
+func (m *Memory) zremRangeByScore(key, minStr, maxStr string) (int64, error) {
+	zs, err := m.zrangeByScore(key, ZRangeBy{Min: minStr, Max: maxStr})
+	if err != nil {
+		return 0, err
+	}
+	members := make([]string, 0, len(zs))
+	for _, z := range zs {
+		members = append(members, z.Member)
+	}
+	return m.zrem(key, members)
+}
+
+func (m *Memory) zcount(key, minStr, maxStr string) (int64, error) {
+	zs, err := m.zrangeByScore(key, ZRangeBy{Min: minStr, Max: maxStr})
+	return int64(len(zs)), err
+}
+
+// setbit bitmap按Redis的方式存储：offset 0 对应第一个字节的最高位
+func (m *Memory) setbit(key string, offset int64, value int) (int64, error) {
+	if offset < 0 || offset >= 1<<32 || (value != 0 && value != 1) {
+		return 0, errNotInteger
+	}
+	e, err := m.lookupKind(key, kindString)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		e = &entry{kind: kindString}
+		m.data[key] = e
+	}
+	idx := offset / 8
+	bit := byte(1 << (7 - uint(offset%8)))
+	if e.bits == nil {
+		e.bits, e.str = []byte(e.str), ""
+	}
+	if int64(len(e.bits)) <= idx {
+		e.bits = append(e.bits, make([]byte, idx-int64(len(e.bits))+1)...)
+	}
+	old := int64(0)
+	if e.bits[idx]&bit != 0 {
+		old = 1
+	}
+	if value == 1 {
+		e.bits[idx] |= bit
+	} else {
+		e.bits[idx] &^= bit
+	}
+	return old, nil
+}
+
+func (m *Memory) getbit(key string, offset int64) (int64, error) {
+	if offset < 0 {
+		return 0, errNotInteger
+	}
+	e, err := m.lookupKind(key, kindString)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	idx := offset / 8
+	var b byte
+	if e.bits != nil && int64(len(e.bits)) > idx {
+		b = e.bits[idx]
+	} else if e.bits == nil && int64(len(e.str)) > idx {
+		b = e.str[idx]
+	}
+	if b&byte(1<<(7-uint(offset%8))) != 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,650 @@
+package redis_store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+通过gopher-lua执行EVAL脚本，redis.call/redis.pcall转发给内存实现的命令
+Redis与Lua之间的类型转换规则与Redis保持一致：
+1. 整数 -> number，字符串 -> string，nil -> false，数组 -> table，状态回复 -> {ok=...}
+2. 脚本返回值：number截断为整数，true -> 1，false/nil -> nil，{err=...} -> 错误
+*/
+
+// statusReply 状态回复，例如SET命令返回的OK
+type statusReply string
+
+type command func(m *Memory, args []string) (interface{}, error)
+
+var commands = map[string]command{
+	"get": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("get")
+		}
+		v, err := m.get(args[0])
+		if err == Nil {
+			return nil, nil
+		}
+		return v, err
+	},
+	"set":    cmdSet,
+	"incr":   cmdIncrBy(1),
+	"decr":   cmdIncrBy(-1),
+	"incrby": cmdIncrBy(0),
+	"del": func(m *Memory, args []string) (interface{}, error) {
+		return m.del(args...), nil
+	},
+	"exists": func(m *Memory, args []string) (interface{}, error) {
+		return m.exists(args...), nil
+	},
+	"expire":  cmdExpire(time.Second),
+	"pexpire": cmdExpire(time.Millisecond),
+	"persist": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("persist")
+		}
+		return boolReply(m.persist(args[0])), nil
+	},
+	"ttl": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("ttl")
+		}
+		ttl := m.pttl(args[0])
+		if ttl < 0 {
+			return ttl, nil
+		}
+		return (ttl + 500) / 1000, nil
+	},
+	"pttl": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("pttl")
+		}
+		return m.pttl(args[0]), nil
+	},
+	"rename": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errArgs("rename")
+		}
+		if err := m.rename(args[0], args[1]); err != nil {
+			return nil, err
+		}
+		return statusReply("OK"), nil
+	},
+	"time": func(m *Memory, args []string) (interface{}, error) {
+		now := m.now()
+		return []interface{}{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}, nil
+	},
+
+	"lpush": cmdPush(true),
+	"rpush": cmdPush(false),
+	"lpop":  cmdPop(true),
+	"rpop":  cmdPop(false),
+	"lrange": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("lrange")
+		}
+		start, stop, err := parseInt2(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		vals, err := m.lrange(args[0], start, stop)
+		return stringsReply(vals), err
+	},
+	"llen": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("llen")
+		}
+		return m.llen(args[0])
+	},
+	"ltrim": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("ltrim")
+		}
+		start, stop, err := parseInt2(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		if err = m.ltrim(args[0], start, stop); err != nil {
+			return nil, err
+		}
+		return statusReply("OK"), nil
+	},
+	"lrem": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("lrem")
+		}
+		count, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errNotInteger
+		}
+		return m.lrem(args[0], count, args[2])
+	},
+
+	"hget": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errArgs("hget")
+		}
+		v, err := m.hget(args[0], args[1])
+		if err == Nil {
+			return nil, nil
+		}
+		return v, err
+	},
+	"hset": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) < 3 {
+			return nil, errArgs("hset")
+		}
+		return m.hset(args[0], args[1:])
+	},
+	"hexists": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errArgs("hexists")
+		}
+		_, err := m.hget(args[0], args[1])
+		if err == Nil {
+			return int64(0), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return int64(1), nil
+	},
+	"hdel": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, errArgs("hdel")
+		}
+		return m.hdel(args[0], args[1:])
+	},
+	"hlen": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("hlen")
+		}
+		return m.hlen(args[0])
+	},
+	"hincrby": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("hincrby")
+		}
+		incr, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return nil, errNotInteger
+		}
+		return m.hincrBy(args[0], args[1], incr)
+	},
+	"hgetall": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("hgetall")
+		}
+		h, err := m.hgetall(args[0])
+		if err != nil {
+			return nil, err
+		}
+		res := make([]interface{}, 0, len(h)*2)
+		for k, v := range h {
+			res = append(res, k, v)
+		}
+		return res, nil
+	},
+
+	"zadd": cmdZAdd,
+	"zincrby": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("zincrby")
+		}
+		incr, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, errNotFloat
+		}
+		score, err := m.zincrBy(args[0], incr, args[2])
+		return formatScore(score), err
+	},
+	"zrem": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, errArgs("zrem")
+		}
+		return m.zrem(args[0], args[1:])
+	},
+	"zscore": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errArgs("zscore")
+		}
+		score, err := m.zscore(args[0], args[1])
+		if err == Nil {
+			return nil, nil
+		}
+		return formatScore(score), err
+	},
+	"zcard": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("zcard")
+		}
+		return m.zcard(args[0])
+	},
+	"zcount": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("zcount")
+		}
+		return m.zcount(args[0], args[1], args[2])
+	},
+	"zrange": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) < 3 {
+			return nil, errArgs("zrange")
+		}
+		start, stop, err := parseInt2(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		zs, err := m.zrange(args[0], start, stop)
+		return zReply(zs, len(args) > 3 && strings.EqualFold(args[3], "withscores")), err
+	},
+	"zrangebyscore": cmdZRangeByScore,
+	"zremrangebyscore": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("zremrangebyscore")
+		}
+		return m.zremRangeByScore(args[0], args[1], args[2])
+	},
+
+	"setbit": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, errArgs("setbit")
+		}
+		offset, value, err := parseInt2(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		return m.setbit(args[0], offset, int(value))
+	},
+	"getbit": func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errArgs("getbit")
+		}
+		offset, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errNotInteger
+		}
+		return m.getbit(args[0], offset)
+	},
+}
+
+func errArgs(name string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+}
+
+func boolReply(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func stringsReply(vals []string) []interface{} {
+	res := make([]interface{}, 0, len(vals))
+	for _, v := range vals {
+		res = append(res, v)
+	}
+	return res
+}
+
+func zReply(zs []Z, withScores bool) []interface{} {
+	res := make([]interface{}, 0, len(zs)*2)
+	for _, z := range zs {
+		res = append(res, z.Member)
+		if withScores {
+			res = append(res, formatScore(z.Score))
+		}
+	}
+	return res
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func parseInt2(a, b string) (int64, int64, error) {
+	x, err := strconv.ParseInt(a, 10, 64)
+	if err != nil {
+		return 0, 0, errNotInteger
+	}
+	y, err := strconv.ParseInt(b, 10, 64)
+	if err != nil {
+		return 0, 0, errNotInteger
+	}
+	return x, y, nil
+}
+
+// SET key value [EX seconds|PX milliseconds] [NX|XX]
+func cmdSet(m *Memory, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errArgs("set")
+	}
+	var (
+		expiration time.Duration
+		nx, xx     bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, errors.New("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expiration = time.Duration(n) * unit
+			i++
+		default:
+			return nil, errSyntax
+		}
+	}
+	if !m.set(args[0], args[1], expiration, nx, xx) {
+		return nil, nil
+	}
+	return statusReply("OK"), nil
+}
+
+// fixed为0时，增量从参数中读取（INCRBY）
+func cmdIncrBy(fixed int64) command {
+	return func(m *Memory, args []string) (interface{}, error) {
+		if fixed != 0 {
+			if len(args) != 1 {
+				return nil, errArgs("incr")
+			}
+			return m.incrBy(args[0], fixed)
+		}
+		if len(args) != 2 {
+			return nil, errArgs("incrby")
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errNotInteger
+		}
+		return m.incrBy(args[0], n)
+	}
+}
+
+func cmdExpire(unit time.Duration) command {
+	return func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errArgs("expire")
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errNotInteger
+		}
+		return boolReply(m.expire(args[0], time.Duration(n)*unit)), nil
+	}
+}
+
+func cmdPush(left bool) command {
+	return func(m *Memory, args []string) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, errArgs("push")
+		}
+		return m.push(args[0], args[1:], left)
+	}
+}
+
+func cmdPop(left bool) command {
+	return func(m *Memory, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errArgs("pop")
+		}
+		v, err := m.pop(args[0], left)
+		if err == Nil {
+			return nil, nil
+		}
+		return v, err
+	}
+}
+
+// ZADD key [NX|XX] score member [score member ...]
+func cmdZAdd(m *Memory, args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errArgs("zadd")
+	}
+	key, args := args[0], args[1:]
+	var nx, xx bool
+	for len(args) > 0 {
+		opt := strings.ToUpper(args[0])
+		if opt == "NX" {
+			nx = true
+		} else if opt == "XX" {
+			xx = true
+		} else {
+			break
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errSyntax
+	}
+	members := make([]Z, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return nil, errNotFloat
+		}
+		members = append(members, Z{Score: score, Member: args[i+1]})
+	}
+	return m.zadd(key, members, nx, xx)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func cmdZRangeByScore(m *Memory, args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errArgs("zrangebyscore")
+	}
+	opt := ZRangeBy{Min: args[1], Max: args[2]}
+	withScores := false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, errSyntax
+			}
+			offset, count, err := parseInt2(args[i+1], args[i+2])
+			if err != nil {
+				return nil, err
+			}
+			opt.Offset, opt.Count = offset, count
+			if opt.Offset == 0 && opt.Count == 0 {
+				//LIMIT 0 0 在Redis中返回空
+				return []interface{}{}, nil
+			}
+			i += 2
+		default:
+			return nil, errSyntax
+		}
+	}
+	zs, err := m.zrangeByScore(args[0], opt)
+	return zReply(zs, withScores), err
+}
+
+func (m *Memory) compile(script string) (*lua.FunctionProto, error) {
+	if proto, ok := m.scripts[script]; ok {
+		return proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(script), "@user_script")
+	if err != nil {
+		return nil, fmt.Errorf("ERR Error compiling script: %v", err)
+	}
+	proto, err := lua.Compile(chunk, "@user_script")
+	if err != nil {
+		return nil, fmt.Errorf("ERR Error compiling script: %v", err)
+	}
+	m.scripts[script] = proto
+	return proto, nil
+}
+
+// luaState 所有脚本共用一个LState，脚本在m.mu下串行执行；每次创建LState并加载标准库的开销比执行脚本大得多
+func (m *Memory) luaState() *lua.LState {
+	if m.lua != nil {
+		return m.lua
+	}
+	L := lua.NewState()
+	redisMod := L.NewTable()
+	redisMod.RawSetString("call", L.NewFunction(m.luaCall(false)))
+	redisMod.RawSetString("pcall", L.NewFunction(m.luaCall(true)))
+	redisMod.RawSetString("status_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	redisMod.RawSetString("error_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetGlobal("redis", redisMod)
+	m.lua = L
+	return L
+}
+
+func (m *Memory) eval(script string, keys, args []string) (interface{}, error) {
+	proto, err := m.compile(script)
+	if err != nil {
+		return nil, err
+	}
+	L := m.luaState()
+	defer L.SetTop(0)
+	L.SetGlobal("KEYS", stringsTable(L, keys))
+	L.SetGlobal("ARGV", stringsTable(L, args))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err = L.PCall(0, 1, nil); err != nil {
+		return nil, fmt.Errorf("ERR Error running script: %v", err)
+	}
+	res, err := fromLua(L.Get(-1))
+	if err == nil && res == nil {
+		return nil, Nil
+	}
+	return res, err
+}
+
+func stringsTable(L *lua.LState, vals []string) *lua.LTable {
+	t := L.CreateTable(len(vals), 0)
+	for _, v := range vals {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+// luaCall 实现redis.call和redis.pcall：call遇到错误时抛出异常，pcall返回{err=...}
+func (m *Memory) luaCall(protected bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		n := L.GetTop()
+		if n == 0 {
+			L.RaiseError("Please specify at least one argument for redis.call()")
+			return 0
+		}
+		args := make([]string, 0, n)
+		for i := 1; i <= n; i++ {
+			switch v := L.Get(i).(type) {
+			case lua.LString:
+				args = append(args, string(v))
+			case lua.LNumber:
+				//与Redis一致，number按%.14g转换为字符串
+				args = append(args, strconv.FormatFloat(float64(v), 'g', 14, 64))
+			default:
+				L.RaiseError("Lua redis() command arguments must be strings or integers")
+				return 0
+			}
+		}
+		cmd, ok := commands[strings.ToLower(args[0])]
+		if !ok {
+			L.RaiseError("Unknown Redis command called from Lua script: %s", args[0])
+			return 0
+		}
+		res, err := cmd(m, args[1:])
+		if err != nil {
+			if protected {
+				t := L.NewTable()
+				t.RawSetString("err", lua.LString(err.Error()))
+				L.Push(t)
+				return 1
+			}
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		L.Push(toLua(L, res))
+		return 1
+	}
+}
+
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LFalse
+	case int64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case statusReply:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v))
+		return t
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	}
+	return lua.LString(fmt.Sprint(v))
+}
+
+func fromLua(v lua.LValue) (interface{}, error) {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return int64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LBool:
+		if v {
+			return int64(1), nil
+		}
+		return nil, nil
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return nil, errors.New(string(e))
+		}
+		if s, ok := v.RawGetString("ok").(lua.LString); ok {
+			return string(s), nil
+		}
+		//数组遇到第一个nil时结束
+		res := make([]interface{}, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			val, err := fromLua(item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, val)
+		}
+		return res, nil
+	}
+	return nil, nil
+}
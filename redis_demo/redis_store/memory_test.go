@@ -0,0 +1,119 @@
+package redis_store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryExpire(t *testing.T) {
+	ctx := context.TODO()
+	m := NewMemory()
+	now := time.Unix(1700000000, 0)
+	m.SetClock(func() time.Time { return now })
+
+	if err := m.Set(ctx, "k", "v", time.Second*10); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ := m.TTL(ctx, "k"); ttl != time.Second*10 {
+		t.Fatalf("ttl = %v, want 10s", ttl)
+	}
+	now = now.Add(time.Second * 10)
+	if _, err := m.Get(ctx, "k"); err != Nil {
+		t.Fatalf("get expired key err = %v, want Nil", err)
+	}
+	if ttl, _ := m.TTL(ctx, "k"); ttl != -2 {
+		t.Fatalf("ttl of missing key = %v, want -2", ttl)
+	}
+}
+
+func TestMemoryCollections(t *testing.T) {
+	ctx := context.TODO()
+	m := NewMemory()
+
+	m.RPush(ctx, "list", 1, 2, 3)
+	m.LPush(ctx, "list", 0)
+	if vals, _ := m.LRange(ctx, "list", 0, -1); len(vals) != 4 || vals[0] != "0" || vals[3] != "3" {
+		t.Fatalf("lrange = %v", vals)
+	}
+
+	m.HSet(ctx, "hash", "a", 1, "b", 2)
+	if ok, _ := m.HExists(ctx, "hash", "b"); !ok {
+		t.Fatal("hexists b = false")
+	}
+	if _, err := m.LPop(ctx, "hash"); err != errWrongType {
+		t.Fatalf("lpop on hash err = %v", err)
+	}
+
+	m.ZAdd(ctx, "zset", Z{Score: 3, Member: "c"}, Z{Score: 1, Member: "a"}, Z{Score: 2, Member: "b"})
+	vals, _ := m.ZRangeByScore(ctx, "zset", ZRangeBy{Min: "(1", Max: "+inf", Count: 1})
+	if len(vals) != 1 || vals[0] != "b" {
+		t.Fatalf("zrangebyscore = %v", vals)
+	}
+
+	m.SetBit(ctx, "bits", 9, 1)
+	if bit, _ := m.GetBit(ctx, "bits", 9); bit != 1 {
+		t.Fatal("getbit 9 != 1")
+	}
+	//与Redis一致：offset 9 对应第二个字节的第二高位
+	if s, _ := m.Get(ctx, "bits"); s != "\x00\x40" {
+		t.Fatalf("bitmap = %q", s)
+	}
+	//在已有的字符串上setbit，之后再覆盖为普通字符串
+	m.Set(ctx, "str", "a", 0)
+	if old, _ := m.SetBit(ctx, "str", 6, 1); old != 0 {
+		t.Fatal("setbit 6 old != 0")
+	}
+	if s, _ := m.Get(ctx, "str"); s != "c" {
+		t.Fatalf("string after setbit = %q", s)
+	}
+	m.Set(ctx, "str", "1", 0)
+	if n, _ := m.IncrBy(ctx, "str", 1); n != 2 {
+		t.Fatalf("incrby after set = %d", n)
+	}
+	if bit, _ := m.GetBit(ctx, "str", 6); bit != 1 {
+		t.Fatal("getbit of \"2\" offset 6 != 1")
+	}
+}
+
+func TestMemoryEval(t *testing.T) {
+	ctx := context.TODO()
+	m := NewMemory()
+	lockCmd := "if redis.call('exists', KEYS[1]) == 0 or redis.call('hexists', KEYS[1], ARGV[1]) == 1 " +
+		"then " +
+		"   redis.call('hincrby', KEYS[1], ARGV[1], 1) " +
+		"   redis.call('expire', KEYS[1], ARGV[2]) " +
+		"   return 1 " +
+		"else " +
+		"   return 0 " +
+		"end"
+	for i, c := range []struct {
+		id   string
+		want int64
+	}{{"a", 1}, {"a", 1}, {"b", 0}} {
+		res, err := m.Eval(ctx, lockCmd, []string{"lock"}, c.id, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.(int64) != c.want {
+			t.Fatalf("case %d: got %v, want %v", i, res, c.want)
+		}
+	}
+	if count, _ := m.HGet(ctx, "lock", "a"); count != "2" {
+		t.Fatalf("reentrant count = %s, want 2", count)
+	}
+
+	if _, err := m.Eval(ctx, "return nil", nil); err != Nil {
+		t.Fatalf("nil reply err = %v, want Nil", err)
+	}
+	res, err := m.Eval(ctx, "return {redis.call('zadd', KEYS[1], ARGV[1], 'm'), redis.call('zscore', KEYS[1], 'm')}", []string{"z"}, 1700000000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arr := res.([]interface{}); arr[0].(int64) != 1 || arr[1].(string) != "1700000000000" {
+		t.Fatalf("eval array = %v", arr)
+	}
+	if _, err = m.Eval(ctx, "return redis.call('lpop', KEYS[1])", []string{"z"}); err == nil {
+		t.Fatal("expected WRONGTYPE error")
+	}
+}
@@ -0,0 +1,190 @@
+package redis_store
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+type v6Client struct {
+	cli *redis.Client
+}
+
+// NewV6 包装go-redis v6的客户端
+func NewV6(cli *redis.Client) Client {
+	return &v6Client{cli: cli}
+}
+
+func v6Err(err error) error {
+	if err == redis.Nil {
+		return Nil
+	}
+	return err
+}
+
+func (c *v6Client) Ping(ctx context.Context) error {
+	return c.cli.WithContext(ctx).Ping().Err()
+}
+
+func (c *v6Client) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.cli.WithContext(ctx).Get(key).Result()
+	return val, v6Err(err)
+}
+
+func (c *v6Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return c.cli.WithContext(ctx).Set(key, value, expiration).Err()
+}
+
+func (c *v6Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.cli.WithContext(ctx).SetNX(key, value, expiration).Result()
+}
+
+func (c *v6Client) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return c.cli.WithContext(ctx).IncrBy(key, value).Result()
+}
+
+func (c *v6Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return c.cli.WithContext(ctx).Del(keys...).Result()
+}
+
+func (c *v6Client) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return c.cli.WithContext(ctx).Exists(keys...).Result()
+}
+
+func (c *v6Client) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return c.cli.WithContext(ctx).Expire(key, expiration).Result()
+}
+
+func (c *v6Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.cli.WithContext(ctx).TTL(key).Result()
+}
+
+func (c *v6Client) Rename(ctx context.Context, key, newKey string) error {
+	return c.cli.WithContext(ctx).Rename(key, newKey).Err()
+}
+
+func (c *v6Client) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.cli.WithContext(ctx).LPush(key, values...).Result()
+}
+
+func (c *v6Client) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.cli.WithContext(ctx).RPush(key, values...).Result()
+}
+
+func (c *v6Client) LPop(ctx context.Context, key string) (string, error) {
+	val, err := c.cli.WithContext(ctx).LPop(key).Result()
+	return val, v6Err(err)
+}
+
+func (c *v6Client) RPop(ctx context.Context, key string) (string, error) {
+	val, err := c.cli.WithContext(ctx).RPop(key).Result()
+	return val, v6Err(err)
+}
+
+func (c *v6Client) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	val, err := c.cli.WithContext(ctx).BLPop(timeout, keys...).Result()
+	return val, v6Err(err)
+}
+
+func (c *v6Client) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return c.cli.WithContext(ctx).LRange(key, start, stop).Result()
+}
+
+func (c *v6Client) LLen(ctx context.Context, key string) (int64, error) {
+	return c.cli.WithContext(ctx).LLen(key).Result()
+}
+
+func (c *v6Client) LTrim(ctx context.Context, key string, start, stop int64) error {
+	return c.cli.WithContext(ctx).LTrim(key, start, stop).Err()
+}
+
+func (c *v6Client) HGet(ctx context.Context, key, field string) (string, error) {
+	val, err := c.cli.WithContext(ctx).HGet(key, field).Result()
+	return val, v6Err(err)
+}
+
+func (c *v6Client) HSet(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	//v6的HSet只支持单个field，逐个设置
+	cli := c.cli.WithContext(ctx)
+	var added int64
+	for i := 0; i+1 < len(values); i += 2 {
+		ok, err := cli.HSet(key, toArg(values[i]), values[i+1]).Result()
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (c *v6Client) HExists(ctx context.Context, key, field string) (bool, error) {
+	return c.cli.WithContext(ctx).HExists(key, field).Result()
+}
+
+func (c *v6Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.cli.WithContext(ctx).HGetAll(key).Result()
+}
+
+func (c *v6Client) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return c.cli.WithContext(ctx).HDel(key, fields...).Result()
+}
+
+func (c *v6Client) HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error) {
+	return c.cli.WithContext(ctx).HIncrBy(key, field, incr).Result()
+}
+
+func (c *v6Client) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	zs := make([]redis.Z, 0, len(members))
+	for _, m := range members {
+		zs = append(zs, redis.Z{Score: m.Score, Member: m.Member})
+	}
+	return c.cli.WithContext(ctx).ZAdd(key, zs...).Result()
+}
+
+func (c *v6Client) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	ms := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		ms = append(ms, m)
+	}
+	return c.cli.WithContext(ctx).ZRem(key, ms...).Result()
+}
+
+func (c *v6Client) ZScore(ctx context.Context, key, member string) (float64, error) {
+	val, err := c.cli.WithContext(ctx).ZScore(key, member).Result()
+	return val, v6Err(err)
+}
+
+func (c *v6Client) ZCard(ctx context.Context, key string) (int64, error) {
+	return c.cli.WithContext(ctx).ZCard(key).Result()
+}
+
+func (c *v6Client) ZRangeByScore(ctx context.Context, key string, opt ZRangeBy) ([]string, error) {
+	return c.cli.WithContext(ctx).ZRangeByScore(key, redis.ZRangeBy{Min: opt.Min, Max: opt.Max, Offset: opt.Offset, Count: opt.Count}).Result()
+}
+
+func (c *v6Client) ZRangeByScoreWithScores(ctx context.Context, key string, opt ZRangeBy) ([]Z, error) {
+	zs, err := c.cli.WithContext(ctx).ZRangeByScoreWithScores(key, redis.ZRangeBy{Min: opt.Min, Max: opt.Max, Offset: opt.Offset, Count: opt.Count}).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Z, 0, len(zs))
+	for _, z := range zs {
+		res = append(res, Z{Score: z.Score, Member: toArg(z.Member)})
+	}
+	return res, nil
+}
+
+func (c *v6Client) SetBit(ctx context.Context, key string, offset int64, value int) (int64, error) {
+	return c.cli.WithContext(ctx).SetBit(key, offset, value).Result()
+}
+
+func (c *v6Client) GetBit(ctx context.Context, key string, offset int64) (int64, error) {
+	return c.cli.WithContext(ctx).GetBit(key, offset).Result()
+}
+
+func (c *v6Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	val, err := c.cli.WithContext(ctx).Eval(script, keys, args...).Result()
+	return val, v6Err(err)
+}
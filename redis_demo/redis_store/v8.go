@@ -0,0 +1,178 @@
+package redis_store
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+type v8Client struct {
+	cli *redis.Client
+}
+
+// NewV8 包装go-redis v8的客户端
+func NewV8(cli *redis.Client) Client {
+	return &v8Client{cli: cli}
+}
+
+func v8Err(err error) error {
+	if err == redis.Nil {
+		return Nil
+	}
+	return err
+}
+
+func (c *v8Client) Ping(ctx context.Context) error {
+	return c.cli.Ping(ctx).Err()
+}
+
+func (c *v8Client) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.cli.Get(ctx, key).Result()
+	return val, v8Err(err)
+}
+
+func (c *v8Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return c.cli.Set(ctx, key, value, expiration).Err()
+}
+
+func (c *v8Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.cli.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (c *v8Client) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return c.cli.IncrBy(ctx, key, value).Result()
+}
+
+func (c *v8Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return c.cli.Del(ctx, keys...).Result()
+}
+
+func (c *v8Client) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return c.cli.Exists(ctx, keys...).Result()
+}
+
+func (c *v8Client) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return c.cli.Expire(ctx, key, expiration).Result()
+}
+
+func (c *v8Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.cli.TTL(ctx, key).Result()
+}
+
+func (c *v8Client) Rename(ctx context.Context, key, newKey string) error {
+	return c.cli.Rename(ctx, key, newKey).Err()
+}
+
+func (c *v8Client) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.cli.LPush(ctx, key, values...).Result()
+}
+
+func (c *v8Client) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.cli.RPush(ctx, key, values...).Result()
+}
+
+func (c *v8Client) LPop(ctx context.Context, key string) (string, error) {
+	val, err := c.cli.LPop(ctx, key).Result()
+	return val, v8Err(err)
+}
+
+func (c *v8Client) RPop(ctx context.Context, key string) (string, error) {
+	val, err := c.cli.RPop(ctx, key).Result()
+	return val, v8Err(err)
+}
+
+func (c *v8Client) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	val, err := c.cli.BLPop(ctx, timeout, keys...).Result()
+	return val, v8Err(err)
+}
+
+func (c *v8Client) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return c.cli.LRange(ctx, key, start, stop).Result()
+}
+
+func (c *v8Client) LLen(ctx context.Context, key string) (int64, error) {
+	return c.cli.LLen(ctx, key).Result()
+}
+
+func (c *v8Client) LTrim(ctx context.Context, key string, start, stop int64) error {
+	return c.cli.LTrim(ctx, key, start, stop).Err()
+}
+
+func (c *v8Client) HGet(ctx context.Context, key, field string) (string, error) {
+	val, err := c.cli.HGet(ctx, key, field).Result()
+	return val, v8Err(err)
+}
+
+func (c *v8Client) HSet(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.cli.HSet(ctx, key, values...).Result()
+}
+
+func (c *v8Client) HExists(ctx context.Context, key, field string) (bool, error) {
+	return c.cli.HExists(ctx, key, field).Result()
+}
+
+func (c *v8Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.cli.HGetAll(ctx, key).Result()
+}
+
+func (c *v8Client) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return c.cli.HDel(ctx, key, fields...).Result()
+}
+
+func (c *v8Client) HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error) {
+	return c.cli.HIncrBy(ctx, key, field, incr).Result()
+}
+
+func (c *v8Client) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	zs := make([]*redis.Z, 0, len(members))
+	for _, m := range members {
+		zs = append(zs, &redis.Z{Score: m.Score, Member: m.Member})
+	}
+	return c.cli.ZAdd(ctx, key, zs...).Result()
+}
+
+func (c *v8Client) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	ms := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		ms = append(ms, m)
+	}
+	return c.cli.ZRem(ctx, key, ms...).Result()
+}
+
+func (c *v8Client) ZScore(ctx context.Context, key, member string) (float64, error) {
+	val, err := c.cli.ZScore(ctx, key, member).Result()
+	return val, v8Err(err)
+}
+
+func (c *v8Client) ZCard(ctx context.Context, key string) (int64, error) {
+	return c.cli.ZCard(ctx, key).Result()
+}
+
+func (c *v8Client) ZRangeByScore(ctx context.Context, key string, opt ZRangeBy) ([]string, error) {
+	return c.cli.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: opt.Min, Max: opt.Max, Offset: opt.Offset, Count: opt.Count}).Result()
+}
+
+func (c *v8Client) ZRangeByScoreWithScores(ctx context.Context, key string, opt ZRangeBy) ([]Z, error) {
+	zs, err := c.cli.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: opt.Min, Max: opt.Max, Offset: opt.Offset, Count: opt.Count}).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Z, 0, len(zs))
+	for _, z := range zs {
+		res = append(res, Z{Score: z.Score, Member: toArg(z.Member)})
+	}
+	return res, nil
+}
+
+func (c *v8Client) SetBit(ctx context.Context, key string, offset int64, value int) (int64, error) {
+	return c.cli.SetBit(ctx, key, offset, value).Result()
+}
+
+func (c *v8Client) GetBit(ctx context.Context, key string, offset int64) (int64, error) {
+	return c.cli.GetBit(ctx, key, offset).Result()
+}
+
+func (c *v8Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	val, err := c.cli.Eval(ctx, script, keys, args...).Result()
+	return val, v8Err(err)
+}
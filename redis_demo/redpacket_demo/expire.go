@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/redis_store"
+	"time"
+)
+
+/*
+红包过期退款：
+1. 发红包时把红包id按过期时间放入zset
+2. 后台任务定时取出已经过期的红包，通过lua脚本把剩余的红包金额汇总后退回给发红包的用户
+3. 退款和抢红包都是lua脚本，不会出现同一个红包既被抢又被退的情况；多个服务同时执行退款也只会退一次
+*/
+
+var (
+	// 每次最多处理的过期红包数量
+	expireBatchSize int64 = 100
+	// 退款之后红包信息、领取记录的保留时间，单位: s
+	refundedRetention = int64(time.Hour * 24 / time.Second)
+)
+
+// 退款的lua脚本
+// ARGV: 红包id, 当前时间(ms), 退款后的保留时间(s)
+// 返回值：退回的金额，红包未过期或已经退过款时返回-1
+var refundCmd = "local expireAt = redis.call('hget', KEYS[3], 'expireAt') " +
+	"if expireAt and tonumber(expireAt) > tonumber(ARGV[2]) then " +
+	"   return -1 " +
+	"end " +
+	"redis.call('zrem', KEYS[4], ARGV[1]) " +
+	"if not expireAt or redis.call('hexists', KEYS[3], 'refunded') == 1 then " +
+	"   return -1 " +
+	"end " +
+	"local sum = 0 " +
+	"for _, money in ipairs(redis.call('lrange', KEYS[1], 0, -1)) do " +
+	"   sum = sum + tonumber(money) " +
+	"end " +
+	"redis.call('del', KEYS[1]) " +
+	"redis.call('hset', KEYS[3], 'refunded', sum) " +
+	"if sum > 0 then " +
+	"   redis.call('rpush', KEYS[5], 'refund|' .. ARGV[1] .. '|' .. redis.call('hget', KEYS[3], 'sender') .. '|' .. sum .. '|' .. ARGV[2]) " +
+	"end " +
+	"redis.call('expire', KEYS[3], ARGV[3]) " +
+	"redis.call('expire', KEYS[2], ARGV[3]) " +
+	"return sum"
+
+// refundRedPacket 退回过期红包中未领取的金额，返回-1表示不需要退款
+func refundRedPacket(redPacket string, now time.Time) (int64, error) {
+	result, err := RedisCli.Eval(context.TODO(), refundCmd, redPacketKeys(redPacket), redPacket, now.UnixMilli(), refundedRetention)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// sweepExpiredRedPackets 处理一批已经过期的红包，返回处理的数量
+func sweepExpiredRedPackets(now time.Time) (int, error) {
+	redPackets, err := RedisCli.ZRangeByScore(context.TODO(), RED_PACKAGE_EXPIRE_KEY, redis_store.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprintf("%d", now.UnixMilli()),
+		Count: expireBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, redPacket := range redPackets {
+		refund, err := refundRedPacket(redPacket, now)
+		if err != nil {
+			return 0, err
+		}
+		if refund >= 0 {
+			log.Infof("redpacket[%s] expired, refund %d", redPacket, refund)
+		}
+	}
+	return len(redPackets), nil
+}
+
+func startExpireSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for {
+			n, err := sweepExpiredRedPackets(time.Now())
+			if err != nil {
+				log.Errorf("sweep expired redpacket err %v", err)
+				break
+			}
+			if int64(n) < expireBatchSize {
+				break
+			}
+		}
+	}
+}
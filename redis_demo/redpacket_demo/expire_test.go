@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"testing"
+	"time"
+)
+
+func TestRefundExpiredRedPacket(t *testing.T) {
+	RedisCli = redis_store.NewMemory()
+	now := time.Now()
+	if err := saveRedPacket("p", 7, 100, []int64{30, 30, 40}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if status, money, err := grabRedPacket("p", 1); err != nil || status != grabSuccess || money != "30" {
+		t.Fatalf("grab = %d %s %v", status, money, err)
+	}
+
+	//未过期时不退款
+	if refund, _ := refundRedPacket("p", now); refund != -1 {
+		t.Fatalf("refund before expiry = %d", refund)
+	}
+	if n, _ := sweepExpiredRedPackets(now); n != 0 {
+		t.Fatalf("swept %d red packets before expiry", n)
+	}
+
+	//过期后退回未领取的金额，只退一次
+	if n, err := sweepExpiredRedPackets(now.Add(time.Hour * 2)); err != nil || n != 1 {
+		t.Fatalf("sweep = %d, %v", n, err)
+	}
+	if refund, _ := RedisCli.HGet(context.TODO(), RED_PACKAGE_META_KEY+"p", "refunded"); refund != "70" {
+		t.Fatalf("refunded = %s, want 70", refund)
+	}
+	if refund, _ := refundRedPacket("p", now.Add(time.Hour*3)); refund != -1 {
+		t.Fatalf("second refund = %d", refund)
+	}
+	if n, _ := sweepExpiredRedPackets(now.Add(time.Hour * 3)); n != 0 {
+		t.Fatalf("swept %d red packets after refund", n)
+	}
+	//退款后不能再抢
+	if status, _, _ := grabRedPacket("p", 2); status == grabSuccess {
+		t.Fatal("grab after refund")
+	}
+}
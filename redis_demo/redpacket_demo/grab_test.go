@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"myTest/demo_home/redis_demo/redis_store"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGrabRedPacket(t *testing.T) {
+	RedisCli = redis_store.NewMemory()
+	if err := saveRedPacket("p", 7, 100, []int64{60, 40}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if status, money, err := grabRedPacket("p", 1); err != nil || status != grabSuccess || money != "60" {
+		t.Fatalf("grab = %d %s %v", status, money, err)
+	}
+	//已经抢过时返回之前抢到的金额，不会再取出一个红包
+	if status, money, _ := grabRedPacket("p", 1); status != grabAlreadyRobbed || money != "60" {
+		t.Fatalf("grab again = %d %s", status, money)
+	}
+	if status, money, _ := grabRedPacket("p", 2); status != grabSuccess || money != "40" {
+		t.Fatalf("grab last = %d %s", status, money)
+	}
+	if status, _, _ := grabRedPacket("p", 3); status != grabEmpty {
+		t.Fatalf("grab empty = %d", status)
+	}
+	consume, _ := RedisCli.HGetAll(context.TODO(), RED_PACKAGE_CONSUME_KEY+"p")
+	if len(consume) != 2 || consume["1"] != "60" || consume["2"] != "40" {
+		t.Fatalf("consume = %v", consume)
+	}
+	//发红包和两次抢成功都记录流水
+	ledger, _ := RedisCli.LRange(context.TODO(), RED_PACKAGE_LEDGER_KEY, 0, -1)
+	if len(ledger) != 3 || !strings.HasPrefix(ledger[1], "grab|p|1|60|") || !strings.HasPrefix(ledger[2], "grab|p|2|40|") {
+		t.Fatalf("ledger = %v", ledger)
+	}
+}
+
+func TestGrabExpiredRedPacket(t *testing.T) {
+	RedisCli = redis_store.NewMemory()
+	saveRedPacket("p", 7, 100, []int64{60, 40}, time.Now().Add(-time.Second))
+	if status, _, _ := grabRedPacket("p", 1); status != grabExpired {
+		t.Fatalf("grab expired = %d", status)
+	}
+	if n, _ := RedisCli.LLen(context.TODO(), RED_PACKGE_KEY+"p"); n != 2 {
+		t.Fatalf("%d red packets left, want 2", n)
+	}
+}
+
+func TestConcurrentGrab(t *testing.T) {
+	RedisCli = redis_store.NewMemory()
+	const total, shares, users = 10000, 10, 50
+	strategy, _ := getSplitStrategy("")
+	redPackets, err := strategy.Split(total, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveRedPacket("p", 7, total, redPackets, time.Now().Add(time.Hour))
+
+	//每个用户并发抢两次，同一个用户只能抢到一个红包
+	var mu sync.Mutex
+	wins := make(map[int]int64)
+	var wg sync.WaitGroup
+	for i := 0; i < users*2; i++ {
+		uId := i % users
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, money, err := grabRedPacket("p", uId)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if status != grabSuccess {
+				return
+			}
+			n, _ := strconv.ParseInt(money, 10, 64)
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := wins[uId]; ok {
+				t.Errorf("user %d grabbed twice", uId)
+			}
+			wins[uId] = n
+		}()
+	}
+	wg.Wait()
+	if len(wins) != shares {
+		t.Fatalf("%d wins, want %d", len(wins), shares)
+	}
+	var sum int64
+	for _, n := range wins {
+		sum += n
+	}
+	if sum != total {
+		t.Fatalf("sum of wins = %d, want %d", sum, total)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/lib/pq"
+	"github.com/ziyifast/log"
+	"myTest/demo_home/redis_demo/distributed_lock/lock"
+	"strconv"
+	"strings"
+	"time"
+	"xorm.io/xorm"
+)
+
+/*
+红包流水：
+1. 发、抢、退在lua脚本里把流水追加到redis list，和业务操作保持原子性
+2. 后台任务批量读取list中的流水写入数据库，写入成功后再从list中删除，保证流水至少写入一次
+3. 每条流水有唯一的BizId，重复写入时直接跳过；多个服务通过分布式锁保证同一时间只有一个在搬运流水
+*/
+
+const (
+	LedgerTypeSend   = "send"
+	LedgerTypeGrab   = "grab"
+	LedgerTypeRefund = "refund"
+)
+
+var (
+	ledgerBatchSize int64 = 100
+	ledgerLockKey         = "redpackage:ledger:lock"
+)
+
+type LedgerRecord struct {
+	Id int64 `xorm:"pk autoincr 'id'" json:"id"`
+	// 业务唯一标识：类型:红包id:用户id
+	BizId     string    `xorm:"'biz_id' unique" json:"bizId"`
+	PacketId  string    `xorm:"'packet_id' index" json:"packetId"`
+	UserId    int64     `xorm:"'user_id' index" json:"userId"`
+	Type      string    `xorm:"'type'" json:"type"`
+	Amount    int64     `xorm:"'amount'" json:"amount"`
+	CreatedAt time.Time `xorm:"'created_at'" json:"createdAt"`
+}
+
+func (r *LedgerRecord) TableName() string {
+	return "red_packet_ledger"
+}
+
+// parseLedgerRecord 解析lua脚本中写入的流水：类型|红包id|用户id|金额|时间(ms)
+func parseLedgerRecord(s string) (*LedgerRecord, error) {
+	fields := strings.Split(s, "|")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid ledger record %q", s)
+	}
+	userId, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ledger record %q: %v", s, err)
+	}
+	amount, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ledger record %q: %v", s, err)
+	}
+	ts, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ledger record %q: %v", s, err)
+	}
+	return &LedgerRecord{
+		BizId:     fmt.Sprintf("%s:%s:%d", fields[0], fields[1], userId),
+		PacketId:  fields[1],
+		UserId:    userId,
+		Type:      fields[0],
+		Amount:    amount,
+		CreatedAt: time.UnixMilli(ts),
+	}, nil
+}
+
+type LedgerStore interface {
+	// Save 保存流水，BizId已经存在时直接返回
+	Save(record *LedgerRecord) error
+}
+
+type xormLedgerStore struct {
+	engine *xorm.Engine
+}
+
+func newXormLedgerStore(engine *xorm.Engine) LedgerStore {
+	return &xormLedgerStore{engine: engine}
+}
+
+func (s *xormLedgerStore) Save(record *LedgerRecord) error {
+	exist, err := s.engine.Where("biz_id=?", record.BizId).Exist(new(LedgerRecord))
+	if err != nil {
+		return err
+	}
+	if exist {
+		return nil
+	}
+	_, err = s.engine.InsertOne(record)
+	return err
+}
+
+const (
+	host     = "localhost"
+	port     = 5432
+	user     = "postgres"
+	password = "postgres"
+	dbName   = "postgres"
+)
+
+func initLedgerEngine() *xorm.Engine {
+	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbName)
+	engine, err := xorm.NewEngine("postgres", psqlInfo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	engine.SetMaxIdleConns(10)
+	engine.SetMaxOpenConns(20)
+	engine.SetConnMaxLifetime(time.Minute * 10)
+	if err = engine.Ping(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err = engine.Sync2(new(LedgerRecord)); err != nil {
+		log.Fatalf("%v", err)
+	}
+	return engine
+}
+
+// flushLedger 把一批流水从redis写入数据库，返回写入的数量
+func flushLedger(store LedgerStore) (int, error) {
+	records, err := RedisCli.LRange(context.TODO(), RED_PACKAGE_LEDGER_KEY, 0, ledgerBatchSize-1)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	for _, r := range records {
+		record, err := parseLedgerRecord(r)
+		if err != nil {
+			//格式错误的流水无法重试，记录日志后跳过
+			log.Errorf("%v", err)
+			continue
+		}
+		if err = store.Save(record); err != nil {
+			return 0, err
+		}
+	}
+	//只有持有锁的服务会删除list头部的流水，lua脚本只会在尾部追加，不会删掉未写入的流水
+	err = RedisCli.LTrim(context.TODO(), RED_PACKAGE_LEDGER_KEY, int64(len(records)), -1)
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func startLedgerWriter(store LedgerStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ledgerLock := lock.NewRedisLock(RedisCli, ledgerLockKey)
+		if !ledgerLock.TryLock() {
+			continue
+		}
+		for {
+			n, err := flushLedger(store)
+			if err != nil {
+				log.Errorf("flush ledger err %v", err)
+				break
+			}
+			if int64(n) < ledgerBatchSize {
+				break
+			}
+		}
+		ledgerLock.Unlock()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"myTest/demo_home/redis_demo/redis_store"
+	"testing"
+	"time"
+)
+
+// memLedgerStore 与xormLedgerStore一致：BizId已经存在时跳过；failAt大于0时第failAt次写入失败
+type memLedgerStore struct {
+	records map[string]*LedgerRecord
+	inserts int
+	saves   int
+	failAt  int
+}
+
+func (s *memLedgerStore) Save(record *LedgerRecord) error {
+	s.saves++
+	if s.saves == s.failAt {
+		return errors.New("db unavailable")
+	}
+	if _, ok := s.records[record.BizId]; ok {
+		return nil
+	}
+	s.records[record.BizId] = record
+	s.inserts++
+	return nil
+}
+
+func TestFlushLedgerAtLeastOnce(t *testing.T) {
+	RedisCli = redis_store.NewMemory()
+	saveRedPacket("p", 7, 100, []int64{30, 30, 40}, time.Now().Add(time.Hour))
+	grabRedPacket("p", 1)
+	refundRedPacket("p", time.Now().Add(time.Hour*2))
+
+	//第二条写入失败时不删除redis中的流水
+	store := &memLedgerStore{records: make(map[string]*LedgerRecord), failAt: 2}
+	if _, err := flushLedger(store); err == nil {
+		t.Fatal("flush should fail")
+	}
+	if n, _ := RedisCli.LLen(context.TODO(), RED_PACKAGE_LEDGER_KEY); n != 3 {
+		t.Fatalf("ledger list length = %d, want 3", n)
+	}
+
+	//重试时重新写入所有流水，已经写入的BizId跳过
+	store.failAt = 0
+	if n, err := flushLedger(store); err != nil || n != 3 {
+		t.Fatalf("flush = %d, %v", n, err)
+	}
+	if store.inserts != 3 {
+		t.Fatalf("inserts = %d, want 3", store.inserts)
+	}
+	for bizId, amount := range map[string]int64{"send:p:7": 100, "grab:p:1": 30, "refund:p:7": 70} {
+		if r := store.records[bizId]; r == nil || r.Amount != amount {
+			t.Fatalf("record %s = %+v", bizId, r)
+		}
+	}
+	if n, _ := flushLedger(store); n != 0 {
+		t.Fatalf("flush after trim = %d", n)
+	}
+}
@@ -8,30 +8,44 @@ import (
 	"github.com/kataras/iris/v12"
 	context2 "github.com/kataras/iris/v12/context"
 	"math/rand"
+	"myTest/demo_home/redis_demo/redis_store"
+	"net/http"
 	"time"
 )
 
 /*
 通过redis实现迷你版微信抢红包
 1. 发红包
-2. 拆红包（一个红包拆分成多少个，每个红包里有多少钱）=》二倍均值算法，将拆分后的红包通过list放入redis
-3. 抢红包（用户抢红包，并记录哪个用户抢了多少钱，防止重复抢）：hset记录每个红包被哪些用户抢了
+2. 拆红包（一个红包拆分成多少个，每个红包里有多少钱）=》二倍均值、线段切割、固定金额，金额单位为分，将拆分后的红包通过list放入redis
+3. 抢红包（用户抢红包，并记录哪个用户抢了多少钱，防止重复抢）：hset记录每个红包被哪些用户抢了，判断、取红包、记录通过lua脚本原子完成
+4. 红包过期：发红包时记录过期时间，过期后由后台任务将未领取的金额退回给发红包的用户
+5. 流水：发、抢、退的记录先写入redis list，再异步写入数据库，用于年度总结等统计
 */
 var (
-	RedisCli                *redis.Client
+	RedisCli                redis_store.Client
 	RED_PACKGE_KEY          = "redpackage:"
 	RED_PACKAGE_CONSUME_KEY = "redpackage:consume:"
+	// 红包信息：发红包的用户、总金额、个数、过期时间、退款金额
+	RED_PACKAGE_META_KEY = "redpackage:meta:"
+	// 按过期时间排序的红包，score为过期时间(ms)
+	RED_PACKAGE_EXPIRE_KEY = "redpackage:expire"
+	// 待写入数据库的流水
+	RED_PACKAGE_LEDGER_KEY = "redpackage:ledger"
+	// 红包默认的过期时间
+	defaultRedPacketExpire = time.Hour * 24
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
-	RedisCli = redis.NewClient(&redis.Options{
+	RedisCli = redis_store.NewV8(redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
 		DB:   0,
-	})
+	}))
 }
 
 func main() {
+	go startExpireSweeper(time.Second * 10)
+	go startLedgerWriter(newXormLedgerStore(initLedgerEngine()), time.Second)
 	app := iris.New()
 	app.Get("/send", sendRedPacket)
 	app.Get("/rob", robRedPacket)
@@ -39,82 +53,132 @@ func main() {
 	app.Listen(":9090", nil)
 }
 
-// 发红包 http://localhost:9090/send?totalMoney=100&totalNum=3
+// 发红包，金额单位为分 http://localhost:9090/send?totalMoney=10000&totalNum=3&uId=1&expire=86400&strategy=double_mean
 func sendRedPacket(c *context2.Context) {
-	money, _ := c.URLParamInt("totalMoney")
+	money := c.URLParamInt64Default("totalMoney", 0)
 	totalNum, _ := c.URLParamInt("totalNum")
-	redPackets := splitRedPacket(money, totalNum)
+	uId, _ := c.URLParamInt("uId")
+	expire := time.Duration(c.URLParamInt64Default("expire", int64(defaultRedPacketExpire/time.Second))) * time.Second
+	if expire <= 0 {
+		c.StatusCode(http.StatusBadRequest)
+		c.JSON("expire must be greater than 0")
+		return
+	}
+	strategy, err := getSplitStrategy(c.URLParam("strategy"))
+	if err != nil {
+		c.StatusCode(http.StatusBadRequest)
+		c.JSON(err.Error())
+		return
+	}
+	redPackets, err := strategy.Split(money, totalNum)
+	if err != nil {
+		c.StatusCode(http.StatusBadRequest)
+		c.JSON(err.Error())
+		return
+	}
 	uuid, _ := uuid.NewUUID()
-	k := RED_PACKGE_KEY + uuid.String()
+	err = saveRedPacket(uuid.String(), uId, money, redPackets, time.Now().Add(expire))
+	if err != nil {
+		panic(err)
+	}
+	c.JSON(fmt.Sprintf("send redpacket[%s] succ %v", RED_PACKGE_KEY+uuid.String(), redPackets))
+}
+
+// 红包相关的key，所有lua脚本都按这个顺序传入KEYS
+func redPacketKeys(redPacket string) []string {
+	return []string{
+		RED_PACKGE_KEY + redPacket,
+		RED_PACKAGE_CONSUME_KEY + redPacket,
+		RED_PACKAGE_META_KEY + redPacket,
+		RED_PACKAGE_EXPIRE_KEY,
+		RED_PACKAGE_LEDGER_KEY,
+	}
+}
+
+// 发红包的lua脚本：拆分后的红包、红包信息、过期时间、流水在同一个脚本里写入
+// ARGV: 红包id, 发红包的用户, 总金额, 过期时间(ms), 当前时间(ms), 拆分后的红包...
+var sendCmd = "for i = 6, #ARGV do " +
+	"   redis.call('rpush', KEYS[1], ARGV[i]) " +
+	"end " +
+	"redis.call('hset', KEYS[3], 'sender', ARGV[2], 'total', ARGV[3], 'num', #ARGV - 5, 'expireAt', ARGV[4]) " +
+	"redis.call('zadd', KEYS[4], ARGV[4], ARGV[1]) " +
+	"redis.call('rpush', KEYS[5], 'send|' .. ARGV[1] .. '|' .. ARGV[2] .. '|' .. ARGV[3] .. '|' .. ARGV[5]) " +
+	"return 1"
+
+func saveRedPacket(redPacket string, sender int, totalMoney int64, redPackets []int64, expireAt time.Time) error {
+	args := []interface{}{redPacket, sender, totalMoney, expireAt.UnixMilli(), time.Now().UnixMilli()}
 	for _, r := range redPackets {
-		_, err := RedisCli.LPush(context.TODO(), k, r).Result()
-		if err != nil && err != redis.Nil {
-			panic(err)
-		}
+		args = append(args, r)
 	}
-	c.JSON(fmt.Sprintf("send redpacket[%s] succ %v", k, redPackets))
+	_, err := RedisCli.Eval(context.TODO(), sendCmd, redPacketKeys(redPacket), args...)
+	return err
 }
 
 // 抢红包 http://localhost:9090/rob?redPacket=e3e71f56-e9a3-11ee-9ad5-7a2cb90a4104&uId=4
 func robRedPacket(c *context2.Context) {
-	//判断是否抢过
 	redPacket := c.URLParam("redPacket")
 	uId, _ := c.URLParamInt("uId")
-	exists, err := RedisCli.HExists(context.TODO(), RED_PACKAGE_CONSUME_KEY+redPacket, fmt.Sprintf("%d", uId)).Result()
-	if err != nil && err != redis.Nil {
+	status, money, err := grabRedPacket(redPacket, uId)
+	if err != nil {
 		panic(err)
 	}
-	if exists {
+	switch status {
+	case grabAlreadyRobbed:
 		//表明已经抢过
-		c.JSON(fmt.Sprintf("[%d] you have already rob", uId))
-		return
-	} else if !exists {
-		//从list里取出一个红包
-		result, err := RedisCli.LPop(context.TODO(), RED_PACKGE_KEY+redPacket).Result()
-		if err == redis.Nil {
-			//红包已经抢完了
-			c.JSON(fmt.Sprintf("redpacket is empty"))
-			return
-		}
-		if err != nil {
-			panic(err)
-		}
-		fmt.Printf("%d rob the red packet %v\n", uId, result)
-		//记录：后续可以异步进MySQL或者MQ做统计分析，每一年抢了多少红包，金额是多少【年度总结】
-		_, err = RedisCli.HSet(context.TODO(), RED_PACKAGE_CONSUME_KEY+redPacket, uId, result).Result()
-		if err != nil && err != redis.Nil {
-			panic(err)
-		}
-		c.JSON(fmt.Sprintf("[%d] rob the red packet %v", uId, result))
+		c.JSON(fmt.Sprintf("[%d] you have already rob %v", uId, money))
+	case grabEmpty:
+		//红包已经抢完了
+		c.JSON(fmt.Sprintf("redpacket is empty"))
+	case grabExpired:
+		c.JSON(fmt.Sprintf("redpacket is expired"))
+	default:
+		fmt.Printf("%d rob the red packet %v\n", uId, money)
+		c.JSON(fmt.Sprintf("[%d] rob the red packet %v", uId, money))
 	}
+}
+
+const (
+	grabSuccess = iota
+	grabAlreadyRobbed
+	grabEmpty
+	grabExpired
+)
+
+// 抢红包的lua脚本：判断是否抢过、是否过期、从list里取出一个红包、记录抢红包的用户在同一个脚本里完成，
+// 防止同一个用户并发请求时，多次通过判断抢到多个红包
+// ARGV: 用户id, 红包id, 当前时间(ms)
+// 返回值：{状态, 金额}，已经抢过时返回之前抢到的金额
+var grabCmd = "local money = redis.call('hget', KEYS[2], ARGV[1]) " +
+	"if money then " +
+	"   return {1, money} " +
+	"end " +
+	"local expireAt = redis.call('hget', KEYS[3], 'expireAt') " +
+	"if expireAt and tonumber(expireAt) <= tonumber(ARGV[3]) then " +
+	"   return {3, ''} " +
+	"end " +
+	"money = redis.call('lpop', KEYS[1]) " +
+	"if not money then " +
+	"   return {2, ''} " +
+	"end " +
+	"redis.call('hset', KEYS[2], ARGV[1], money) " +
+	//记录流水：异步写入数据库做统计分析，每一年抢了多少红包，金额是多少【年度总结】
+	"redis.call('rpush', KEYS[5], 'grab|' .. ARGV[2] .. '|' .. ARGV[1] .. '|' .. money .. '|' .. ARGV[3]) " +
+	"return {0, money}"
 
+func grabRedPacket(redPacket string, uId int) (status int64, money string, err error) {
+	result, err := RedisCli.Eval(context.TODO(), grabCmd, redPacketKeys(redPacket), uId, redPacket, time.Now().UnixMilli())
+	if err != nil {
+		return 0, "", err
+	}
+	reply := result.([]interface{})
+	return reply[0].(int64), reply[1].(string), nil
 }
 
 func infoRedPacket(c *context2.Context) {
 	redPacket := c.URLParam("redPacket")
-	infoMap, err := RedisCli.HGetAll(context.TODO(), RED_PACKAGE_CONSUME_KEY+redPacket).Result()
-	if err != nil && err != redis.Nil {
+	infoMap, err := RedisCli.HGetAll(context.TODO(), RED_PACKAGE_CONSUME_KEY+redPacket)
+	if err != nil {
 		panic(err)
 	}
 	c.JSON(infoMap)
 }
-
-// 拆红包
-func splitRedPacket(totalMoney, totalNum int) []int {
-	//1. 将红包拆分为几个
-	redpackets := make([]int, totalNum)
-	usedMoney := 0
-	for i := 0; i < totalNum; i++ {
-		//最后一个红包，还剩余多少就分多少
-		if i == totalNum-1 {
-			redpackets[i] = totalMoney - usedMoney
-		} else {
-			//二倍均值算法：每次拆分后塞进子红包的金额 = 随机区间(0, (剩余红包金额M / 未被抢的剩余红包个数N) * 2)
-			avgMoney := ((totalMoney - usedMoney) / (totalNum - i)) * 2
-			money := 1 + rand.Intn(avgMoney-1)
-			redpackets[i] = money
-			usedMoney += money
-		}
-	}
-	return redpackets
-}
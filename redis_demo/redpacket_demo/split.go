@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+/*
+拆红包的策略，金额单位统一为分：
+1. 二倍均值法：每个红包的金额 = 随机区间[最小金额, 剩余金额/剩余个数*2)，最后一个红包拿走剩余金额
+2. 线段切割法：在扣除每个红包最小金额后的线段上随机切num-1刀，每一段就是一个红包
+3. 固定金额：每个红包的金额相同
+拆分前先校验参数，保证每个红包都能分到最小金额，避免拆分过程中出现rand.Intn(<=0)
+*/
+
+// 每个红包的最小金额，单位: 分
+var minPerPacket int64 = 1
+
+var (
+	ErrInvalidRedPacketNum   = errors.New("redpacket num must be greater than 0")
+	ErrInvalidRedPacketMoney = errors.New("redpacket money is not enough")
+)
+
+type SplitStrategy interface {
+	// Split 把totalMoney拆分为totalNum个红包，返回每个红包的金额
+	Split(totalMoney int64, totalNum int) ([]int64, error)
+}
+
+var splitStrategies = map[string]SplitStrategy{
+	"double_mean": new(doubleMeanSplitter),
+	"line_cut":    new(lineCutSplitter),
+	"fixed":       new(fixedSplitter),
+}
+
+func getSplitStrategy(name string) (SplitStrategy, error) {
+	if name == "" {
+		name = "double_mean"
+	}
+	s, ok := splitStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown split strategy %q", name)
+	}
+	return s, nil
+}
+
+// validateSplit 校验每个红包至少能分到minPerPacket
+func validateSplit(totalMoney int64, totalNum int) error {
+	if totalNum <= 0 {
+		return ErrInvalidRedPacketNum
+	}
+	if totalMoney < int64(totalNum)*minPerPacket {
+		return fmt.Errorf("%w: %d cents for %d redpackets, at least %d cents per redpacket", ErrInvalidRedPacketMoney, totalMoney, totalNum, minPerPacket)
+	}
+	return nil
+}
+
+type doubleMeanSplitter struct{}
+
+func (s *doubleMeanSplitter) Split(totalMoney int64, totalNum int) ([]int64, error) {
+	if err := validateSplit(totalMoney, totalNum); err != nil {
+		return nil, err
+	}
+	redPackets := make([]int64, totalNum)
+	remain := totalMoney
+	for i := 0; i < totalNum-1; i++ {
+		left := int64(totalNum - i)
+		//二倍均值算法：每次拆分后塞进子红包的金额 = 随机区间[min, (剩余红包金额M / 未被抢的剩余红包个数N) * 2)
+		max := remain / left * 2
+		//需要给后面的红包留出最小金额
+		if limit := remain - (left-1)*minPerPacket; max > limit {
+			max = limit
+		}
+		money := minPerPacket
+		if max > minPerPacket {
+			money += rand.Int63n(max - minPerPacket)
+		}
+		redPackets[i] = money
+		remain -= money
+	}
+	//最后一个红包，还剩余多少就分多少
+	redPackets[totalNum-1] = remain
+	return redPackets, nil
+}
+
+type lineCutSplitter struct{}
+
+func (s *lineCutSplitter) Split(totalMoney int64, totalNum int) ([]int64, error) {
+	if err := validateSplit(totalMoney, totalNum); err != nil {
+		return nil, err
+	}
+	//先给每个红包分配最小金额，再把剩余的金额看成一条线段随机切割
+	extra := totalMoney - int64(totalNum)*minPerPacket
+	cuts := make([]int64, 0, totalNum+1)
+	cuts = append(cuts, 0, extra)
+	for i := 0; i < totalNum-1; i++ {
+		cuts = append(cuts, rand.Int63n(extra+1))
+	}
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+	redPackets := make([]int64, totalNum)
+	for i := 0; i < totalNum; i++ {
+		redPackets[i] = minPerPacket + cuts[i+1] - cuts[i]
+	}
+	return redPackets, nil
+}
+
+type fixedSplitter struct{}
+
+func (s *fixedSplitter) Split(totalMoney int64, totalNum int) ([]int64, error) {
+	if err := validateSplit(totalMoney, totalNum); err != nil {
+		return nil, err
+	}
+	if totalMoney%int64(totalNum) != 0 {
+		return nil, fmt.Errorf("%w: %d cents can not be split into %d equal redpackets", ErrInvalidRedPacketMoney, totalMoney, totalNum)
+	}
+	redPackets := make([]int64, totalNum)
+	for i := range redPackets {
+		redPackets[i] = totalMoney / int64(totalNum)
+	}
+	return redPackets, nil
+}
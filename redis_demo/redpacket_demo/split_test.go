@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"testing/quick"
+)
+
+// 任意金额和个数：拆分成功时红包个数正确、总和等于总金额、每个红包不少于最小金额；
+// 金额不够时返回错误而不是panic
+func TestSplitProperties(t *testing.T) {
+	for name, strategy := range splitStrategies {
+		strategy := strategy
+		t.Run(name, func(t *testing.T) {
+			property := func(totalMoney uint32, totalNum uint8) bool {
+				money, num := int64(totalMoney%1000000), int(totalNum)
+				redPackets, err := strategy.Split(money, num)
+				if num == 0 {
+					return errors.Is(err, ErrInvalidRedPacketNum)
+				}
+				if money < int64(num)*minPerPacket {
+					return errors.Is(err, ErrInvalidRedPacketMoney)
+				}
+				if name == "fixed" && money%int64(num) != 0 {
+					return errors.Is(err, ErrInvalidRedPacketMoney)
+				}
+				if err != nil || len(redPackets) != num {
+					return false
+				}
+				var sum int64
+				for _, r := range redPackets {
+					if r < minPerPacket {
+						return false
+					}
+					sum += r
+				}
+				return sum == money
+			}
+			if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// 金额刚好等于个数*最小金额时，每个红包只能分到最小金额
+func TestSplitMinimumMoney(t *testing.T) {
+	for name, strategy := range splitStrategies {
+		redPackets, err := strategy.Split(10*minPerPacket, 10)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, r := range redPackets {
+			if r != minPerPacket {
+				t.Fatalf("%s: got %v", name, redPackets)
+			}
+		}
+	}
+}
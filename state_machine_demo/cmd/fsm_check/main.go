@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"myTest/demo_home/state_machine_demo/state_machine"
+	"os"
+
+	//导入时注册支付状态机
+	_ "myTest/demo_home/state_machine_demo/model"
+)
+
+/*
+导出和检查所有注册的状态机：
+go run ./cmd/fsm_check                 检查所有状态机，有问题（不包括警告）时退出码为1
+go run ./cmd/fsm_check -format=dot     导出为Graphviz DOT，可以通过 dot -Tpng 生成图片
+go run ./cmd/fsm_check -format=mermaid 导出为Mermaid
+*/
+
+var (
+	format  = flag.String("format", "check", "check, dot or mermaid")
+	machine = flag.String("machine", "", "only handle the machine with this name")
+)
+
+func main() {
+	flag.Parse()
+	failed := false
+	for _, def := range state_machine.Registered() {
+		if *machine != "" && def.Name != *machine {
+			continue
+		}
+		switch *format {
+		case "check":
+			problems := def.Validate()
+			for _, p := range problems {
+				if p.Warning() {
+					fmt.Printf("warning: %v\n", p)
+					continue
+				}
+				fmt.Println(p)
+				failed = true
+			}
+			if len(problems) == 0 {
+				fmt.Printf("%s: ok\n", def.Name)
+			}
+		case "dot":
+			fmt.Println(def.DOT())
+		case "mermaid":
+			fmt.Println(def.Mermaid())
+		default:
+			fmt.Fprintf(os.Stderr, "unknown format %s\n", *format)
+			os.Exit(2)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -1,39 +1,273 @@
 package main
 
 import (
+	stdcontext "context"
+	"errors"
+	"flag"
+	"github.com/google/uuid"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
 	"github.com/ziyifast/log"
 	"myTest/demo_home/state_machine_demo/model"
+	"myTest/demo_home/state_machine_demo/state_machine"
+	"net/http"
 	"time"
 )
 
 var (
-	testOrder = new(model.PaymentModel)
+	storeType  = flag.String("store", "memory", "payment order store: memory or sql")
+	payTimeout = flag.Duration("payTimeout", time.Minute*15, "mark order as failed if gateway does not call back in time")
+	repository *state_machine.Repository[model.PaymentStatus, model.PaymentEvent]
+	dispatcher *state_machine.Dispatcher[model.PaymentStatus, model.PaymentEvent]
 )
 
+type PaymentSubmission = state_machine.Submission[model.PaymentEvent]
+
+// GatewayCallback 支付网关的回调
+type GatewayCallback struct {
+	OrderId string `json:"orderId"`
+	// SUCCESS 或者 FAIL
+	Result  string `json:"result"`
+	TradeNo string `json:"tradeNo"`
+}
+
 func main() {
+	flag.Parse()
+	//重启前已经在支付中的支付单
+	var paying []*model.PaymentModel
+	switch *storeType {
+	case "memory":
+		repository = model.NewPaymentRepository(state_machine.NewMemoryStore[model.PaymentStatus]())
+		repository.SetHistory(state_machine.NewMemoryHistoryStore[model.PaymentStatus, model.PaymentEvent]())
+	case "sql":
+		engine := model.InitEngine()
+		repository = model.NewPaymentRepository(model.NewPaymentSqlStore(engine))
+		repository.SetHistory(model.NewPaymentSqlHistory(engine))
+		var err error
+		if paying, err = model.ListPaymentsByStatus(engine, model.PAYING); err != nil {
+			log.Fatalf("%v", err)
+		}
+	default:
+		log.Fatalf("unknown store type %s", *storeType)
+	}
+	dispatcher = state_machine.NewDispatcher(repository, 4, 1000)
+	dispatcher.SetErrorHandler(onEventError)
+	dispatcher.Start()
+	defer dispatcher.Stop()
+	recoverTimeouts(paying)
 	application := iris.New()
 	application.Get("/order/create", createOrder)
 	application.Get("/order/pay", payOrder)
 	application.Get("/order/status", getOrderStatus)
+	application.Get("/order/history", getOrderHistory)
+	application.Get("/order/replay", replayOrder)
+	application.Post("/order/callback", gatewayCallback)
 	application.Listen(":8899", nil)
 }
 
+// errorStatus 根据错误类型返回http状态码
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, state_machine.ErrEntityNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, state_machine.ErrUndefinedTransition), errors.Is(err, state_machine.ErrGuardRejected):
+		return http.StatusBadRequest
+	case errors.Is(err, state_machine.ErrVersionConflict), errors.Is(err, state_machine.ErrEntityExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 func createOrder(context *context.Context) {
-	testOrder.CurrentStatus = model.INIT
-	context.WriteString("create order succ...")
+	id := uuid.New().String()
+	if err := repository.Create(context.Request().Context(), id); err != nil {
+		log.Errorf("%v", err)
+		context.StatusCode(errorStatus(err))
+		context.WriteString(err.Error())
+		return
+	}
+	context.WriteString(id)
 }
 
+// payOrder 推进到支付中后调用支付网关并立即返回，支付结果由网关回调，超时没有回调时支付失败
 func payOrder(context *context.Context) {
-	testOrder.TransferStatusByEvent(model.PAY_PROCESS)
-	log.Infof("call third api....")
-	//调用第三方支付接口和其他业务处理逻辑
-	time.Sleep(time.Second * 15)
-	log.Infof("done...")
-	testOrder.TransferStatusByEvent(model.PAY_SUCCESS)
+	id := context.URLParam("id")
+	//操作人从请求头中获取，记录到转换记录中
+	actor := context.GetHeader("X-Operator")
+	//交易号传给支付网关，回调时校验
+	tradeNo := uuid.New().String()
+	_, err := repository.FireBy(context.Request().Context(), id, model.PAY_PROCESS, nil, actor, map[string]string{"source": "pay", "tradeNo": tradeNo})
+	if errors.Is(err, state_machine.ErrHistoryAppend) {
+		//状态已经推进到支付中，但是交易号没有记录下来，网关回调无法校验，不调用网关，支付单超时后支付失败
+		log.Errorf("%v", err)
+		scheduleTimeout(id, *payTimeout)
+		context.StatusCode(http.StatusInternalServerError)
+		context.WriteString(err.Error())
+		return
+	}
+	if state_machine.Advanced(err) {
+		//状态已经推进到支付中，交易号已经记录，只是action失败，继续设置超时和调用网关
+		log.Warnf("%v", err)
+		err = nil
+	}
+	if err != nil {
+		log.Errorf("%v", err)
+		context.StatusCode(errorStatus(err))
+		context.WriteString(err.Error())
+		return
+	}
+	scheduleTimeout(id, *payTimeout)
+	go callThirdApi(id, tradeNo)
+	context.WriteString("paying...")
+}
+
+// scheduleTimeout delay之后支付单还在支付中时支付失败
+func scheduleTimeout(id string, delay time.Duration) {
+	err := dispatcher.Schedule(&PaymentSubmission{
+		EntityId: id,
+		Event:    model.PAY_FAIL,
+		Actor:    "system",
+		Metadata: map[string]string{"source": "timeout"},
+	}, delay)
+	if err != nil {
+		log.Errorf("%v", err)
+	}
+}
+
+// recoverTimeouts 超时事件只保存在内存中，启动时按进入支付中的时间（updated_at）重新设置，已经超时的立即处理
+func recoverTimeouts(paying []*model.PaymentModel) {
+	for _, p := range paying {
+		delay := time.Until(p.UpdatedAt.Add(*payTimeout))
+		if delay < 0 {
+			delay = 0
+		}
+		log.Infof("order %s is paying, timeout after %v", p.Id, delay)
+		scheduleTimeout(p.Id, delay)
+	}
+}
+
+func callThirdApi(id, tradeNo string) {
+	//调用第三方支付接口，支付结果通过 /order/callback 回调，回调时带上tradeNo
+	log.Infof("order %s trade %s call third api....", id, tradeNo)
+}
+
+// paymentTradeNo 最近一次发起支付时生成的交易号，记录在PAY_PROCESS的转换记录中
+func paymentTradeNo(ctx stdcontext.Context, id string) (string, error) {
+	records, err := repository.History(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Event == model.PAY_PROCESS {
+			return records[i].Metadata["tradeNo"], nil
+		}
+	}
+	return "", nil
+}
+
+// gatewayCallback 支付网关回调，校验支付单和交易号后异步处理事件
+func gatewayCallback(context *context.Context) {
+	callback := new(GatewayCallback)
+	if err := context.ReadJSON(callback); err != nil {
+		context.StatusCode(http.StatusBadRequest)
+		context.JSON(err.Error())
+		return
+	}
+	ctx := context.Request().Context()
+	status, err := repository.State(ctx, callback.OrderId)
+	if err != nil {
+		context.StatusCode(errorStatus(err))
+		context.JSON(err.Error())
+		return
+	}
+	tradeNo, err := paymentTradeNo(ctx, callback.OrderId)
+	if err != nil {
+		context.StatusCode(errorStatus(err))
+		context.JSON(err.Error())
+		return
+	}
+	if callback.TradeNo == "" || callback.TradeNo != tradeNo {
+		context.StatusCode(http.StatusBadRequest)
+		context.JSON("tradeNo does not match order " + callback.OrderId)
+		return
+	}
+	//网关重复回调，支付单已经有了结果
+	if status != model.PAYING {
+		context.WriteString("success")
+		return
+	}
+	var event model.PaymentEvent
+	switch callback.Result {
+	case "SUCCESS":
+		event = model.PAY_SUCCESS
+	case "FAIL":
+		event = model.PAY_FAIL
+	default:
+		context.StatusCode(http.StatusBadRequest)
+		context.JSON("unknown result " + callback.Result)
+		return
+	}
+	err = dispatcher.Submit(&PaymentSubmission{
+		EntityId: callback.OrderId,
+		Event:    event,
+		Actor:    "gateway",
+		Metadata: map[string]string{"source": "callback", "tradeNo": callback.TradeNo},
+	})
+	if err != nil {
+		context.StatusCode(http.StatusServiceUnavailable)
+		context.JSON(err.Error())
+		return
+	}
+	//已经收到支付结果，不再需要超时处理
+	dispatcher.CancelScheduled(callback.OrderId)
+	context.StatusCode(http.StatusAccepted)
+	context.WriteString("success")
+}
+
+func onEventError(s *PaymentSubmission, err error) {
+	//超时事件到期时支付单已经有了结果
+	if s.Metadata["source"] == "timeout" && errors.Is(err, state_machine.ErrUndefinedTransition) {
+		log.Infof("order %s has finished before timeout", s.EntityId)
+		return
+	}
+	log.Errorf("order %s handle %v failed: %v", s.EntityId, s.Event, err)
 }
 
 func getOrderStatus(context *context.Context) {
-	context.WriteString(string(testOrder.CurrentStatus))
+	status, err := repository.State(context.Request().Context(), context.URLParam("id"))
+	if err != nil {
+		context.StatusCode(errorStatus(err))
+		context.WriteString(err.Error())
+		return
+	}
+	context.WriteString(string(status))
+}
+
+func getOrderHistory(context *context.Context) {
+	records, err := repository.History(context.Request().Context(), context.URLParam("id"))
+	if err != nil {
+		context.StatusCode(errorStatus(err))
+		context.JSON(err.Error())
+		return
+	}
+	context.JSON(records)
+}
+
+// replayOrder 通过重放转换记录重建状态，并和保存的状态比较
+func replayOrder(context *context.Context) {
+	ctx := context.Request().Context()
+	id := context.URLParam("id")
+	status, err := repository.State(ctx, id)
+	if err != nil {
+		context.StatusCode(errorStatus(err))
+		context.JSON(err.Error())
+		return
+	}
+	replayed, err := repository.Replay(ctx, id)
+	if err != nil {
+		context.StatusCode(errorStatus(err))
+		context.JSON(err.Error())
+		return
+	}
+	context.JSON(map[string]interface{}{"status": status, "replayed": replayed, "consistent": status == replayed})
 }
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"github.com/ziyifast/log"
+	"myTest/demo_home/state_machine_demo/state_machine"
+)
+
+type OrderStatus string
+
+const (
+	ORDER_CREATED   OrderStatus = "CREATED"
+	ORDER_CANCELLED OrderStatus = "CANCELLED"
+	// 已支付，包含履约和退款两个子流程
+	ORDER_PAID OrderStatus = "PAID"
+	// 履约中，发货和开票两个区域并行
+	ORDER_FULFILLING OrderStatus = "FULFILLING"
+	ORDER_SHIPPING   OrderStatus = "SHIPPING"
+	SHIP_PENDING     OrderStatus = "SHIP_PENDING"
+	SHIPPED          OrderStatus = "SHIPPED"
+	DELIVERED        OrderStatus = "DELIVERED"
+	ORDER_INVOICING  OrderStatus = "INVOICING"
+	INVOICE_PENDING  OrderStatus = "INVOICE_PENDING"
+	INVOICED         OrderStatus = "INVOICED"
+	// 退款中
+	ORDER_REFUNDING   OrderStatus = "REFUNDING"
+	REFUND_PROCESSING OrderStatus = "REFUND_PROCESSING"
+	REFUND_DONE       OrderStatus = "REFUND_DONE"
+	ORDER_REFUNDED    OrderStatus = "REFUNDED"
+	ORDER_COMPLETED   OrderStatus = "COMPLETED"
+)
+
+type OrderEvent string
+
+const (
+	ORDER_PAY      OrderEvent = "PAY"
+	ORDER_CANCEL   OrderEvent = "CANCEL"
+	ORDER_SHIP     OrderEvent = "SHIP"
+	ORDER_DELIVER  OrderEvent = "DELIVER"
+	ORDER_INVOICE  OrderEvent = "INVOICE"
+	ORDER_REFUND   OrderEvent = "REFUND"
+	REFUND_SUCCESS OrderEvent = "REFUND_SUCCESS"
+)
+
+// OrderStateMachine 订单的完整生命周期，履约中同时处于发货和开票两个区域，当前状态为多个叶子状态，通过FireAll推进
+var OrderStateMachine *state_machine.StateMachine[OrderStatus, OrderEvent]
+
+func init() {
+	//CREATED -PAY-> PAID(FULFILLING(SHIPPING || INVOICING))，发货和开票都完成后 -> COMPLETED
+	//履约中的任意状态都可以申请退款 -REFUND-> REFUNDING，退款完成后 -> REFUNDED
+	b := state_machine.NewBuilder[OrderStatus, OrderEvent]("order").
+		Initial(ORDER_CREATED).
+		Final(ORDER_CANCELLED, ORDER_COMPLETED, ORDER_REFUNDED).
+		Composite(ORDER_PAID, ORDER_FULFILLING, ORDER_REFUNDING).
+		Parallel(ORDER_FULFILLING, ORDER_SHIPPING, ORDER_INVOICING).
+		Composite(ORDER_SHIPPING, SHIP_PENDING, SHIPPED, DELIVERED).
+		Composite(ORDER_INVOICING, INVOICE_PENDING, INVOICED).
+		Composite(ORDER_REFUNDING, REFUND_PROCESSING, REFUND_DONE).
+		//区域内的终态，区域完成后由Done转换离开
+		Final(DELIVERED, INVOICED, REFUND_DONE).
+		OnEntry(ORDER_PAID, logOrderEntry).
+		OnEntry(ORDER_REFUNDING, logOrderEntry)
+	b.Transition(ORDER_CREATED, ORDER_PAY, ORDER_PAID)
+	b.Transition(ORDER_CREATED, ORDER_CANCEL, ORDER_CANCELLED)
+	b.Transition(SHIP_PENDING, ORDER_SHIP, SHIPPED)
+	b.Transition(SHIPPED, ORDER_DELIVER, DELIVERED)
+	b.Transition(INVOICE_PENDING, ORDER_INVOICE, INVOICED)
+	//声明在FULFILLING上，所有子状态继承
+	b.Transition(ORDER_FULFILLING, ORDER_REFUND, ORDER_REFUNDING)
+	b.Transition(REFUND_PROCESSING, REFUND_SUCCESS, REFUND_DONE)
+	b.Done(ORDER_FULFILLING, ORDER_COMPLETED)
+	b.Done(ORDER_REFUNDING, ORDER_REFUNDED)
+	OrderStateMachine = b.MustBuild()
+	state_machine.Register(OrderStateMachine)
+}
+
+func logOrderEntry(c *state_machine.TransitionContext[OrderStatus, OrderEvent]) error {
+	log.Infof("order %v -%v-> %v", c.From, c.Event, c.To)
+	return nil
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"myTest/demo_home/state_machine_demo/state_machine"
+	"time"
+	"xorm.io/xorm"
+)
+
+type PaymentRecord = state_machine.Record[PaymentStatus, PaymentEvent]
+
+// PaymentHistory 支付单的状态转换记录，只追加不修改
+type PaymentHistory struct {
+	Id         int64         `xorm:"pk autoincr 'id'"`
+	OrderId    string        `xorm:"varchar(64) notnull unique(order_version) 'order_id'"`
+	FromStatus PaymentStatus `xorm:"varchar(16) 'from_status'"`
+	Event      PaymentEvent  `xorm:"varchar(32) 'event'"`
+	ToStatus   PaymentStatus `xorm:"varchar(16) 'to_status'"`
+	Version    int64         `xorm:"notnull unique(order_version) 'version'"`
+	Actor      string        `xorm:"varchar(64) 'actor'"`
+	Metadata   string        `xorm:"text 'metadata'"`
+	CreatedAt  time.Time     `xorm:"'created_at'"`
+}
+
+func (h *PaymentHistory) TableName() string {
+	return "payment_order_history"
+}
+
+type paymentSqlHistory struct {
+	engine *xorm.Engine
+}
+
+func NewPaymentSqlHistory(engine *xorm.Engine) state_machine.HistoryStore[PaymentStatus, PaymentEvent] {
+	return &paymentSqlHistory{engine: engine}
+}
+
+func (h *paymentSqlHistory) Append(ctx context.Context, record *PaymentRecord) error {
+	session := h.engine.NewSession()
+	defer session.Close()
+	return insertHistory(session, record)
+}
+
+// insertHistory 插入转换记录，保存状态时和状态在同一个事务中插入
+func insertHistory(session *xorm.Session, record *PaymentRecord) error {
+	metadata, err := json.Marshal(record.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = session.InsertOne(&PaymentHistory{
+		OrderId:    record.EntityId,
+		FromStatus: record.From,
+		Event:      record.Event,
+		ToStatus:   record.To,
+		Version:    record.Version,
+		Actor:      record.Actor,
+		Metadata:   string(metadata),
+		CreatedAt:  record.At,
+	})
+	return err
+}
+
+func (h *paymentSqlHistory) List(ctx context.Context, entityId string) ([]*PaymentRecord, error) {
+	histories := make([]*PaymentHistory, 0)
+	if err := h.engine.Where("order_id=?", entityId).Asc("version").Find(&histories); err != nil {
+		return nil, err
+	}
+	records := make([]*PaymentRecord, 0, len(histories))
+	for _, history := range histories {
+		record := &PaymentRecord{
+			EntityId: history.OrderId,
+			From:     history.FromStatus,
+			Event:    history.Event,
+			To:       history.ToStatus,
+			Version:  history.Version,
+			At:       history.CreatedAt,
+			Actor:    history.Actor,
+		}
+		if history.Metadata != "" {
+			if err := json.Unmarshal([]byte(history.Metadata), &record.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
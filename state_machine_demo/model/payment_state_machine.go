@@ -1,5 +1,11 @@
 package model
 
+import (
+	"github.com/ziyifast/log"
+	"myTest/demo_home/state_machine_demo/state_machine"
+	"time"
+)
+
 type PaymentStatus string
 
 const (
@@ -18,36 +24,45 @@ const (
 	PAY_FAIL    PaymentEvent = "PAY_FAIL"
 )
 
-var PaymentStateMachine = StateMachine{statusEventMap: map[StatusEventPair]BaseStatus{}}
+type PaymentTransition = state_machine.TransitionContext[PaymentStatus, PaymentEvent]
+
+var PaymentStateMachine *state_machine.StateMachine[PaymentStatus, PaymentEvent]
 
 func init() {
-	//支付状态机初始化，包含所有可能的情况
-	PaymentStateMachine.accept(nil, PAY_CREATE, INIT)
-	PaymentStateMachine.accept(INIT, PAY_PROCESS, PAYING)
-	PaymentStateMachine.accept(PAYING, PAY_SUCCESS, PAID)
-	PaymentStateMachine.accept(PAYING, PAY_FAIL, FAILED)
+	//支付状态机初始化，包含所有可能的情况：
+	//创建支付订单 PAY_CREATE -> INIT，支付中 INIT -PAY_PROCESS-> PAYING，
+	//支付成功 PAYING -PAY_SUCCESS-> PAID，支付失败 PAYING -PAY_FAIL-> FAILED
+	b := state_machine.NewBuilder[PaymentStatus, PaymentEvent]("payment").
+		Initial(INIT).
+		Final(PAID, FAILED).
+		OnEntry(PAID, logEntry).
+		OnEntry(FAILED, logEntry)
+	b.Transition(INIT, PAY_PROCESS, PAYING)
+	b.Transition(PAYING, PAY_SUCCESS, PAID)
+	b.Transition(PAYING, PAY_FAIL, FAILED)
+	PaymentStateMachine = b.MustBuild()
+	state_machine.Register(PaymentStateMachine)
 }
 
-func GetTargetStatus(sourceStatus PaymentStatus, event PaymentEvent) PaymentStatus {
-	status := PaymentStateMachine.getTargetStatus(sourceStatus, event)
-	if status != nil {
-		return status.(PaymentStatus)
-	}
-	panic("获取目标状态失败")
+func logEntry(c *PaymentTransition) error {
+	log.Infof("payment %v -%v-> %v", c.From, c.Event, c.To)
+	return nil
 }
 
+// PaymentModel 支付单，Version用于保存状态时的CAS
 type PaymentModel struct {
-	lastStatus    PaymentStatus
-	CurrentStatus PaymentStatus
+	Id            string        `xorm:"pk varchar(64) 'id'" json:"id"`
+	CurrentStatus PaymentStatus `xorm:"varchar(16) notnull 'status'" json:"status"`
+	Version       int64         `xorm:"notnull default 0 'version'" json:"version"`
+	CreatedAt     time.Time     `xorm:"'created_at'" json:"createdAt"`
+	UpdatedAt     time.Time     `xorm:"'updated_at'" json:"updatedAt"`
+}
+
+func (p *PaymentModel) TableName() string {
+	return "payment_order"
 }
 
-func (pm *PaymentModel) TransferStatusByEvent(event PaymentEvent) {
-	targetStatus := GetTargetStatus(pm.CurrentStatus, event)
-	if targetStatus != "" {
-		pm.lastStatus = pm.CurrentStatus
-		pm.CurrentStatus = targetStatus
-	} else {
-		// 处理异常
-		panic("状态转换失败")
-	}
+// NewPaymentRepository 基于支付状态机和store创建支付单仓储
+func NewPaymentRepository(store state_machine.Store[PaymentStatus]) *state_machine.Repository[PaymentStatus, PaymentEvent] {
+	return state_machine.NewRepository(PaymentStateMachine, store)
 }
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/lib/pq"
+	"github.com/ziyifast/log"
+	"myTest/demo_home/state_machine_demo/state_machine"
+	"time"
+	"xorm.io/xorm"
+)
+
+// paymentSqlStore 支付单保存在数据库中，通过version字段实现CAS；实现了RecordingStore，状态和转换记录在同一个事务中保存
+type paymentSqlStore struct {
+	engine *xorm.Engine
+}
+
+var _ state_machine.RecordingStore[PaymentStatus, PaymentEvent] = (*paymentSqlStore)(nil)
+
+func NewPaymentSqlStore(engine *xorm.Engine) state_machine.Store[PaymentStatus] {
+	return &paymentSqlStore{engine: engine}
+}
+
+func (s *paymentSqlStore) Create(ctx context.Context, id string, state PaymentStatus) error {
+	exist, err := s.engine.Where("id=?", id).Exist(new(PaymentModel))
+	if err != nil {
+		return err
+	}
+	if exist {
+		return fmt.Errorf("%w: %s", state_machine.ErrEntityExists, id)
+	}
+	now := time.Now()
+	_, err = s.engine.InsertOne(&PaymentModel{
+		Id:            id,
+		CurrentStatus: state,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	return err
+}
+
+func (s *paymentSqlStore) Load(ctx context.Context, id string) (PaymentStatus, int64, error) {
+	p := new(PaymentModel)
+	get, err := s.engine.Where("id=?", id).Get(p)
+	if err != nil {
+		return "", 0, err
+	}
+	if !get {
+		return "", 0, fmt.Errorf("%w: %s", state_machine.ErrEntityNotFound, id)
+	}
+	return p.CurrentStatus, p.Version, nil
+}
+
+func (s *paymentSqlStore) Save(ctx context.Context, id string, state PaymentStatus, expectVersion int64) error {
+	session := s.engine.NewSession()
+	defer session.Close()
+	return saveStatus(session, id, state, expectVersion)
+}
+
+// SaveWithRecord 在一个事务中更新状态和插入转换记录，任意一个失败时都回滚
+func (s *paymentSqlStore) SaveWithRecord(ctx context.Context, id string, state PaymentStatus, expectVersion int64, record *PaymentRecord) error {
+	_, err := s.engine.Transaction(func(session *xorm.Session) (interface{}, error) {
+		if err := saveStatus(session, id, state, expectVersion); err != nil {
+			return nil, err
+		}
+		return nil, insertHistory(session, record)
+	})
+	return err
+}
+
+func saveStatus(session *xorm.Session, id string, state PaymentStatus, expectVersion int64) error {
+	//update ... where id=? and version=?，影响行数为0说明版本号已经变化
+	affected, err := session.Where("id=? and version=?", id, expectVersion).
+		Cols("status", "version", "updated_at").
+		Update(&PaymentModel{CurrentStatus: state, Version: expectVersion + 1, UpdatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s expect version %d", state_machine.ErrVersionConflict, id, expectVersion)
+	}
+	return nil
+}
+
+// ListPaymentsByStatus 查询指定状态的支付单，服务重启后用于恢复支付中的超时处理
+func ListPaymentsByStatus(engine *xorm.Engine, status PaymentStatus) ([]*PaymentModel, error) {
+	payments := make([]*PaymentModel, 0)
+	if err := engine.Where("status=?", status).Find(&payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+const (
+	host     = "localhost"
+	port     = 5432
+	user     = "postgres"
+	password = "postgres"
+	dbName   = "postgres"
+)
+
+func InitEngine() *xorm.Engine {
+	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbName)
+	engine, err := xorm.NewEngine("postgres", psqlInfo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	engine.SetMaxIdleConns(10)
+	engine.SetMaxOpenConns(20)
+	engine.SetConnMaxLifetime(time.Minute * 10)
+	if err = engine.Ping(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err = engine.Sync2(new(PaymentModel), new(PaymentHistory)); err != nil {
+		log.Fatalf("%v", err)
+	}
+	return engine
+}
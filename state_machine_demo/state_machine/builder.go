@@ -0,0 +1,184 @@
+package state_machine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoInitialState   = errors.New("initial state is not set")
+	ErrInvalidHierarchy = errors.New("invalid state hierarchy")
+)
+
+// Builder 声明状态机的状态、转换和action，Build之后状态机不能再修改
+type Builder[S, E comparable] struct {
+	m          *StateMachine[S, E]
+	hasInitial bool
+	known      map[S]bool
+	// 声明层次状态时发现的错误，Build时返回
+	errs []error
+}
+
+// TransitionBuilder 给一个转换设置guard和action
+type TransitionBuilder[S, E comparable] struct {
+	t *transition[S, E]
+}
+
+func NewBuilder[S, E comparable](name string) *Builder[S, E] {
+	return &Builder[S, E]{
+		m: &StateMachine[S, E]{
+			name:         name,
+			finals:       make(map[S]bool),
+			transitions:  make(map[S]map[E][]*transition[S, E]),
+			entry:        make(map[S][]Action[S, E]),
+			exit:         make(map[S][]Action[S, E]),
+			parent:       make(map[S]S),
+			children:     make(map[S][]S),
+			initialChild: make(map[S]S),
+			parallel:     make(map[S]bool),
+			done:         make(map[S][]*transition[S, E]),
+		},
+		known: make(map[S]bool),
+	}
+}
+
+func (b *Builder[S, E]) addState(s S) {
+	if !b.known[s] {
+		b.known[s] = true
+		b.m.states = append(b.m.states, s)
+	}
+}
+
+func (b *Builder[S, E]) Initial(s S) *Builder[S, E] {
+	b.addState(s)
+	b.m.initial = s
+	b.hasInitial = true
+	return b
+}
+
+// Final 声明终态，终态不需要有转换
+func (b *Builder[S, E]) Final(states ...S) *Builder[S, E] {
+	for _, s := range states {
+		b.addState(s)
+		b.m.finals[s] = true
+	}
+	return b
+}
+
+// Transition 声明 from + event -> to
+func (b *Builder[S, E]) Transition(from S, event E, to S) *TransitionBuilder[S, E] {
+	b.addState(from)
+	b.addState(to)
+	t := &transition[S, E]{from: from, event: event, to: to}
+	events, ok := b.m.transitions[from]
+	if !ok {
+		events = make(map[E][]*transition[S, E])
+		b.m.transitions[from] = events
+	}
+	events[event] = append(events[event], t)
+	b.m.ordered = append(b.m.ordered, t)
+	return &TransitionBuilder[S, E]{t: t}
+}
+
+func (b *Builder[S, E]) addChildren(parent S, children []S) {
+	b.addState(parent)
+	if len(b.m.children[parent]) > 0 {
+		b.errs = append(b.errs, fmt.Errorf("%w: %v is declared twice", ErrInvalidHierarchy, parent))
+		return
+	}
+	for _, child := range children {
+		b.addState(child)
+		if p, ok := b.m.parent[child]; ok {
+			b.errs = append(b.errs, fmt.Errorf("%w: %v has two parents %v and %v", ErrInvalidHierarchy, child, p, parent))
+			continue
+		}
+		b.m.parent[child] = parent
+		b.m.children[parent] = append(b.m.children[parent], child)
+	}
+}
+
+// Composite 声明复合状态parent和它的子状态，进入parent时进入初始子状态initial
+func (b *Builder[S, E]) Composite(parent S, initial S, children ...S) *Builder[S, E] {
+	b.addChildren(parent, append([]S{initial}, children...))
+	b.m.initialChild[parent] = initial
+	return b
+}
+
+// Parallel 声明并行状态parent和它的区域，进入parent时同时进入所有区域，区域通常是复合状态
+func (b *Builder[S, E]) Parallel(parent S, regions ...S) *Builder[S, E] {
+	b.addChildren(parent, regions)
+	b.m.parallel[parent] = true
+	return b
+}
+
+// Done 复合状态完成时自动转换到to：复合状态的子状态到达终态，或者并行状态的所有区域都完成
+func (b *Builder[S, E]) Done(from S, to S) *TransitionBuilder[S, E] {
+	b.addState(from)
+	b.addState(to)
+	t := &transition[S, E]{from: from, to: to, done: true}
+	b.m.done[from] = append(b.m.done[from], t)
+	b.m.ordered = append(b.m.ordered, t)
+	return &TransitionBuilder[S, E]{t: t}
+}
+
+// OnEntry 进入状态时执行
+func (b *Builder[S, E]) OnEntry(s S, action Action[S, E]) *Builder[S, E] {
+	b.addState(s)
+	b.m.entry[s] = append(b.m.entry[s], action)
+	return b
+}
+
+// OnExit 离开状态时执行
+func (b *Builder[S, E]) OnExit(s S, action Action[S, E]) *Builder[S, E] {
+	b.addState(s)
+	b.m.exit[s] = append(b.m.exit[s], action)
+	return b
+}
+
+func (b *Builder[S, E]) Build() (*StateMachine[S, E], error) {
+	if !b.hasInitial {
+		return nil, fmt.Errorf("%w: %s", ErrNoInitialState, b.m.name)
+	}
+	if len(b.errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", b.m.name, b.errs[0])
+	}
+	//父状态的层数超过状态个数说明有环
+	for _, s := range b.m.states {
+		p, ok := b.m.parent[s]
+		for i := 0; ok; i++ {
+			if i > len(b.m.states) {
+				return nil, fmt.Errorf("%w: %s %v is its own ancestor", ErrInvalidHierarchy, b.m.name, s)
+			}
+			p, ok = b.m.parent[p]
+		}
+	}
+	//并行状态的不同区域之间不能直接转换
+	for _, t := range b.m.ordered {
+		if b.m.isAncestor(t.from, t.to) || b.m.isAncestor(t.to, t.from) {
+			continue
+		}
+		if a, ok := b.m.commonAncestor(t.from, t.to); ok && b.m.parallel[a] {
+			return nil, fmt.Errorf("%w: %s %v -> %v crosses regions of %v", ErrInvalidHierarchy, b.m.name, t.from, t.to, a)
+		}
+	}
+	return b.m, nil
+}
+
+// MustBuild Build失败时panic，用于包初始化
+func (b *Builder[S, E]) MustBuild() *StateMachine[S, E] {
+	m, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (tb *TransitionBuilder[S, E]) Guard(guard Guard[S, E]) *TransitionBuilder[S, E] {
+	tb.t.guard = guard
+	return tb
+}
+
+func (tb *TransitionBuilder[S, E]) Action(action Action[S, E]) *TransitionBuilder[S, E] {
+	tb.t.actions = append(tb.t.actions, action)
+	return tb
+}
@@ -0,0 +1,404 @@
+package state_machine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+状态机的可视化和静态检查：
+1. Definition是状态机声明的快照，状态和事件统一转成字符串，和S、E的具体类型无关
+2. 导出为Graphviz DOT和Mermaid格式，guard的转换在事件后加[guard]，复合状态的完成转换的事件为done，复合状态导出为嵌套的子图
+3. Validate检查：从初始状态不可达的状态、没有出边（包括继承的转换）的非终态叶子状态、同一个源状态和事件有多个转换时被前面没有guard的转换遮住的转换；
+   同一个源状态和事件有多个guard的转换时作为警告报告，guard需要互斥，否则结果取决于声明顺序
+4. 状态机通过Register注册后，可以通过命令统一导出和检查
+*/
+
+type TransitionDefinition struct {
+	From    string
+	Event   string
+	To      string
+	Guarded bool
+	// 复合状态的完成转换
+	Done bool
+}
+
+type Definition struct {
+	Name        string
+	Initial     string
+	States      []string
+	Finals      []string
+	Transitions []TransitionDefinition
+	// 子状态 -> 父状态
+	Parents map[string]string
+	// 复合状态 -> 初始子状态
+	InitialChildren map[string]string
+	Parallel        []string
+}
+
+// Describer 能够导出Definition的状态机
+type Describer interface {
+	Definition() *Definition
+}
+
+func (m *StateMachine[S, E]) Definition() *Definition {
+	def := &Definition{
+		Name:            m.name,
+		Initial:         fmt.Sprint(m.initial),
+		Parents:         make(map[string]string),
+		InitialChildren: make(map[string]string),
+	}
+	for _, s := range m.states {
+		def.States = append(def.States, fmt.Sprint(s))
+		if m.finals[s] {
+			def.Finals = append(def.Finals, fmt.Sprint(s))
+		}
+		if p, ok := m.parent[s]; ok {
+			def.Parents[fmt.Sprint(s)] = fmt.Sprint(p)
+		}
+		if c, ok := m.initialChild[s]; ok {
+			def.InitialChildren[fmt.Sprint(s)] = fmt.Sprint(c)
+		}
+		if m.parallel[s] {
+			def.Parallel = append(def.Parallel, fmt.Sprint(s))
+		}
+	}
+	for _, t := range m.ordered {
+		td := TransitionDefinition{
+			From:    fmt.Sprint(t.from),
+			Event:   fmt.Sprint(t.event),
+			To:      fmt.Sprint(t.to),
+			Guarded: t.guard != nil,
+			Done:    t.done,
+		}
+		if t.done {
+			td.Event = "done"
+		}
+		def.Transitions = append(def.Transitions, td)
+	}
+	return def
+}
+
+func (d *Definition) isParallel(s string) bool {
+	for _, p := range d.Parallel {
+		if p == s {
+			return true
+		}
+	}
+	return false
+}
+
+// children 按声明顺序返回子状态
+func (d *Definition) children(parent string) []string {
+	children := make([]string, 0)
+	for _, s := range d.States {
+		if p, ok := d.Parents[s]; ok && p == parent {
+			children = append(children, s)
+		}
+	}
+	return children
+}
+
+func (d *Definition) isComposite(s string) bool {
+	return len(d.children(s)) > 0
+}
+
+// isAncestor a是否为s的祖先状态，不包括s自己
+func (d *Definition) isAncestor(a, s string) bool {
+	for p, ok := d.Parents[s]; ok; p, ok = d.Parents[p] {
+		if p == a {
+			return true
+		}
+	}
+	return false
+}
+
+// container 转换所在的复合状态：同时包含源状态和目标状态的最内层的非并行复合状态，没有时返回空
+func (d *Definition) container(t TransitionDefinition) string {
+	for p, ok := d.Parents[t.From]; ok; p, ok = d.Parents[p] {
+		if (p == t.To || d.isAncestor(p, t.To)) && !d.isParallel(p) {
+			return p
+		}
+	}
+	return ""
+}
+
+func (d *Definition) isFinal(s string) bool {
+	for _, f := range d.Finals {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (t TransitionDefinition) label() string {
+	if t.Guarded {
+		return t.Event + " [guard]"
+	}
+	return t.Event
+}
+
+// DOT 导出为Graphviz DOT格式，复合状态导出为cluster，cluster中和复合状态同名的点用于连接进出复合状态的转换
+func (d *Definition) DOT() string {
+	sb := new(strings.Builder)
+	fmt.Fprintf(sb, "digraph %q {\n", d.Name)
+	sb.WriteString("  compound=true;\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  \"__start\" [shape=point];\n")
+	for _, s := range d.States {
+		if _, ok := d.Parents[s]; !ok {
+			d.writeDOTState(sb, s, "  ")
+		}
+	}
+	fmt.Fprintf(sb, "  \"__start\" -> %q;\n", d.Initial)
+	for _, t := range d.Transitions {
+		attrs := fmt.Sprintf("label=%q", t.label())
+		if d.isComposite(t.From) {
+			attrs += fmt.Sprintf(", ltail=%q", "cluster_"+t.From)
+		}
+		if d.isComposite(t.To) {
+			attrs += fmt.Sprintf(", lhead=%q", "cluster_"+t.To)
+		}
+		fmt.Fprintf(sb, "  %q -> %q [%s];\n", t.From, t.To, attrs)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (d *Definition) writeDOTState(sb *strings.Builder, s, indent string) {
+	children := d.children(s)
+	if len(children) == 0 {
+		shape := "circle"
+		if d.isFinal(s) {
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(sb, "%s%q [shape=%s];\n", indent, s, shape)
+		return
+	}
+	fmt.Fprintf(sb, "%ssubgraph %q {\n", indent, "cluster_"+s)
+	label := s
+	if d.isParallel(s) {
+		label += " (parallel)"
+	}
+	fmt.Fprintf(sb, "%s  label=%q;\n", indent, label)
+	fmt.Fprintf(sb, "%s  %q [shape=point];\n", indent, s)
+	for _, child := range children {
+		d.writeDOTState(sb, child, indent+"  ")
+	}
+	//进入复合状态时默认进入的子状态
+	targets := children
+	if !d.isParallel(s) {
+		targets = []string{d.InitialChildren[s]}
+	}
+	for _, child := range targets {
+		attrs := "style=dashed"
+		if d.isComposite(child) {
+			attrs += fmt.Sprintf(", lhead=%q", "cluster_"+child)
+		}
+		fmt.Fprintf(sb, "%s  %q -> %q [%s];\n", indent, s, child, attrs)
+	}
+	fmt.Fprintf(sb, "%s}\n", indent)
+}
+
+// Mermaid 导出为Mermaid状态图，并行状态的区域之间用--分隔
+func (d *Definition) Mermaid() string {
+	sb := new(strings.Builder)
+	sb.WriteString("stateDiagram-v2\n")
+	d.writeMermaidBody(sb, "", "    ")
+	return sb.String()
+}
+
+// writeMermaidBody 输出复合状态parent内部的内容，parent为空时为顶层
+func (d *Definition) writeMermaidBody(sb *strings.Builder, parent, indent string) {
+	if parent == "" {
+		fmt.Fprintf(sb, "%s[*] --> %s\n", indent, d.Initial)
+	} else if initial, ok := d.InitialChildren[parent]; ok {
+		fmt.Fprintf(sb, "%s[*] --> %s\n", indent, initial)
+	}
+	children := d.children(parent)
+	if parent == "" {
+		children = make([]string, 0)
+		for _, s := range d.States {
+			if _, ok := d.Parents[s]; !ok {
+				children = append(children, s)
+			}
+		}
+	}
+	for i, child := range children {
+		if !d.isComposite(child) {
+			continue
+		}
+		if i > 0 && d.isParallel(parent) {
+			fmt.Fprintf(sb, "%s--\n", indent)
+		}
+		fmt.Fprintf(sb, "%sstate %s {\n", indent, child)
+		d.writeMermaidBody(sb, child, indent+"    ")
+		fmt.Fprintf(sb, "%s}\n", indent)
+	}
+	for _, t := range d.Transitions {
+		if d.container(t) == parent {
+			fmt.Fprintf(sb, "%s%s --> %s: %s\n", indent, t.From, t.To, t.label())
+		}
+	}
+	for _, s := range children {
+		if d.isFinal(s) {
+			fmt.Fprintf(sb, "%s%s --> [*]\n", indent, s)
+		}
+	}
+}
+
+// Problem 静态检查发现的问题
+type Problem struct {
+	Machine string
+	Kind    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Machine, p.Kind, p.Message)
+}
+
+const (
+	ProblemUnreachable      = "unreachable"
+	ProblemDeadEnd          = "dead-end"
+	ProblemNondeterministic = "nondeterministic"
+	// 警告：同一个源状态和事件有多个guard的转换
+	ProblemAmbiguous = "ambiguous"
+)
+
+// Warning 是否只是警告，guard互斥时多个guard的转换是正常的用法
+func (p Problem) Warning() bool {
+	return p.Kind == ProblemAmbiguous
+}
+
+// Validate 检查状态机的声明，没有问题时返回空
+func (d *Definition) Validate() []Problem {
+	problems := make([]Problem, 0)
+	outgoing := make(map[string][]TransitionDefinition)
+	for _, t := range d.Transitions {
+		outgoing[t.From] = append(outgoing[t.From], t)
+	}
+	//进入一个状态时同时进入它的祖先状态、默认的子状态和路径上并行状态的其他区域，重复直到没有新的可达状态
+	reachable := make(map[string]bool)
+	changed := false
+	var enterDefault func(s string)
+	enterDefault = func(s string) {
+		if !reachable[s] {
+			reachable[s] = true
+			changed = true
+		}
+		if d.isParallel(s) {
+			for _, region := range d.children(s) {
+				enterDefault(region)
+			}
+		} else if initial, ok := d.InitialChildren[s]; ok {
+			enterDefault(initial)
+		}
+	}
+	reach := func(s string) {
+		enterDefault(s)
+		for p, ok := d.Parents[s]; ok; p, ok = d.Parents[p] {
+			if !reachable[p] {
+				reachable[p] = true
+				changed = true
+			}
+			if d.isParallel(p) {
+				for _, region := range d.children(p) {
+					if region != s && !d.isAncestor(region, s) {
+						enterDefault(region)
+					}
+				}
+			}
+		}
+	}
+	reach(d.Initial)
+	for changed {
+		changed = false
+		for _, t := range d.Transitions {
+			if reachable[t.From] {
+				reach(t.To)
+			}
+		}
+	}
+	for _, s := range d.States {
+		if !reachable[s] {
+			problems = append(problems, Problem{d.Name, ProblemUnreachable, fmt.Sprintf("state %s is unreachable from %s", s, d.Initial)})
+		}
+		if d.isComposite(s) || d.isFinal(s) {
+			continue
+		}
+		//叶子状态可以通过自己和祖先状态的事件离开，完成转换只在子状态到达终态时执行
+		leaving := false
+		for p, ok := s, true; ok && !leaving; p, ok = d.Parents[p] {
+			for _, t := range outgoing[p] {
+				if !t.Done {
+					leaving = true
+					break
+				}
+			}
+		}
+		if !leaving {
+			problems = append(problems, Problem{d.Name, ProblemDeadEnd, fmt.Sprintf("state %s is not final but has no transitions", s)})
+		}
+	}
+	//按声明顺序选择第一个guard通过的转换，没有guard的转换后面的转换永远不会被选择；
+	//没有被遮住的guard的转换有多个时，多个guard同时通过的结果取决于声明顺序
+	for _, s := range d.States {
+		seen := make(map[string]string)
+		guarded := make(map[string][]string)
+		events := make([]string, 0)
+		for _, t := range outgoing[s] {
+			if to, ok := seen[t.Event]; ok {
+				problems = append(problems, Problem{d.Name, ProblemNondeterministic,
+					fmt.Sprintf("%s -%s-> %s is shadowed by unguarded %s -%s-> %s", s, t.Event, t.To, s, t.Event, to)})
+				continue
+			}
+			if !t.Guarded {
+				seen[t.Event] = t.To
+				continue
+			}
+			if _, ok := guarded[t.Event]; !ok {
+				events = append(events, t.Event)
+			}
+			guarded[t.Event] = append(guarded[t.Event], t.To)
+		}
+		for _, event := range events {
+			if targets := guarded[event]; len(targets) > 1 {
+				problems = append(problems, Problem{d.Name, ProblemAmbiguous,
+					fmt.Sprintf("%s -%s-> has %d guarded transitions (to %s), the guards must be mutually exclusive", s, event, len(targets), strings.Join(targets, ", "))})
+			}
+		}
+	}
+	return problems
+}
+
+var registry = struct {
+	sync.Mutex
+	machines map[string]Describer
+}{machines: make(map[string]Describer)}
+
+// Register 注册状态机，用于统一导出和检查
+func Register(m Describer) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.machines[m.Definition().Name] = m
+}
+
+// Registered 按名称排序返回所有注册的状态机
+func Registered() []*Definition {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.machines))
+	for name := range registry.machines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	defs := make([]*Definition, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, registry.machines[name].Definition())
+	}
+	return defs
+}
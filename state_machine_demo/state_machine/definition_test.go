@@ -0,0 +1,53 @@
+package state_machine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red").Final("off")
+	b.Transition("red", "next", "green")
+	b.Transition("green", "next", "yellow")
+	b.Transition("green", "next", "red")
+	b.Transition("broken", "next", "off")
+	//两个guard的转换都没有被遮住，guard同时通过时取决于声明顺序
+	pass := func(c *TransitionContext[light, signal]) bool { return true }
+	b.Transition("broken", "reset", "off").Guard(pass)
+	b.Transition("broken", "reset", "red").Guard(pass)
+	b.Transition("broken", "reset", "green")
+	problems := b.MustBuild().Definition().Validate()
+
+	got := make([]string, 0)
+	for _, p := range problems {
+		got = append(got, p.Kind+" "+p.Message)
+	}
+	want := []string{
+		"unreachable state off is unreachable from red",
+		"dead-end state yellow is not final but has no transitions",
+		"unreachable state broken is unreachable from red",
+		"nondeterministic green -next-> red is shadowed by unguarded green -next-> yellow",
+		"ambiguous broken -reset-> has 2 guarded transitions (to off, red), the guards must be mutually exclusive",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s", strings.Join(got, "\n"))
+	}
+	for _, p := range problems {
+		if p.Warning() != (p.Kind == ProblemAmbiguous) {
+			t.Fatalf("%v warning = %v", p, p.Warning())
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red").Final("off")
+	b.Transition("red", "next", "off").Guard(func(c *TransitionContext[light, signal]) bool { return true })
+	def := b.MustBuild().Definition()
+	if !strings.Contains(def.DOT(), `"red" -> "off" [label="next [guard]"];`) {
+		t.Fatal(def.DOT())
+	}
+	want := "stateDiagram-v2\n    [*] --> red\n    red --> off: next [guard]\n    off --> [*]\n"
+	if def.Mermaid() != want {
+		t.Fatal(def.Mermaid())
+	}
+}
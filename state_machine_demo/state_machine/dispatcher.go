@@ -0,0 +1,189 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+/*
+异步处理事件：
+1. Submit把事件放入队列后立即返回，由worker调用Repository推进状态，不阻塞调用方（例如http请求）
+2. 按实体id的hash分配worker，同一个实体的事件按提交顺序依次处理
+3. Schedule延迟提交事件，用于超时处理，例如支付中超过N分钟没有回调时提交支付失败事件；
+   到期时实体已经不能接受该事件（例如已经支付成功）说明不需要超时处理，交给错误处理函数；
+   到期时队列已满会等待队列有空位，不会像Submit一样返回ErrQueueFull而丢掉超时事件
+4. 定时器保存在内存中，服务重启后丢失，需要持久化时使用延迟队列
+*/
+
+var (
+	ErrDispatcherStopped = errors.New("dispatcher is stopped")
+	ErrQueueFull         = errors.New("event queue is full")
+)
+
+// Submission 提交给Dispatcher的事件
+type Submission[E comparable] struct {
+	EntityId string
+	Event    E
+	Payload  interface{}
+	Actor    string
+	Metadata map[string]string
+}
+
+// ErrorHandler 异步处理事件失败时调用
+type ErrorHandler[E comparable] func(s *Submission[E], err error)
+
+type Dispatcher[S, E comparable] struct {
+	repo    *Repository[S, E]
+	queues  []chan *Submission[E]
+	onError ErrorHandler[E]
+
+	mu      sync.Mutex
+	stopped bool
+	// Stop时关闭，正在等待队列空位的延迟事件不再等待
+	done chan struct{}
+	// 每个实体还没有到期的延迟事件
+	timers map[string]map[*time.Timer]bool
+	// 正在等待队列空位的延迟事件，Stop等待它们返回后才能关闭队列
+	sending sync.WaitGroup
+	wg      sync.WaitGroup
+}
+
+// NewDispatcher workers为worker个数，queueSize为每个worker的队列长度
+func NewDispatcher[S, E comparable](repo *Repository[S, E], workers, queueSize int) *Dispatcher[S, E] {
+	d := &Dispatcher[S, E]{
+		repo:    repo,
+		queues:  make([]chan *Submission[E], workers),
+		onError: func(s *Submission[E], err error) {},
+		done:    make(chan struct{}),
+		timers:  make(map[string]map[*time.Timer]bool),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan *Submission[E], queueSize)
+	}
+	return d
+}
+
+func (d *Dispatcher[S, E]) SetErrorHandler(onError ErrorHandler[E]) {
+	d.onError = onError
+}
+
+// Start 启动worker
+func (d *Dispatcher[S, E]) Start() {
+	for _, queue := range d.queues {
+		d.wg.Add(1)
+		go d.run(queue)
+	}
+}
+
+// Stop 取消所有延迟事件，等待队列中的事件处理完后返回；已经到期但还在等待队列空位的延迟事件交给错误处理函数
+func (d *Dispatcher[S, E]) Stop() {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	for id := range d.timers {
+		d.cancel(id)
+	}
+	close(d.done)
+	d.mu.Unlock()
+	d.sending.Wait()
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func (d *Dispatcher[S, E]) run(queue chan *Submission[E]) {
+	defer d.wg.Done()
+	for s := range queue {
+		_, err := d.repo.FireBy(context.Background(), s.EntityId, s.Event, s.Payload, s.Actor, s.Metadata)
+		if err != nil {
+			d.onError(s, err)
+		}
+	}
+}
+
+func (d *Dispatcher[S, E]) queue(id string) chan *Submission[E] {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return d.queues[h.Sum32()%uint32(len(d.queues))]
+}
+
+// Submit 提交事件，队列满时返回ErrQueueFull
+func (d *Dispatcher[S, E]) Submit(s *Submission[E]) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return ErrDispatcherStopped
+	}
+	select {
+	case d.queue(s.EntityId) <- s:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Schedule delay之后提交事件，到期时队列已满会一直等待到队列有空位或者Stop；
+// 提交失败（Dispatcher已经停止）时交给错误处理函数
+func (d *Dispatcher[S, E]) Schedule(s *Submission[E], delay time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return ErrDispatcherStopped
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		delete(d.timers[s.EntityId], timer)
+		if len(d.timers[s.EntityId]) == 0 {
+			delete(d.timers, s.EntityId)
+		}
+		d.mu.Unlock()
+		if err := d.submitWait(s); err != nil {
+			d.onError(s, err)
+		}
+	})
+	if d.timers[s.EntityId] == nil {
+		d.timers[s.EntityId] = make(map[*time.Timer]bool)
+	}
+	d.timers[s.EntityId][timer] = true
+	return nil
+}
+
+// submitWait 提交到期的延迟事件，队列满时等待
+func (d *Dispatcher[S, E]) submitWait(s *Submission[E]) error {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return ErrDispatcherStopped
+	}
+	d.sending.Add(1)
+	d.mu.Unlock()
+	defer d.sending.Done()
+	select {
+	case d.queue(s.EntityId) <- s:
+		return nil
+	case <-d.done:
+		return ErrDispatcherStopped
+	}
+}
+
+// CancelScheduled 取消实体还没有到期的延迟事件
+func (d *Dispatcher[S, E]) CancelScheduled(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancel(id)
+}
+
+func (d *Dispatcher[S, E]) cancel(id string) {
+	for timer := range d.timers[id] {
+		timer.Stop()
+	}
+	delete(d.timers, id)
+}
@@ -0,0 +1,130 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red").Final("off")
+	b.Transition("red", "next", "green")
+	b.Transition("green", "next", "yellow")
+	b.Transition("red", "timeout", "off")
+	b.Transition("green", "timeout", "off")
+	repo := NewRepository(b.MustBuild(), NewMemoryStore[light]())
+	ctx := context.Background()
+	repo.Create(ctx, "1")
+	repo.Create(ctx, "2")
+
+	failed := make(chan error, 10)
+	d := NewDispatcher(repo, 2, 10)
+	d.SetErrorHandler(func(s *Submission[signal], err error) {
+		failed <- err
+	})
+	d.Start()
+
+	//同一个实体的事件按提交顺序处理
+	d.Submit(&Submission[signal]{EntityId: "1", Event: "next"})
+	d.Submit(&Submission[signal]{EntityId: "1", Event: "next"})
+	//实体2的超时事件被取消；实体1的超时事件更晚到期，到期时已经不能接受超时事件
+	d.Schedule(&Submission[signal]{EntityId: "2", Event: "timeout"}, time.Millisecond*10)
+	d.CancelScheduled("2")
+	d.Schedule(&Submission[signal]{EntityId: "1", Event: "timeout"}, time.Millisecond*20)
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrUndefinedTransition) {
+			t.Fatalf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scheduled event is not handled")
+	}
+	d.Stop()
+
+	if s, _ := repo.State(ctx, "1"); s != "yellow" {
+		t.Fatalf("got %v", s)
+	}
+	if s, _ := repo.State(ctx, "2"); s != "red" {
+		t.Fatalf("got %v", s)
+	}
+	if len(failed) != 0 {
+		t.Fatalf("got %v", <-failed)
+	}
+	if err := d.Submit(&Submission[signal]{EntityId: "1", Event: "next"}); !errors.Is(err, ErrDispatcherStopped) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestScheduleWaitsForQueue(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red").Final("off")
+	b.Transition("red", "next", "green")
+	b.Transition("green", "timeout", "off")
+	repo := NewRepository(b.MustBuild(), NewMemoryStore[light]())
+	ctx := context.Background()
+	repo.Create(ctx, "1")
+
+	failed := make(chan error, 10)
+	d := NewDispatcher(repo, 1, 1)
+	d.SetErrorHandler(func(s *Submission[signal], err error) {
+		failed <- err
+	})
+	//worker还没有启动，队列已满
+	if err := d.Submit(&Submission[signal]{EntityId: "1", Event: "next"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Submit(&Submission[signal]{EntityId: "1", Event: "next"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got %v", err)
+	}
+	//到期时队列已满，等待队列有空位后提交，不会丢掉超时事件
+	d.Schedule(&Submission[signal]{EntityId: "1", Event: "timeout"}, time.Millisecond)
+	waitFired(t, d)
+	d.Start()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if s, _ := repo.State(ctx, "1"); s == "off" {
+			break
+		}
+		select {
+		case err := <-failed:
+			t.Fatalf("got %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scheduled event is lost")
+		}
+	}
+	d.Stop()
+
+	//Stop时还在等待队列空位的延迟事件交给错误处理函数
+	d = NewDispatcher(repo, 1, 1)
+	d.SetErrorHandler(func(s *Submission[signal], err error) {
+		failed <- err
+	})
+	d.Submit(&Submission[signal]{EntityId: "1", Event: "next"})
+	d.Schedule(&Submission[signal]{EntityId: "1", Event: "timeout"}, time.Millisecond)
+	waitFired(t, d)
+	d.Stop()
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrDispatcherStopped) {
+			t.Fatalf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scheduled event is dropped silently")
+	}
+}
+
+// waitFired 等待所有延迟事件到期
+func waitFired[S, E comparable](t *testing.T, d *Dispatcher[S, E]) {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		d.mu.Lock()
+		pending := len(d.timers)
+		d.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scheduled event did not fire")
+		}
+	}
+}
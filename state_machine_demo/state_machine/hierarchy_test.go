@@ -0,0 +1,153 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func buildOrder(trace *[]string) *StateMachine[string, string] {
+	record := func(name string) Action[string, string] {
+		return func(c *TransitionContext[string, string]) error {
+			*trace = append(*trace, name)
+			return nil
+		}
+	}
+	b := NewBuilder[string, string]("order").
+		Initial("created").
+		Final("completed", "refunded", "delivered", "invoiced").
+		Composite("paid", "fulfilling", "refunding").
+		Parallel("fulfilling", "shipping", "invoicing").
+		Composite("shipping", "ship_pending", "shipped", "delivered").
+		Composite("invoicing", "invoice_pending", "invoiced").
+		OnEntry("paid", record("entry paid")).
+		OnEntry("shipping", record("entry shipping")).
+		OnEntry("invoicing", record("entry invoicing")).
+		OnExit("fulfilling", record("exit fulfilling")).
+		OnExit("ship_pending", record("exit ship_pending"))
+	b.Transition("created", "pay", "paid")
+	b.Transition("ship_pending", "ship", "shipped")
+	b.Transition("shipped", "deliver", "delivered")
+	b.Transition("invoice_pending", "invoice", "invoiced")
+	b.Transition("fulfilling", "refund", "refunding")
+	b.Transition("refunding", "refund_success", "refunded")
+	b.Done("fulfilling", "completed")
+	return b.MustBuild()
+}
+
+func TestParallel(t *testing.T) {
+	var trace []string
+	m := buildOrder(&trace)
+
+	//进入复合状态时进入初始子状态，进入并行状态时进入所有区域
+	active, err := m.FireAll([]string{m.Initial()}, "pay", nil)
+	if err != nil || !reflect.DeepEqual(active, []string{"ship_pending", "invoice_pending"}) {
+		t.Fatalf("got %v %v", active, err)
+	}
+	if got := strings.Join(trace, ","); got != "entry paid,entry shipping,entry invoicing" {
+		t.Fatalf("got %s", got)
+	}
+	if _, err = m.Fire("created", "pay", nil); !errors.Is(err, ErrParallelState) {
+		t.Fatalf("got %v", err)
+	}
+
+	//一个区域推进时另一个区域不变
+	active, _ = m.FireAll(active, "ship", nil)
+	active, _ = m.FireAll(active, "deliver", nil)
+	if !reflect.DeepEqual(active, []string{"invoice_pending", "delivered"}) {
+		t.Fatalf("got %v", active)
+	}
+	if _, err = m.FireAll(active, "ship", nil); !errors.Is(err, ErrUndefinedTransition) {
+		t.Fatalf("got %v", err)
+	}
+	//所有区域都完成后执行Done转换
+	active, _ = m.FireAll(active, "invoice", nil)
+	if !reflect.DeepEqual(active, []string{"completed"}) {
+		t.Fatalf("got %v", active)
+	}
+}
+
+func TestInheritedTransition(t *testing.T) {
+	var trace []string
+	m := buildOrder(&trace)
+	active, _ := m.FireAll([]string{"paid"}, "ship", nil)
+	trace = nil
+	//子状态继承并行状态声明的转换，退出所有区域
+	active, err := m.FireAll(active, "refund", nil)
+	if err != nil || !reflect.DeepEqual(active, []string{"refunding"}) {
+		t.Fatalf("got %v %v", active, err)
+	}
+	if got := strings.Join(trace, ","); got != "exit fulfilling" {
+		t.Fatalf("got %s", got)
+	}
+	if s, err := m.Fire("refunding", "refund_success", nil); err != nil || s != "refunded" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if !m.Defined("ship_pending", "refund", "refunding") || !m.Defined("created", "pay", "ship_pending") {
+		t.Fatal("inherited transitions should be defined")
+	}
+}
+
+func TestInvalidHierarchy(t *testing.T) {
+	b := NewBuilder[string, string]("order").
+		Initial("a").
+		Parallel("a", "b", "c")
+	b.Transition("b", "next", "c")
+	if _, err := b.Build(); !errors.Is(err, ErrInvalidHierarchy) {
+		t.Fatalf("got %v", err)
+	}
+	b = NewBuilder[string, string]("order").
+		Initial("a").
+		Composite("a", "b").
+		Composite("c", "b")
+	if _, err := b.Build(); !errors.Is(err, ErrInvalidHierarchy) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestValidateHierarchy(t *testing.T) {
+	var trace []string
+	def := buildOrder(&trace).Definition()
+	if problems := def.Validate(); len(problems) != 0 {
+		t.Fatalf("got %v", problems)
+	}
+	if !strings.Contains(def.DOT(), `subgraph "cluster_fulfilling"`) {
+		t.Fatal(def.DOT())
+	}
+	if !strings.Contains(def.Mermaid(), "fulfilling --> completed: done") {
+		t.Fatal(def.Mermaid())
+	}
+}
+
+func TestReplayCompletion(t *testing.T) {
+	b := NewBuilder[string, string]("composite").
+		Initial("start").
+		Final("c2", "z").
+		Composite("c", "c1", "c2")
+	b.Transition("start", "enter", "c")
+	b.Transition("c1", "fin", "c2")
+	b.Done("c", "z")
+	repo := NewRepository(b.MustBuild(), NewMemoryStore[string]())
+	repo.SetHistory(NewMemoryHistoryStore[string, string]())
+	ctx := context.Background()
+	repo.Create(ctx, "1")
+
+	//c2为终态，c完成后自动转换到z，记录为 c1 -fin-> z
+	for _, event := range []string{"enter", "fin"} {
+		if _, err := repo.Fire(ctx, "1", event, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, _ := repo.History(ctx, "1")
+	if r := records[1]; r.From != "c1" || r.To != "z" {
+		t.Fatalf("got %+v", r)
+	}
+	if s, err := repo.Replay(ctx, "1"); err != nil || s != "z" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if repo.Machine().Defined("c1", "fin", "start") {
+		t.Fatal("c1 -fin-> start is not defined")
+	}
+}
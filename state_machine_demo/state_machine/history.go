@@ -0,0 +1,79 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+状态转换的审计日志：
+1. Repository每次保存状态时追加一条转换记录（Store实现了RecordingStore时在同一个事务中）：实体id、源状态、事件、目标状态、保存后的版本号、时间、操作人和附加信息
+2. 转换记录只追加不修改，同一个实体的记录按版本号递增
+3. Replay从初始状态开始按顺序重放转换记录，重建实体的当前状态，记录和状态机的声明不一致时返回错误
+*/
+
+var ErrInvalidHistory = errors.New("invalid transition history")
+
+// Record 一次状态转换的记录
+type Record[S, E comparable] struct {
+	EntityId string `json:"entityId"`
+	From     S      `json:"from"`
+	Event    E      `json:"event"`
+	To       S      `json:"to"`
+	// 转换后实体的版本号
+	Version  int64             `json:"version"`
+	At       time.Time         `json:"at"`
+	Actor    string            `json:"actor"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type HistoryStore[S, E comparable] interface {
+	// Append 追加一条转换记录
+	Append(ctx context.Context, record *Record[S, E]) error
+	// List 按版本号升序返回实体的所有转换记录
+	List(ctx context.Context, entityId string) ([]*Record[S, E], error)
+}
+
+// Replay 从初始状态开始重放转换记录，返回重放后的状态
+func Replay[S, E comparable](m *StateMachine[S, E], records []*Record[S, E]) (S, error) {
+	state := m.Initial()
+	for i, r := range records {
+		if r.From != state || !m.Defined(r.From, r.Event, r.To) {
+			return state, fmt.Errorf("%w: record %d %v -%v-> %v, current state %v", ErrInvalidHistory, i, r.From, r.Event, r.To, state)
+		}
+		state = r.To
+	}
+	return state, nil
+}
+
+// MemoryHistoryStore 基于map的HistoryStore，用于测试和单机演示
+type MemoryHistoryStore[S, E comparable] struct {
+	mu      sync.Mutex
+	records map[string][]*Record[S, E]
+}
+
+func NewMemoryHistoryStore[S, E comparable]() *MemoryHistoryStore[S, E] {
+	return &MemoryHistoryStore[S, E]{records: make(map[string][]*Record[S, E])}
+}
+
+func (h *MemoryHistoryStore[S, E]) Append(ctx context.Context, record *Record[S, E]) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[record.EntityId] = append(h.records[record.EntityId], record)
+	return nil
+}
+
+func (h *MemoryHistoryStore[S, E]) List(ctx context.Context, entityId string) ([]*Record[S, E], error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := append([]*Record[S, E](nil), h.records[entityId]...)
+	//并发保存时追加的顺序可能和版本号的顺序不一致
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Version < records[j].Version
+	})
+	return records, nil
+}
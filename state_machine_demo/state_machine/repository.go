@@ -0,0 +1,216 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+实体状态的持久化：
+1. Store负责保存实体的状态和版本号，保存时比较版本号（CAS），版本号不一致说明状态已经被其他请求修改
+2. Repository加载当前状态 -> 状态机计算目标状态（只执行guard） -> 按加载时的版本号保存 -> 保存成功后执行action，
+   版本冲突时重新加载后重试，没有保存成功的转换不会执行action，重试也不会重复执行
+3. 同一个实体的并发事件只有一个能基于同一个版本推进，另一个重试时基于新的状态重新判断能否接受事件
+4. 设置了HistoryStore时同时追加转换记录：Store实现了RecordingStore时在同一个事务中保存状态和追加记录，
+   否则保存成功后再追加，追加失败时返回ErrHistoryAppend，此时状态已经推进，可以通过Advanced判断
+*/
+
+var (
+	ErrEntityNotFound  = errors.New("entity not found")
+	ErrEntityExists    = errors.New("entity already exists")
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrActionFailed 状态已经保存，执行action失败
+	ErrActionFailed = errors.New("action failed after state saved")
+	// ErrHistoryAppend 状态已经保存，追加转换记录失败
+	ErrHistoryAppend = errors.New("append history failed after state saved")
+)
+
+type Store[S comparable] interface {
+	// Create 保存新的实体，版本号为0
+	Create(ctx context.Context, id string, state S) error
+	// Load 返回当前状态和版本号，实体不存在时返回ErrEntityNotFound
+	Load(ctx context.Context, id string) (S, int64, error)
+	// Save 版本号等于expectVersion时保存状态并把版本号加1，否则返回ErrVersionConflict
+	Save(ctx context.Context, id string, state S, expectVersion int64) error
+}
+
+// RecordingStore 在同一个事务中保存状态和追加转换记录，保证转换记录没有缺失
+type RecordingStore[S, E comparable] interface {
+	// SaveWithRecord 版本号等于expectVersion时保存状态、把版本号加1并追加记录，否则返回ErrVersionConflict
+	SaveWithRecord(ctx context.Context, id string, state S, expectVersion int64, record *Record[S, E]) error
+}
+
+// Advanced FireBy返回的错误是否发生在状态保存之后，此时状态已经推进
+func Advanced(err error) bool {
+	return errors.Is(err, ErrActionFailed) || errors.Is(err, ErrHistoryAppend)
+}
+
+type Repository[S, E comparable] struct {
+	machine *StateMachine[S, E]
+	store   Store[S]
+	history HistoryStore[S, E]
+	// 版本冲突时的最大重试次数
+	maxRetry int
+}
+
+func NewRepository[S, E comparable](machine *StateMachine[S, E], store Store[S]) *Repository[S, E] {
+	return &Repository[S, E]{
+		machine:  machine,
+		store:    store,
+		maxRetry: 3,
+	}
+}
+
+func (r *Repository[S, E]) SetMaxRetry(maxRetry int) {
+	r.maxRetry = maxRetry
+}
+
+// SetHistory 设置后每次转换都会记录到history中
+func (r *Repository[S, E]) SetHistory(history HistoryStore[S, E]) {
+	r.history = history
+}
+
+func (r *Repository[S, E]) Machine() *StateMachine[S, E] {
+	return r.machine
+}
+
+// Create 以状态机的初始状态创建实体
+func (r *Repository[S, E]) Create(ctx context.Context, id string) error {
+	return r.store.Create(ctx, id, r.machine.Initial())
+}
+
+// State 查询实体当前的状态
+func (r *Repository[S, E]) State(ctx context.Context, id string) (S, error) {
+	s, _, err := r.store.Load(ctx, id)
+	return s, err
+}
+
+// Fire 对实体触发事件，返回推进后的状态
+func (r *Repository[S, E]) Fire(ctx context.Context, id string, event E, payload interface{}) (S, error) {
+	return r.FireBy(ctx, id, event, payload, "", nil)
+}
+
+// FireBy 对实体触发事件，actor和metadata记录到转换记录中
+func (r *Repository[S, E]) FireBy(ctx context.Context, id string, event E, payload interface{}, actor string, metadata map[string]string) (S, error) {
+	for i := 0; ; i++ {
+		from, version, err := r.store.Load(ctx, id)
+		if err != nil {
+			return from, err
+		}
+		to, steps, err := r.machine.next(from, event, payload)
+		if err != nil {
+			return from, err
+		}
+		record := &Record[S, E]{
+			EntityId: id,
+			From:     from,
+			Event:    event,
+			To:       to,
+			Version:  version + 1,
+			At:       time.Now(),
+			Actor:    actor,
+			Metadata: metadata,
+		}
+		var recordErr error
+		if rs, ok := r.store.(RecordingStore[S, E]); ok && r.history != nil {
+			err = rs.SaveWithRecord(ctx, id, to, version, record)
+		} else if err = r.store.Save(ctx, id, to, version); err == nil {
+			recordErr = r.record(ctx, record)
+		}
+		if err == nil {
+			//状态已经保存，再执行action，版本冲突时不会执行没有保存成功的转换的action
+			if err = r.machine.run(steps); err != nil {
+				err = fmt.Errorf("%w: %v", ErrActionFailed, err)
+			}
+			if recordErr != nil {
+				return to, recordErr
+			}
+			return to, err
+		}
+		if !errors.Is(err, ErrVersionConflict) || i >= r.maxRetry {
+			return from, err
+		}
+	}
+}
+
+// record Store不支持事务时在保存成功后追加记录
+func (r *Repository[S, E]) record(ctx context.Context, record *Record[S, E]) error {
+	if r.history == nil {
+		return nil
+	}
+	if err := r.history.Append(ctx, record); err != nil {
+		return fmt.Errorf("%w: %s version %d: %v", ErrHistoryAppend, record.EntityId, record.Version, err)
+	}
+	return nil
+}
+
+// History 按版本号升序返回实体的所有转换记录
+func (r *Repository[S, E]) History(ctx context.Context, id string) ([]*Record[S, E], error) {
+	if r.history == nil {
+		return nil, errors.New("history store is not set")
+	}
+	return r.history.List(ctx, id)
+}
+
+// Replay 通过重放转换记录重建实体的状态
+func (r *Repository[S, E]) Replay(ctx context.Context, id string) (S, error) {
+	records, err := r.History(ctx, id)
+	if err != nil {
+		return r.machine.Initial(), err
+	}
+	return Replay(r.machine, records)
+}
+
+type memoryEntity[S comparable] struct {
+	state   S
+	version int64
+}
+
+// MemoryStore 基于map的Store，用于测试和单机演示
+type MemoryStore[S comparable] struct {
+	mu       sync.Mutex
+	entities map[string]*memoryEntity[S]
+}
+
+func NewMemoryStore[S comparable]() *MemoryStore[S] {
+	return &MemoryStore[S]{entities: make(map[string]*memoryEntity[S])}
+}
+
+func (s *MemoryStore[S]) Create(ctx context.Context, id string, state S) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entities[id]; ok {
+		return fmt.Errorf("%w: %s", ErrEntityExists, id)
+	}
+	s.entities[id] = &memoryEntity[S]{state: state}
+	return nil
+}
+
+func (s *MemoryStore[S]) Load(ctx context.Context, id string) (S, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entities[id]
+	if !ok {
+		var zero S
+		return zero, 0, fmt.Errorf("%w: %s", ErrEntityNotFound, id)
+	}
+	return e.state, e.version, nil
+}
+
+func (s *MemoryStore[S]) Save(ctx context.Context, id string, state S, expectVersion int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entities[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEntityNotFound, id)
+	}
+	if e.version != expectVersion {
+		return fmt.Errorf("%w: %s expect version %d, current version %d", ErrVersionConflict, id, expectVersion, e.version)
+	}
+	e.state = state
+	e.version++
+	return nil
+}
@@ -0,0 +1,205 @@
+package state_machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRepositoryFire(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red")
+	b.Transition("red", "next", "green")
+	b.Transition("green", "next", "yellow")
+	repo := NewRepository(b.MustBuild(), NewMemoryStore[light]())
+	ctx := context.Background()
+
+	if _, err := repo.Fire(ctx, "1", "next", nil); !errors.Is(err, ErrEntityNotFound) {
+		t.Fatalf("got %v", err)
+	}
+	if err := repo.Create(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(ctx, "1"); !errors.Is(err, ErrEntityExists) {
+		t.Fatalf("got %v", err)
+	}
+	if s, err := repo.Fire(ctx, "1", "next", nil); err != nil || s != "green" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if s, _ := repo.State(ctx, "1"); s != "green" {
+		t.Fatalf("got %v", s)
+	}
+}
+
+func TestRepositoryConcurrentFire(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red")
+	b.Transition("red", "next", "green")
+	store := NewMemoryStore[light]()
+	repo := NewRepository(b.MustBuild(), store)
+	ctx := context.Background()
+	repo.Create(ctx, "1")
+
+	//同一个版本只有一个请求能推进状态，其他请求重新加载后不能再接受事件
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Fire(ctx, "1", "next", nil)
+			if err == nil {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrUndefinedTransition) {
+				t.Errorf("got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if success != 1 {
+		t.Fatalf("got %d", success)
+	}
+	if _, version, _ := store.Load(ctx, "1"); version != 1 {
+		t.Fatalf("got version %d", version)
+	}
+	if err := store.Save(ctx, "1", "red", 0); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRepositoryHistory(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red")
+	b.Transition("red", "next", "green")
+	b.Transition("green", "next", "yellow")
+	repo := NewRepository(b.MustBuild(), NewMemoryStore[light]())
+	history := NewMemoryHistoryStore[light, signal]()
+	repo.SetHistory(history)
+	ctx := context.Background()
+	repo.Create(ctx, "1")
+	repo.FireBy(ctx, "1", "next", nil, "alice", map[string]string{"reason": "test"})
+	repo.Fire(ctx, "1", "next", nil)
+	//未定义的转换不记录
+	repo.Fire(ctx, "1", "next", nil)
+
+	records, err := repo.History(ctx, "1")
+	if err != nil || len(records) != 2 {
+		t.Fatalf("got %v %v", records, err)
+	}
+	if r := records[0]; r.From != "red" || r.To != "green" || r.Version != 1 || r.Actor != "alice" || r.Metadata["reason"] != "test" {
+		t.Fatalf("got %+v", r)
+	}
+	if s, err := repo.Replay(ctx, "1"); err != nil || s != "yellow" {
+		t.Fatalf("got %v %v", s, err)
+	}
+
+	history.Append(ctx, &Record[light, signal]{EntityId: "1", From: "red", Event: "next", To: "green", Version: 3})
+	if _, err = repo.Replay(ctx, "1"); !errors.Is(err, ErrInvalidHistory) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// conflictStore 前conflicts次Save返回版本冲突
+type conflictStore struct {
+	*MemoryStore[light]
+	conflicts int
+}
+
+func (s *conflictStore) Save(ctx context.Context, id string, state light, expectVersion int64) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return fmt.Errorf("%w: %s", ErrVersionConflict, id)
+	}
+	return s.MemoryStore.Save(ctx, id, state, expectVersion)
+}
+
+func TestRepositoryActionsAfterSave(t *testing.T) {
+	calls := 0
+	count := func(c *TransitionContext[light, signal]) error {
+		calls++
+		return nil
+	}
+	b := NewBuilder[light, signal]("light").Initial("red").OnExit("red", count).OnEntry("green", count)
+	b.Transition("red", "next", "green").Action(count)
+	store := &conflictStore{MemoryStore: NewMemoryStore[light](), conflicts: 1}
+	repo := NewRepository(b.MustBuild(), store)
+	repo.SetMaxRetry(0)
+	ctx := context.Background()
+	repo.Create(ctx, "1")
+
+	//保存冲突时不执行action
+	if _, err := repo.Fire(ctx, "1", "next", nil); !errors.Is(err, ErrVersionConflict) || calls != 0 {
+		t.Fatalf("got %v, %d actions", err, calls)
+	}
+	//冲突后重试成功时action只执行一次
+	store.conflicts = 2
+	repo.SetMaxRetry(3)
+	if s, err := repo.Fire(ctx, "1", "next", nil); err != nil || s != "green" || calls != 3 {
+		t.Fatalf("got %v %v, %d actions", s, err, calls)
+	}
+
+	//action失败时状态已经保存
+	b = NewBuilder[light, signal]("light").Initial("red")
+	b.Transition("red", "next", "green").Action(func(c *TransitionContext[light, signal]) error {
+		return errors.New("notify failed")
+	})
+	repo = NewRepository(b.MustBuild(), NewMemoryStore[light]())
+	repo.Create(ctx, "1")
+	if s, err := repo.Fire(ctx, "1", "next", nil); !errors.Is(err, ErrActionFailed) || s != "green" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if s, _ := repo.State(ctx, "1"); s != "green" {
+		t.Fatalf("got %v", s)
+	}
+}
+
+type failingHistory struct {
+	*MemoryHistoryStore[light, signal]
+}
+
+func (h *failingHistory) Append(ctx context.Context, record *Record[light, signal]) error {
+	return errors.New("disk full")
+}
+
+// recordingStore 保存状态后直接追加记录，模拟数据库事务
+type recordingStore struct {
+	*MemoryStore[light]
+	history *MemoryHistoryStore[light, signal]
+}
+
+func (s *recordingStore) SaveWithRecord(ctx context.Context, id string, state light, expectVersion int64, record *Record[light, signal]) error {
+	if err := s.Save(ctx, id, state, expectVersion); err != nil {
+		return err
+	}
+	return s.history.Append(ctx, record)
+}
+
+func TestRepositoryHistoryStore(t *testing.T) {
+	b := NewBuilder[light, signal]("light").Initial("red")
+	b.Transition("red", "next", "green")
+	machine := b.MustBuild()
+	ctx := context.Background()
+
+	//不支持事务的Store追加记录失败时状态已经推进
+	repo := NewRepository(machine, NewMemoryStore[light]())
+	repo.SetHistory(&failingHistory{NewMemoryHistoryStore[light, signal]()})
+	repo.Create(ctx, "1")
+	s, err := repo.Fire(ctx, "1", "next", nil)
+	if !errors.Is(err, ErrHistoryAppend) || !Advanced(err) || s != "green" {
+		t.Fatalf("got %v %v", s, err)
+	}
+
+	//RecordingStore在保存状态时追加记录，不再调用HistoryStore.Append
+	history := NewMemoryHistoryStore[light, signal]()
+	repo = NewRepository(machine, &recordingStore{MemoryStore: NewMemoryStore[light](), history: history})
+	repo.SetHistory(&failingHistory{history})
+	repo.Create(ctx, "1")
+	if s, err = repo.Fire(ctx, "1", "next", nil); err != nil || s != "green" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if s, err = repo.Replay(ctx, "1"); err != nil || s != "green" {
+		t.Fatalf("got %v %v", s, err)
+	}
+}
@@ -0,0 +1,498 @@
+package state_machine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/*
+通用的状态机，S为状态类型，E为事件类型：
+1. 通过Builder声明状态转换：源状态 + 事件 -> 目标状态，同一个源状态和事件可以声明多个转换，按声明顺序选择第一个guard通过的
+2. guard决定转换是否允许，action在转换时执行：源状态的exit action -> 转换的action -> 目标状态的entry action
+3. 状态机只描述规则，不保存状态，Fire根据当前状态和事件返回目标状态；未定义的转换、guard拒绝、action失败都返回错误
+4. 层次状态：复合状态包含子状态，进入复合状态时进入它的初始子状态；子状态继承父状态的转换，子状态自己声明的转换优先
+5. 并行状态：并行状态的子状态为相互独立的区域，进入并行状态时同时进入所有区域，此时的状态为多个叶子状态，通过FireAll推进；
+   事件交给每个区域的叶子状态处理，复合状态的子状态都完成（到达终态）时自动执行Done声明的转换
+*/
+
+var (
+	ErrUndefinedTransition = errors.New("undefined transition")
+	ErrGuardRejected       = errors.New("transition rejected by guard")
+	ErrParallelState       = errors.New("state machine is in parallel states")
+)
+
+// TransitionContext 转换时传给guard和action的上下文
+type TransitionContext[S, E comparable] struct {
+	From  S
+	Event E
+	To    S
+	// 事件携带的业务数据
+	Payload interface{}
+}
+
+// Guard 返回false时拒绝转换
+type Guard[S, E comparable] func(c *TransitionContext[S, E]) bool
+
+// Action 返回错误时转换失败，状态不变；通过Repository触发时action在状态保存成功后执行，返回错误时状态已经推进
+type Action[S, E comparable] func(c *TransitionContext[S, E]) error
+
+type transition[S, E comparable] struct {
+	from    S
+	event   E
+	to      S
+	guard   Guard[S, E]
+	actions []Action[S, E]
+	// 复合状态完成时自动执行的转换，没有事件
+	done bool
+}
+
+type StateMachine[S, E comparable] struct {
+	name    string
+	initial S
+	// 按声明顺序记录的所有状态
+	states      []S
+	finals      map[S]bool
+	transitions map[S]map[E][]*transition[S, E]
+	entry       map[S][]Action[S, E]
+	exit        map[S][]Action[S, E]
+	// 按声明顺序记录的所有转换
+	ordered []*transition[S, E]
+	// 子状态 -> 父状态
+	parent map[S]S
+	// 复合状态的子状态，并行状态的子状态为各个区域
+	children map[S][]S
+	// 复合状态的初始子状态
+	initialChild map[S]S
+	parallel     map[S]bool
+	done         map[S][]*transition[S, E]
+}
+
+func (m *StateMachine[S, E]) Name() string {
+	return m.name
+}
+
+// Initial 初始状态
+func (m *StateMachine[S, E]) Initial() S {
+	return m.initial
+}
+
+func (m *StateMachine[S, E]) States() []S {
+	return append([]S(nil), m.states...)
+}
+
+// IsFinal 是否为终态
+func (m *StateMachine[S, E]) IsFinal(s S) bool {
+	return m.finals[s]
+}
+
+// Parent 父状态，顶层状态返回false
+func (m *StateMachine[S, E]) Parent(s S) (S, bool) {
+	p, ok := m.parent[s]
+	return p, ok
+}
+
+// Events 当前状态和父状态声明了转换的事件，不考虑guard
+func (m *StateMachine[S, E]) Events(from S) []E {
+	events := make([]E, 0)
+	seen := make(map[E]bool)
+	for _, s := range m.lineage(from) {
+		for e := range m.transitions[s] {
+			if !seen[e] {
+				seen[e] = true
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
+
+// lineage 状态自己和所有祖先状态，由内到外
+func (m *StateMachine[S, E]) lineage(s S) []S {
+	chain := []S{s}
+	for p, ok := m.parent[s]; ok; p, ok = m.parent[p] {
+		chain = append(chain, p)
+	}
+	return chain
+}
+
+// isAncestor a是否为s的祖先状态，不包括s自己
+func (m *StateMachine[S, E]) isAncestor(a, s S) bool {
+	for p, ok := m.parent[s]; ok; p, ok = m.parent[p] {
+		if p == a {
+			return true
+		}
+	}
+	return false
+}
+
+// commonAncestor 最近的公共祖先状态，不包括a和b自己
+func (m *StateMachine[S, E]) commonAncestor(a, b S) (S, bool) {
+	for _, p := range m.lineage(a)[1:] {
+		if m.isAncestor(p, b) {
+			return p, true
+		}
+	}
+	var zero S
+	return zero, false
+}
+
+func (m *StateMachine[S, E]) depth(s S) int {
+	return len(m.lineage(s)) - 1
+}
+
+// Leaves 进入状态s后处于的叶子状态：复合状态进入初始子状态，并行状态进入所有区域
+func (m *StateMachine[S, E]) Leaves(s S) []S {
+	leaves := make([]S, 0)
+	m.enterDefault(s, func(S) {}, func(leaf S) { leaves = append(leaves, leaf) })
+	return leaves
+}
+
+// enterDefault 按默认方式进入s，enter按进入顺序回调所有进入的状态，leaf回调进入的叶子状态
+func (m *StateMachine[S, E]) enterDefault(s S, enter func(S), leaf func(S)) {
+	enter(s)
+	m.enterChildren(s, enter, leaf)
+}
+
+func (m *StateMachine[S, E]) enterChildren(s S, enter func(S), leaf func(S)) {
+	switch {
+	case m.parallel[s]:
+		for _, region := range m.children[s] {
+			m.enterDefault(region, enter, leaf)
+		}
+	case len(m.children[s]) > 0:
+		m.enterDefault(m.initialChild[s], enter, leaf)
+	default:
+		leaf(s)
+	}
+}
+
+// normalize 把当前状态转成叶子状态，复合状态按默认方式进入
+func (m *StateMachine[S, E]) normalize(active []S) []S {
+	leaves := make([]S, 0, len(active))
+	seen := make(map[S]bool)
+	for _, s := range active {
+		for _, leaf := range m.Leaves(s) {
+			if !seen[leaf] {
+				seen[leaf] = true
+				leaves = append(leaves, leaf)
+			}
+		}
+	}
+	return leaves
+}
+
+// activeSet 叶子状态和它们的所有祖先状态
+func (m *StateMachine[S, E]) activeSet(leaves []S) map[S]bool {
+	active := make(map[S]bool)
+	for _, leaf := range leaves {
+		for _, s := range m.lineage(leaf) {
+			active[s] = true
+		}
+	}
+	return active
+}
+
+// find 从from开始由内到外，按声明顺序查找第一个guard通过的转换
+func (m *StateMachine[S, E]) find(from S, event E, payload interface{}) (*transition[S, E], *TransitionContext[S, E], error) {
+	rejected := false
+	for _, s := range m.lineage(from) {
+		for _, t := range m.transitions[s][event] {
+			c := &TransitionContext[S, E]{From: from, Event: event, To: t.to, Payload: payload}
+			if t.guard == nil || t.guard(c) {
+				return t, c, nil
+			}
+			rejected = true
+		}
+	}
+	if rejected {
+		return nil, nil, fmt.Errorf("%w: %s %v -> %v", ErrGuardRejected, m.name, from, event)
+	}
+	return nil, nil, fmt.Errorf("%w: %s can not accept %v in %v", ErrUndefinedTransition, m.name, event, from)
+}
+
+// Can 当前状态能否接受事件
+func (m *StateMachine[S, E]) Can(from S, event E, payload interface{}) bool {
+	_, _, err := m.find(from, event, payload)
+	return err == nil
+}
+
+// Defined 是否声明了 from（或者祖先状态）+ event -> to 的转换，不考虑guard；
+// to也可以是进入目标状态后的叶子状态，或者之后复合状态完成时通过Done转换到达的状态，与Fire返回的状态一致
+func (m *StateMachine[S, E]) Defined(from S, event E, to S) bool {
+	leaves := m.normalize([]S{from})
+	for _, s := range m.lineage(from) {
+		for _, t := range m.transitions[s][event] {
+			if t.to == to {
+				return true
+			}
+			st := m.plan(leaves, t, &TransitionContext[S, E]{From: from, Event: event, To: t.to})
+			if m.reaches(st.leaves, to, len(m.states)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reaches 叶子状态中包含to，或者通过Done转换可以到达to，不考虑guard；depth限制Done转换的次数
+func (m *StateMachine[S, E]) reaches(leaves []S, to S, depth int) bool {
+	for _, leaf := range leaves {
+		if leaf == to {
+			return true
+		}
+	}
+	if depth == 0 {
+		return false
+	}
+	for _, t := range m.completions(leaves) {
+		st := m.plan(leaves, t, &TransitionContext[S, E]{From: t.from, To: t.to})
+		if m.reaches(st.leaves, to, depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// step 一次转换退出和进入的状态
+type step[S, E comparable] struct {
+	t       *transition[S, E]
+	c       *TransitionContext[S, E]
+	exited  []S
+	entered []S
+	leaves  []S
+}
+
+// plan 计算在叶子状态leaves下执行转换t后退出和进入的状态
+func (m *StateMachine[S, E]) plan(leaves []S, t *transition[S, E], c *TransitionContext[S, E]) *step[S, E] {
+	st := &step[S, E]{t: t, c: c, leaves: leaves}
+	//自己转换到自己时不执行exit和entry
+	if t.from == t.to {
+		return st
+	}
+	//转换的范围：源状态和目标状态最近的公共祖先，一个是另一个的祖先时为祖先状态自己，没有公共祖先时为整个状态机
+	var scope S
+	hasScope := true
+	switch {
+	case m.isAncestor(t.from, t.to):
+		scope = t.from
+	case m.isAncestor(t.to, t.from):
+		scope = t.to
+	default:
+		scope, hasScope = m.commonAncestor(t.from, t.to)
+	}
+	inScope := func(s S) bool {
+		return !hasScope || m.isAncestor(scope, s)
+	}
+	//退出范围内所有激活的状态，由内到外
+	seen := make(map[S]bool)
+	st.leaves = make([]S, 0, len(leaves))
+	for _, leaf := range leaves {
+		if !inScope(leaf) {
+			st.leaves = append(st.leaves, leaf)
+			continue
+		}
+		for _, s := range m.lineage(leaf) {
+			if !inScope(s) || seen[s] {
+				break
+			}
+			seen[s] = true
+			st.exited = append(st.exited, s)
+		}
+	}
+	sort.SliceStable(st.exited, func(i, j int) bool {
+		return m.depth(st.exited[i]) > m.depth(st.exited[j])
+	})
+	//由外到内进入目标状态，路径上的并行状态的其他区域按默认方式进入
+	path := make([]S, 0)
+	for _, s := range m.lineage(t.to) {
+		if !inScope(s) {
+			break
+		}
+		path = append(path, s)
+	}
+	enter := func(s S) { st.entered = append(st.entered, s) }
+	leaf := func(s S) { st.leaves = append(st.leaves, s) }
+	others := make([]S, 0)
+	for i := len(path) - 1; i >= 0; i-- {
+		s := path[i]
+		enter(s)
+		if i > 0 && m.parallel[s] {
+			for _, region := range m.children[s] {
+				if region != path[i-1] {
+					others = append(others, region)
+				}
+			}
+		}
+	}
+	m.enterChildren(t.to, enter, leaf)
+	for _, region := range others {
+		m.enterDefault(region, enter, leaf)
+	}
+	return st
+}
+
+func (st *step[S, E]) touches(touched map[S]bool) bool {
+	for _, s := range append(append([]S(nil), st.exited...), st.entered...) {
+		if touched[s] {
+			return true
+		}
+	}
+	return false
+}
+
+// completed 复合状态是否已经完成：叶子状态为终态；复合状态的激活子状态已经完成；并行状态的所有区域都已经完成
+func (m *StateMachine[S, E]) completed(s S, active map[S]bool) bool {
+	children := m.children[s]
+	if len(children) == 0 {
+		return m.finals[s]
+	}
+	for _, child := range children {
+		if m.parallel[s] && !m.completed(child, active) {
+			return false
+		}
+		if !m.parallel[s] && active[child] {
+			return m.completed(child, active)
+		}
+	}
+	return m.parallel[s]
+}
+
+// completions 已经完成的复合状态的所有Done转换，由内到外
+func (m *StateMachine[S, E]) completions(leaves []S) []*transition[S, E] {
+	active := m.activeSet(leaves)
+	candidates := make([]S, 0)
+	for s := range active {
+		if len(m.done[s]) > 0 && m.completed(s, active) {
+			candidates = append(candidates, s)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return m.depth(candidates[i]) > m.depth(candidates[j])
+	})
+	transitions := make([]*transition[S, E], 0)
+	for _, s := range candidates {
+		transitions = append(transitions, m.done[s]...)
+	}
+	return transitions
+}
+
+// completion 查找一个已经完成的复合状态的Done转换，由内到外，选择第一个guard通过的
+func (m *StateMachine[S, E]) completion(leaves []S, payload interface{}) *step[S, E] {
+	for _, t := range m.completions(leaves) {
+		c := &TransitionContext[S, E]{From: t.from, To: t.to, Payload: payload}
+		if t.guard == nil || t.guard(c) {
+			return m.plan(leaves, t, c)
+		}
+	}
+	return nil
+}
+
+// prepare 计算事件触发的所有转换和转换后的叶子状态，不执行action
+// 每个叶子状态由内到外查找转换，内层的转换优先，和已经执行的转换涉及相同状态的转换被忽略；没有任何叶子状态能接受事件时返回错误
+func (m *StateMachine[S, E]) prepare(active []S, event E, payload interface{}) ([]S, []*step[S, E], error) {
+	leaves := m.normalize(active)
+	found := make([]*step[S, E], 0)
+	var firstErr error
+	for _, leaf := range leaves {
+		t, c, err := m.find(leaf, event, payload)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		found = append(found, &step[S, E]{t: t, c: c})
+	}
+	if len(found) == 0 {
+		return nil, nil, firstErr
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return m.depth(found[i].t.from) > m.depth(found[j].t.from)
+	})
+	steps := make([]*step[S, E], 0, len(found))
+	touched := make(map[S]bool)
+	for _, f := range found {
+		//源状态已经被前面的转换退出
+		if !m.activeSet(leaves)[f.t.from] {
+			continue
+		}
+		st := m.plan(leaves, f.t, f.c)
+		if st.touches(touched) {
+			continue
+		}
+		for _, s := range append(st.exited, st.entered...) {
+			touched[s] = true
+		}
+		leaves = st.leaves
+		steps = append(steps, st)
+	}
+	//复合状态完成后自动转换，最多执行状态个数次，避免Done转换形成环时死循环
+	for i := 0; i < len(m.states); i++ {
+		st := m.completion(leaves, payload)
+		if st == nil {
+			break
+		}
+		leaves = st.leaves
+		steps = append(steps, st)
+	}
+	return leaves, steps, nil
+}
+
+// FireAll 根据当前状态和事件执行转换，返回转换后的叶子状态，失败时返回当前状态和错误
+// 当前状态为各个区域的叶子状态，也可以是复合状态，复合状态按默认方式进入
+func (m *StateMachine[S, E]) FireAll(active []S, event E, payload interface{}) ([]S, error) {
+	leaves, steps, err := m.prepare(active, event, payload)
+	if err != nil {
+		return active, err
+	}
+	if err = m.run(steps); err != nil {
+		return active, err
+	}
+	return leaves, nil
+}
+
+// run 按顺序执行每个转换的action：源状态的exit action -> 转换的action -> 目标状态的entry action
+func (m *StateMachine[S, E]) run(steps []*step[S, E]) error {
+	for _, st := range steps {
+		t := st.t
+		actions := make([]Action[S, E], 0)
+		for _, s := range st.exited {
+			actions = append(actions, m.exit[s]...)
+		}
+		actions = append(actions, t.actions...)
+		for _, s := range st.entered {
+			actions = append(actions, m.entry[s]...)
+		}
+		for _, action := range actions {
+			if err := action(st.c); err != nil {
+				return fmt.Errorf("%s %v -%v-> %v: %w", m.name, t.from, t.event, t.to, err)
+			}
+		}
+	}
+	return nil
+}
+
+// next 计算Fire的目标状态和需要执行的转换，不执行action
+func (m *StateMachine[S, E]) next(from S, event E, payload interface{}) (S, []*step[S, E], error) {
+	leaves, steps, err := m.prepare([]S{from}, event, payload)
+	if err != nil {
+		return from, nil, err
+	}
+	if len(leaves) != 1 {
+		return from, nil, fmt.Errorf("%w: %s %v -%v-> %v", ErrParallelState, m.name, from, event, leaves)
+	}
+	return leaves[0], steps, nil
+}
+
+// Fire 根据当前状态和事件执行转换，返回目标状态，失败时返回当前状态和错误；转换后处于并行状态时返回ErrParallelState，需要使用FireAll
+func (m *StateMachine[S, E]) Fire(from S, event E, payload interface{}) (S, error) {
+	to, steps, err := m.next(from, event, payload)
+	if err != nil {
+		return from, err
+	}
+	if err = m.run(steps); err != nil {
+		return from, err
+	}
+	return to, nil
+}
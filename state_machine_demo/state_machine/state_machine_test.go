@@ -0,0 +1,62 @@
+package state_machine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type light string
+type signal string
+
+func TestFire(t *testing.T) {
+	var trace []string
+	record := func(name string) Action[light, signal] {
+		return func(c *TransitionContext[light, signal]) error {
+			trace = append(trace, name)
+			return nil
+		}
+	}
+	b := NewBuilder[light, signal]("light").
+		Initial("red").
+		OnExit("red", record("exit red")).
+		OnEntry("green", record("entry green"))
+	b.Transition("red", "next", "green").Action(record("red->green"))
+	//payload为true时才允许从green切换到yellow，否则切换到red
+	b.Transition("green", "next", "yellow").Guard(func(c *TransitionContext[light, signal]) bool {
+		return c.Payload == true
+	})
+	b.Transition("green", "next", "red")
+	b.Transition("yellow", "next", "red").Action(func(c *TransitionContext[light, signal]) error {
+		return errors.New("broken")
+	})
+	m := b.MustBuild()
+
+	s, err := m.Fire(m.Initial(), "next", nil)
+	if err != nil || s != "green" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if got := strings.Join(trace, ","); got != "exit red,red->green,entry green" {
+		t.Fatalf("got %s", got)
+	}
+	if s, _ = m.Fire("green", "next", true); s != "yellow" {
+		t.Fatalf("got %v", s)
+	}
+	if s, _ = m.Fire("green", "next", false); s != "red" {
+		t.Fatalf("got %v", s)
+	}
+	if s, err = m.Fire("yellow", "next", nil); s != "yellow" || err == nil {
+		t.Fatalf("got %v %v", s, err)
+	}
+	if _, err = m.Fire("red", "stop", nil); !errors.Is(err, ErrUndefinedTransition) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestBuildWithoutInitial(t *testing.T) {
+	b := NewBuilder[light, signal]("light")
+	b.Transition("red", "next", "green")
+	if _, err := b.Build(); !errors.Is(err, ErrNoInitialState) {
+		t.Fatalf("got %v", err)
+	}
+}